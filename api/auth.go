@@ -0,0 +1,174 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"crypto"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"strings"
+
+	sigcrypto "github.com/uwemakan/signing-service/crypto"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// APIKeyHeader is the request header carrying the caller's API key.
+const APIKeyHeader = "X-API-Key"
+
+type principalContextKey struct{}
+
+// withPrincipal returns a copy of the request carrying the authenticated principal.
+func withPrincipal(request *http.Request, principal *domain.Principal) *http.Request {
+	ctx := context.WithValue(request.Context(), principalContextKey{}, principal)
+	return request.WithContext(ctx)
+}
+
+// principalFromRequest returns the authenticated principal of the request, or
+// nil when authentication is disabled.
+func principalFromRequest(request *http.Request) *domain.Principal {
+	return principalFromContext(request.Context())
+}
+
+// principalFromContext returns the authenticated principal of the request or
+// call of ctx, or nil when authentication is disabled.
+func principalFromContext(ctx context.Context) *domain.Principal {
+	principal, _ := ctx.Value(principalContextKey{}).(*domain.Principal)
+	return principal
+}
+
+// newJWTVerifier loads the JWKS file and static public keys of the config.
+// It returns nil when bearer token authentication is not configured.
+func newJWTVerifier(config utils.JWTConfig) (*sigcrypto.JWTVerifier, error) {
+	if !config.Enabled() {
+		return nil, nil
+	}
+	keys := make(map[string]crypto.PublicKey)
+	if config.JWKSFile != "" {
+		data, err := os.ReadFile(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		jwks, err := sigcrypto.ParseJWKS(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", config.JWKSFile, err)
+		}
+		maps.Copy(keys, jwks)
+	}
+	for kid, path := range config.PublicKeys {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := sigcrypto.ParsePublicKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		keys[kid] = key
+	}
+	return sigcrypto.NewJWTVerifier(keys, config.Issuer, config.Audience), nil
+}
+
+// clientCertificateAuthEnabled reports whether clients may authenticate with a
+// certificate verified against the configured client CA bundle.
+func (s *Server) clientCertificateAuthEnabled() bool {
+	clientAuth := s.config.TLS.ClientAuth
+	return s.config.TLS.Enabled() && (clientAuth == "request" || clientAuth == "require")
+}
+
+// authenticationEnabled reports whether API keys, bearer tokens or client
+// certificates are configured.
+func (s *Server) authenticationEnabled() bool {
+	return s.authService.Enabled() || s.jwtVerifier != nil || s.clientCertificateAuthEnabled()
+}
+
+// authenticate resolves the principal of a request from its credentials.
+func (s *Server) authenticate(request *http.Request) (*domain.Principal, error) {
+	return s.authenticateCredentials(request.Header.Get("Authorization"), request.Header.Get(APIKeyHeader), clientCertificateSubject(request))
+}
+
+// authenticateCredentials resolves the principal from a bearer token in the
+// authorization credentials or an API key. The subject of a verified client
+// certificate is recorded as the terminal of the principal; on its own it
+// authenticates the terminal as owner of its devices, with the
+// utils.CertificateScopes within the tenant of the TLS config.
+func (s *Server) authenticateCredentials(authorization, apiKey, terminal string) (*domain.Principal, error) {
+	var principal *domain.Principal
+	var err error
+	if token, found := strings.CutPrefix(authorization, "Bearer "); found {
+		principal, err = s.authenticateBearer(strings.TrimSpace(token))
+	} else if apiKey != "" || terminal == "" {
+		principal, err = s.authService.Authenticate(apiKey)
+	} else {
+		principal = &domain.Principal{
+			ID:         terminal,
+			Credential: utils.CredentialCertificate,
+			Owner:      domain.Qualify(utils.CredentialCertificate, terminal),
+			Tenant:     cmp.Or(s.config.TLS.ClientTenant, utils.DefaultTenant),
+			Scopes:     utils.CertificateScopes,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	principal.Terminal = terminal
+	return principal, nil
+}
+
+func (s *Server) authenticateBearer(token string) (*domain.Principal, error) {
+	if s.jwtVerifier == nil {
+		return nil, utils.ErrInvalidToken
+	}
+	claims, err := s.jwtVerifier.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	// A token without a tenant claim is limited to the default tenant, as
+	// are client certificates without a configured tenant.
+	return &domain.Principal{
+		ID:         claims.Subject,
+		Credential: utils.CredentialJWT,
+		Owner:      domain.Qualify(utils.CredentialJWT, claims.Subject),
+		Tenant:     cmp.Or(claims.Tenant, utils.DefaultTenant),
+		Scopes:     claims.Scopes(),
+	}, nil
+}
+
+// Authenticate is a middleware that rejects requests without a valid bearer
+// token or API key and attaches the resolved principal to the request context.
+// It is a no-op when the server runs with --insecure-no-auth.
+func (s *Server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if !s.authenticationEnabled() {
+			next.ServeHTTP(response, request)
+			return
+		}
+		principal, err := s.authenticate(request)
+		if err != nil {
+			if s.jwtVerifier != nil {
+				response.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			}
+			HandleError(response, request, err)
+			return
+		}
+		logAttrs(request, slog.String("principal", principal.ID))
+		next.ServeHTTP(response, withPrincipal(request, principal))
+	})
+}
+
+// Authorize is a middleware that rejects callers lacking the scope required
+// for the route.
+func (s *Server) Authorize(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		principal := principalFromRequest(request)
+		if principal != nil && !principal.HasScope(scope) {
+			response.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+			HandleError(response, request, utils.ErrInsufficientScope)
+			return
+		}
+		next.ServeHTTP(response, request)
+	})
+}
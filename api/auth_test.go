@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+var authConfig = &utils.Config{
+	ServerAddress: ":0",
+	AESKey:        []byte("1234567890123456"),
+	APIKeys: []utils.APIKeyConfig{
+		{ID: "key-a", Owner: "merchant-a", Secret: "secret-a"},
+		{ID: "key-b", Owner: "merchant-b", Secret: "secret-b"},
+	},
+}
+
+func serveWithAPIKey(t *testing.T, handler http.Handler, method, url, apiKey string, payload any) *httptest.ResponseRecorder {
+	requires := require.New(t)
+	body := &bytes.Buffer{}
+	if payload != nil {
+		requires.NoError(json.NewEncoder(body).Encode(payload))
+	}
+	request, err := http.NewRequest(method, url, body)
+	requires.NoError(err)
+	if apiKey != "" {
+		request.Header.Set(APIKeyHeader, apiKey)
+	}
+	recorder := httptest.NewRecorder()
+	serve(t, handler, recorder, request)
+	return recorder
+}
+
+func TestAuthenticate(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(authConfig).Routes()
+
+	testCases := []struct {
+		name   string
+		method string
+		url    string
+		apiKey string
+		code   int
+	}{
+		{name: "Authenticate_Missing_Key", method: http.MethodGet, url: "/api/v0/signature-devices", code: http.StatusUnauthorized},
+		{name: "Authenticate_Invalid_Key", method: http.MethodGet, url: "/api/v0/signature-devices", apiKey: "invalid", code: http.StatusUnauthorized},
+		{name: "Authenticate_Missing_Key_Get", method: http.MethodGet, url: "/api/v0/signature-devices/" + uuid.NewString(), code: http.StatusUnauthorized},
+		{name: "Authenticate_Missing_Key_Sign", method: http.MethodPost, url: "/api/v0/signature-devices/sign", code: http.StatusUnauthorized},
+		{name: "Authenticate_Missing_Key_Job", method: http.MethodGet, url: "/api/v0/jobs/" + uuid.NewString(), code: http.StatusUnauthorized},
+		{name: "Authenticate_Valid_Key", method: http.MethodGet, url: "/api/v0/signature-devices", apiKey: "secret-a", code: http.StatusOK},
+		{name: "Authenticate_Health_Public", method: http.MethodGet, url: "/api/v0/health", code: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := serveWithAPIKey(t, handler, tc.method, tc.url, tc.apiKey, nil)
+			requires.Equal(tc.code, recorder.Code)
+			if tc.code == http.StatusUnauthorized {
+				requires.Equal([]string{utils.ErrUnauthenticated.Error()}, problemMessages(t, recorder.Body.Bytes()))
+			}
+		})
+	}
+}
+
+func TestDeviceOwnership(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(authConfig).Routes()
+	id := uuid.NewString()
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "secret-a", &domain.SignatureDeviceRequest{
+		ID:        id,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+	var response Response
+	requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	b, err := json.Marshal(response.Data)
+	requires.NoError(err)
+	var device domain.SignatureDevice
+	requires.NoError(json.Unmarshal(b, &device))
+	requires.Equal("key:merchant-a", device.Owner)
+
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices/"+id, "secret-a", nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices/"+id, "secret-b", nil)
+	requires.Equal(http.StatusNotFound, recorder.Code)
+
+	for key, count := range map[string]int{"secret-a": 1, "secret-b": 0} {
+		recorder = serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices", key, nil)
+		requires.Equal(http.StatusOK, recorder.Code)
+		var response Response
+		requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+		b, err := json.Marshal(response.Data)
+		requires.NoError(err)
+		var devices []domain.SignatureDevice
+		requires.NoError(json.Unmarshal(b, &devices))
+		requires.Len(devices, count)
+	}
+
+	sign := &domain.SignTransactionRequest{
+		ID:   id,
+		Data: fmt.Sprintf("0_TESTDATA_%s", base64.StdEncoding.EncodeToString([]byte(id))),
+	}
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "secret-b", sign)
+	requires.Equal(http.StatusNotFound, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "secret-a", sign)
+	requires.Equal(http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/uwemakan/signing-service/domain"
+)
+
+// ExportSignatureDevices exports the devices of the tenant into an encrypted
+// backup archive.
+func (s *Server) ExportSignatureDevices(response http.ResponseWriter, request *http.Request) {
+	var secret domain.BackupSecret
+	err := s.decodeRequest(response, request, &secret)
+	if err != nil {
+		WriteMalformedRequest(response, request, err)
+		return
+	}
+	archive, err := s.signatureDeviceService.ExportSignatureDevices(request.Context(), principalFromRequest(request), requestTenant(request), secret)
+	if err != nil {
+		HandleError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, archive)
+}
+
+// ImportSignatureDevices restores the devices of a backup archive into the tenant.
+func (s *Server) ImportSignatureDevices(response http.ResponseWriter, request *http.Request) {
+	var restoreRequest domain.RestoreRequest
+	err := s.decodeRequestLimited(response, request, &restoreRequest, maxArchiveBodySize)
+	if err != nil {
+		WriteMalformedRequest(response, request, err)
+		return
+	}
+	errs := validateRestoreRequest(&restoreRequest)
+	if len(errs) > 0 {
+		WriteValidationErrors(response, request, errs)
+		return
+	}
+	restored, err := s.signatureDeviceService.ImportSignatureDevices(request.Context(), principalFromRequest(request), requestTenant(request), restoreRequest.Archive, restoreRequest.BackupSecret)
+	if err != nil {
+		HandleError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, &domain.RestoreResponse{Restored: restored})
+}
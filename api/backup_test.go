@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// exportSignatureDevices exports the devices served under prefix with the API key.
+func exportSignatureDevices(t *testing.T, handler http.Handler, prefix, apiKey string, secret domain.BackupSecret) *domain.BackupArchive {
+	requires := require.New(t)
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, prefix+"/backups", apiKey, &secret)
+	requires.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+	var response Response
+	requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	b, err := json.Marshal(response.Data)
+	requires.NoError(err)
+	var archive domain.BackupArchive
+	requires.NoError(json.Unmarshal(b, &archive))
+	return &archive
+}
+
+func TestBackupRestore(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(config).Routes()
+	secret := domain.BackupSecret{Passphrase: "correct horse battery staple"}
+	id := uuid.NewString()
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{
+		ID:        id,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+	archive := exportSignatureDevices(t, handler, "/api/v0", "", secret)
+	requires.NotContains(archive.Ciphertext, id)
+	// The device signs after the backup, restoring it would roll it back.
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v1/signature-devices/"+id+"/signatures", "", &domain.SignTransactionRequest{
+		Data: fmt.Sprintf("0_TESTDATA_%s", lastSignatureOf(t, handler, "/api/v1", id)),
+	})
+	requires.Equal(http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	testCases := []struct {
+		name    string
+		method  string
+		url     string
+		payload any
+		code    int
+		errors  []string
+	}{
+		{
+			name:    "Restore_Tenant",
+			method:  http.MethodPost,
+			url:     "/api/v1/tenants/restored/backups/restore",
+			payload: &domain.RestoreRequest{BackupSecret: secret, Archive: archive},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "Restore_Older_Backup",
+			method:  http.MethodPost,
+			url:     "/api/v0/backups/restore",
+			payload: &domain.RestoreRequest{BackupSecret: secret, Archive: archive},
+			code:    http.StatusConflict,
+			errors:  []string{utils.ErrBackupRollback.Error()},
+		},
+		{
+			name:    "Restore_Wrong_Passphrase",
+			method:  http.MethodPost,
+			url:     "/api/v1/tenants/other/backups/restore",
+			payload: &domain.RestoreRequest{BackupSecret: domain.BackupSecret{Passphrase: "incorrect horse battery"}, Archive: archive},
+			code:    http.StatusBadRequest,
+			errors:  []string{utils.ErrInvalidBackupArchive.Error()},
+		},
+		{
+			name:    "Restore_Missing_Archive",
+			method:  http.MethodPost,
+			url:     "/api/v0/backups/restore",
+			payload: &domain.RestoreRequest{BackupSecret: secret},
+			code:    http.StatusBadRequest,
+			errors:  []string{"archive is required"},
+		},
+		{
+			name:    "Export_Invalid_Secret",
+			method:  http.MethodPost,
+			url:     "/api/v0/backups",
+			payload: &domain.BackupSecret{},
+			code:    http.StatusBadRequest,
+			errors:  []string{utils.ErrInvalidBackupSecret.Error()},
+		},
+		{
+			name:   "Export_METHOD_NOT_ALLOWED",
+			method: http.MethodGet,
+			url:    "/api/v0/backups",
+			code:   http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := serveWithAPIKey(t, handler, tc.method, tc.url, "", tc.payload)
+			requires.Equal(tc.code, recorder.Code, recorder.Body.String())
+			if tc.errors != nil {
+				requires.Equal(tc.errors, problemMessages(t, recorder.Body.Bytes()))
+			}
+		})
+	}
+
+	// The restored device keeps signing in its new tenant.
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v1/tenants/restored/signature-devices/"+id+"/signatures", "", &domain.SignTransactionRequest{
+		Data: fmt.Sprintf("0_TESTDATA_%s", lastSignatureOf(t, handler, "/api/v1/tenants/restored", id)),
+	})
+	requires.Equal(http.StatusCreated, recorder.Code, recorder.Body.String())
+}
+
+// lastSignatureOf returns the last signature of the device served under prefix.
+func lastSignatureOf(t *testing.T, handler http.Handler, prefix, id string) string {
+	requires := require.New(t)
+	recorder := serveWithAPIKey(t, handler, http.MethodGet, prefix+"/signature-devices/"+id, "", nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	var response Response
+	requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	b, err := json.Marshal(response.Data)
+	requires.NoError(err)
+	var device domain.SignatureDevice
+	requires.NoError(json.Unmarshal(b, &device))
+	return device.LastSignature
+}
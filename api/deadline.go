@@ -0,0 +1,25 @@
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+// statusClientClosedRequest is the non-standard status logged for requests
+// abandoned by the caller before they were served.
+const statusClientClosedRequest = 499
+
+// Deadline is a middleware that cancels the work done for requests to the
+// route once its configured deadline has passed. Handlers observe the
+// deadline through the request context and answer 504 Gateway Timeout.
+func (s *Server) Deadline(route string, next http.Handler) http.Handler {
+	timeout := s.config.RequestTimeouts.For(route)
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		ctx, cancel := context.WithTimeout(request.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(response, request.WithContext(ctx))
+	})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func TestDeadline(t *testing.T) {
+	requires := require.New(t)
+	timeoutConfig := *authConfig
+	timeoutConfig.RequestTimeouts = utils.RequestTimeoutConfig{
+		Default: time.Minute,
+		Routes:  map[string]time.Duration{"/api/v0/signature-devices/sign": time.Nanosecond},
+	}
+	handler := NewServer(&timeoutConfig).Routes()
+	id := uuid.NewString()
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "secret-a", &domain.SignatureDeviceRequest{
+		ID:        id,
+		Algorithm: "ECC",
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+
+	// Signing is cut off by the deadline configured for its route.
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "secret-a", &domain.SignTransactionRequest{
+		ID:   id,
+		Data: "0_TESTDATA_" + base64.StdEncoding.EncodeToString([]byte(id)),
+	})
+	requires.Equal(http.StatusGatewayTimeout, recorder.Code)
+	requires.Contains(recorder.Body.String(), context.DeadlineExceeded.Error())
+
+	// Requests abandoned by the caller are not served.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request := httptest.NewRequestWithContext(ctx, http.MethodGet, "/api/v0/signature-devices/"+id, strings.NewReader(""))
+	request.Header.Set(APIKeyHeader, "secret-a")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	requires.Equal(statusClientClosedRequest, recorder.Code)
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uwemakan/signing-service/tracing"
+)
+
+// Request bodies larger than maxRequestBodySize are refused. Backup
+// archives hold every device of a tenant and are allowed up to
+// maxArchiveBodySize.
+const (
+	maxRequestBodySize = 1 << 20
+	maxArchiveBodySize = 32 << 20
+)
+
+// decodeRequest decodes the JSON body of a request into v in a span of its
+// own. Bodies over maxRequestBodySize are refused, and so are fields v
+// doesn't have, except on the v0 routes, which have always ignored them.
+func (s *Server) decodeRequest(response http.ResponseWriter, request *http.Request, v any) error {
+	return s.decodeRequestLimited(response, request, v, maxRequestBodySize)
+}
+
+// decodeRequestLimited is decodeRequest for bodies of up to limit bytes.
+func (s *Server) decodeRequestLimited(response http.ResponseWriter, request *http.Request, v any, limit int64) (err error) {
+	_, span := s.tracer.Start(request.Context(), "api.DecodeRequest")
+	defer tracing.End(span, &err)
+	decoder := json.NewDecoder(http.MaxBytesReader(response, request.Body, limit))
+	if routePrefix(request) != "/api/v0" {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
+}
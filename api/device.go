@@ -1,93 +1,241 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
+	"log/slog"
 	"net/http"
-	"strings"
 
 	"github.com/uwemakan/signing-service/domain"
 	"github.com/uwemakan/signing-service/utils"
 )
 
-func (s *Server) Handler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		s.ListSignatureDevices(w, r)
-	case http.MethodPost:
-		s.CreateSignatureDevice(w, r)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// deviceID returns the {id} path segment of a device route and whether it is
+// a valid device ID, in which case it is added to the request log.
+func deviceID(request *http.Request) (string, bool) {
+	id := request.PathValue("id")
+	if !validateUUID(id) {
+		return id, false
 	}
+	logAttrs(request, slog.String("device_id", id))
+	return id, true
 }
 
 func (s *Server) CreateSignatureDevice(response http.ResponseWriter, request *http.Request) {
-	b := request.Body
 	var deviceRequest domain.SignatureDeviceRequest
-	err := json.NewDecoder(b).Decode(&deviceRequest)
+	err := s.decodeRequest(response, request, &deviceRequest)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusUnprocessableEntity, []string{
-			http.StatusText(http.StatusUnprocessableEntity),
-		})
+		WriteMalformedRequest(response, request, err)
 		return
 	}
 	errs := validateSignatureDeviceRequest(&deviceRequest)
 	if len(errs) > 0 {
-		WriteErrorResponse(response, http.StatusBadRequest, errs)
+		WriteValidationErrors(response, request, errs)
 		return
 	}
-	device, err := s.signatureDeviceService.CreateSignatureDevice(&deviceRequest)
+	logAttrs(request, slog.String("device_id", deviceRequest.ID))
+	if request.URL.Query().Get("async") == "true" {
+		s.createSignatureDeviceAsync(response, request, &deviceRequest)
+		return
+	}
+	device, err := s.signatureDeviceService.CreateSignatureDevice(request.Context(), principalFromRequest(request), requestTenant(request), &deviceRequest)
 	if err != nil {
-		HandleError(response, err)
+		HandleError(response, request, err)
 		return
 	}
 	WriteAPIResponse(response, http.StatusCreated, device)
 }
 
+// createSignatureDeviceAsync queues the device creation and answers with
+// 202 Accepted and the job that can be polled at /jobs/{id} of the tenant.
+func (s *Server) createSignatureDeviceAsync(response http.ResponseWriter, request *http.Request, deviceRequest *domain.SignatureDeviceRequest) {
+	job, err := s.signatureDeviceService.CreateSignatureDeviceAsync(request.Context(), principalFromRequest(request), requestTenant(request), deviceRequest)
+	if err != nil {
+		HandleError(response, request, err)
+		return
+	}
+	response.Header().Set("Location", routePrefix(request)+"/jobs/"+job.ID)
+	WriteAPIResponse(response, http.StatusAccepted, job)
+}
+
 func (s *Server) GetSignatureDevice(response http.ResponseWriter, request *http.Request) {
-	id := strings.TrimPrefix(request.URL.Path, "/api/v0/signature-devices/")
+	id, valid := deviceID(request)
+	if !valid {
+		HandleError(response, request, utils.ErrInvalidDeviceId)
+		return
+	}
+	device, err := s.signatureDeviceService.GetSignatureDevice(request.Context(), principalFromRequest(request), requestTenant(request), id)
+	if err != nil {
+		HandleError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, device)
+}
 
-	if id == "" || !validateUUID(id) {
-		HandleError(response, utils.ErrInvalidDeviceId)
+// UpdateSignatureDevice changes the lifecycle status, label or metadata of a device.
+func (s *Server) UpdateSignatureDevice(response http.ResponseWriter, request *http.Request) {
+	id, valid := deviceID(request)
+	if !valid {
+		HandleError(response, request, utils.ErrInvalidDeviceId)
 		return
 	}
-	device, err := s.signatureDeviceService.GetSignatureDevice(id)
+	var updateRequest domain.UpdateSignatureDeviceRequest
+	err := s.decodeRequest(response, request, &updateRequest)
 	if err != nil {
-		HandleError(response, err)
+		WriteMalformedRequest(response, request, err)
+		return
+	}
+	errs := validateUpdateSignatureDeviceRequest(&updateRequest)
+	if len(errs) > 0 {
+		WriteValidationErrors(response, request, errs)
+		return
+	}
+	device, err := s.signatureDeviceService.UpdateSignatureDevice(request.Context(), principalFromRequest(request), requestTenant(request), id, &updateRequest)
+	if err != nil {
+		HandleError(response, request, err)
 		return
 	}
 
 	WriteAPIResponse(response, http.StatusOK, device)
 }
 
+// RotateDeviceKey replaces the key pair of a device and returns the signed
+// rotation record.
+func (s *Server) RotateDeviceKey(response http.ResponseWriter, request *http.Request) {
+	id, valid := deviceID(request)
+	if !valid {
+		HandleError(response, request, utils.ErrInvalidDeviceId)
+		return
+	}
+	rotation, err := s.signatureDeviceService.RotateDeviceKey(request.Context(), principalFromRequest(request), requestTenant(request), id)
+	if err != nil {
+		HandleError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, rotation)
+}
+
+// VerifySignature checks a signature of a device, including signatures made
+// with keys it has since rotated away from.
+func (s *Server) VerifySignature(response http.ResponseWriter, request *http.Request) {
+	id, valid := deviceID(request)
+	if !valid {
+		HandleError(response, request, utils.ErrInvalidDeviceId)
+		return
+	}
+	var verifyRequest domain.VerifySignatureRequest
+	err := s.decodeRequest(response, request, &verifyRequest)
+	if err != nil {
+		WriteMalformedRequest(response, request, err)
+		return
+	}
+	errs := validateVerifySignatureRequest(&verifyRequest)
+	if len(errs) > 0 {
+		WriteValidationErrors(response, request, errs)
+		return
+	}
+	verification, err := s.signatureDeviceService.VerifySignature(request.Context(), principalFromRequest(request), requestTenant(request), id, verifyRequest.SignedData, verifyRequest.Signature)
+	if err != nil {
+		HandleError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, verification)
+}
+
+// ListSignatureDevices lists a page of the devices matching the query. The
+// v0 API predates pagination: without a limit or cursor it lists every
+// matching device.
 func (s *Server) ListSignatureDevices(response http.ResponseWriter, request *http.Request) {
-	devices, err := s.signatureDeviceService.ListSignatureDevices()
+	query, errs := parseDeviceQuery(request.URL.Query())
+	if len(errs) > 0 {
+		WriteValidationErrors(response, request, errs)
+		return
+	}
+	list := s.signatureDeviceService.ListSignatureDevices
+	if routePrefix(request) == "/api/v0" && query.Limit == 0 && query.Cursor == "" {
+		list = s.listAllSignatureDevices
+	}
+	page, err := list(request.Context(), principalFromRequest(request), requestTenant(request), query)
 	if err != nil {
-		HandleError(response, err)
+		HandleError(response, request, err)
 		return
 	}
 
-	WriteAPIResponse(response, http.StatusOK, devices)
+	WritePageResponse(response, http.StatusOK, page.Devices, page.NextCursor)
+}
+
+// unpaginatedPageSize is the size of the pages listAllSignatureDevices reads.
+var unpaginatedPageSize = utils.MaxPageSize
+
+// listAllSignatureDevices lists the devices matching the query in a single
+// page by following the pages to the last. The read is deliberately
+// unbounded, v0 clients expect every device and have no way to ask for more;
+// it holds no lock between pages and its response grows with the tenant.
+func (s *Server) listAllSignatureDevices(ctx context.Context, principal *domain.Principal, tenantID string, query domain.DeviceQuery) (*domain.DevicePage, error) {
+	query.Limit = unpaginatedPageSize
+	all := &domain.DevicePage{Devices: []*domain.SignatureDevice{}}
+	for {
+		page, err := s.signatureDeviceService.ListSignatureDevices(ctx, principal, tenantID, query)
+		if err != nil {
+			return nil, err
+		}
+		all.Devices = append(all.Devices, page.Devices...)
+		if page.NextCursor == "" {
+			return all, nil
+		}
+		query.Cursor = page.NextCursor
+	}
 }
 
+// SignTransaction signs data with the device named in the body of the
+// request. It serves the v0 API; v1 signs at the device with CreateSignature.
 func (s *Server) SignTransaction(response http.ResponseWriter, request *http.Request) {
 	var signatureRequest domain.SignTransactionRequest
-	err := json.NewDecoder(request.Body).Decode(&signatureRequest)
+	err := s.decodeRequest(response, request, &signatureRequest)
+	if err != nil {
+		WriteMalformedRequest(response, request, err)
+		return
+	}
+	errs := validateTransactionSignatureRequest(&signatureRequest)
+	if len(errs) > 0 {
+		WriteValidationErrors(response, request, errs)
+		return
+	}
+	logAttrs(request, slog.String("device_id", signatureRequest.ID))
+	s.signTransaction(response, request, http.StatusOK, &signatureRequest)
+}
+
+// CreateSignature signs the data of the body of the request with the device
+// of the path and answers with 201 Created.
+func (s *Server) CreateSignature(response http.ResponseWriter, request *http.Request) {
+	id, valid := deviceID(request)
+	if !valid {
+		HandleError(response, request, utils.ErrInvalidDeviceId)
+		return
+	}
+	var signatureRequest domain.SignTransactionRequest
+	err := s.decodeRequest(response, request, &signatureRequest)
 	if err != nil {
-		WriteErrorResponse(response, http.StatusUnprocessableEntity, []string{
-			http.StatusText(http.StatusUnprocessableEntity),
-		})
+		WriteMalformedRequest(response, request, err)
 		return
 	}
+	signatureRequest.ID = id
 	errs := validateTransactionSignatureRequest(&signatureRequest)
 	if len(errs) > 0 {
-		WriteErrorResponse(response, http.StatusBadRequest, errs)
+		WriteValidationErrors(response, request, errs)
 		return
 	}
-	signatureData, err := s.signatureDeviceService.SignTransaction(signatureRequest.ID, signatureRequest.Data)
+	s.signTransaction(response, request, http.StatusCreated, &signatureRequest)
+}
+
+func (s *Server) signTransaction(response http.ResponseWriter, request *http.Request, code int, signatureRequest *domain.SignTransactionRequest) {
+	signatureData, err := s.signatureDeviceService.SignTransaction(request.Context(), principalFromRequest(request), requestTenant(request), signatureRequest.ID, signatureRequest.Data)
 	if err != nil {
-		HandleError(response, err)
+		HandleError(response, request, err)
 		return
 	}
 
-	WriteAPIResponse(response, http.StatusOK, signatureData)
+	WriteAPIResponse(response, code, signatureData)
 }
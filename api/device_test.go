@@ -2,21 +2,31 @@ package api
 
 import (
 	"bytes"
+	"cmp"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/crypto"
 	"github.com/uwemakan/signing-service/domain"
 	"github.com/uwemakan/signing-service/utils"
 )
 
-func TestHandler(t *testing.T) {
+func TestSignatureDevicesMethodNotAllowed(t *testing.T) {
 	requires := require.New(t)
 	server := NewServer(config)
 	recorder := httptest.NewRecorder()
@@ -26,7 +36,8 @@ func TestHandler(t *testing.T) {
 	request, err := http.NewRequest(http.MethodPut, url, nil)
 	requires.NoError(err)
 
-	server.Handler(recorder, request)
+	serve(t, server.Routes(), recorder, request)
+	requires.Equal(http.StatusMethodNotAllowed, recorder.Code)
 }
 
 func TestCreateSignatureDevice(t *testing.T) {
@@ -34,6 +45,7 @@ func TestCreateSignatureDevice(t *testing.T) {
 	id, _ := uuid.NewRandom()
 	testCases := []struct {
 		name          string
+		url           string
 		request       any
 		setup         func(*Server)
 		checkResponse func(*httptest.ResponseRecorder)
@@ -75,11 +87,53 @@ func TestCreateSignatureDevice(t *testing.T) {
 				body, err := io.ReadAll(rr.Body)
 				requires.NoError(err)
 				requires.NotNil(body)
-				var response ErrorResponse
-				err = json.Unmarshal(body, &response)
-				requires.NoError(err)
-				requires.NotEmpty(response.Errors)
-				requires.Equal(response.Errors[0], http.StatusText(http.StatusUnprocessableEntity))
+				requires.Equal(utils.ErrorCode(utils.ErrMalformedRequest), decodeProblem(t, body).Code)
+			},
+		},
+		{
+			name: "CreateSignatureDevice_UNKNOWN_FIELD_V0",
+			url:  "/api/v0/signature-devices",
+			request: map[string]string{
+				"id":        id.String(),
+				"algorithm": utils.Algorithms[0],
+				"labels":    "till-1",
+			},
+			setup: func(s *Server) {},
+			checkResponse: func(rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusCreated, rr.Code)
+			},
+		},
+		{
+			name: "CreateSignatureDevice_UNKNOWN_FIELD",
+			url:  "/api/v1/signature-devices",
+			request: map[string]string{
+				"id":        id.String(),
+				"algorithm": utils.Algorithms[0],
+				"labels":    "till-1",
+			},
+			setup: func(s *Server) {},
+			checkResponse: func(rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusUnprocessableEntity, rr.Code)
+
+				problem := decodeProblem(t, rr.Body.Bytes())
+				requires.Equal(utils.ErrorCode(utils.ErrMalformedRequest), problem.Code)
+				requires.Contains(problem.Detail, `unknown field "labels"`)
+			},
+		},
+		{
+			name: "CreateSignatureDevice_TOO_LARGE",
+			request: map[string]string{
+				"id":        id.String(),
+				"algorithm": utils.Algorithms[0],
+				"label":     strings.Repeat("a", maxRequestBodySize),
+			},
+			setup: func(s *Server) {},
+			checkResponse: func(rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusUnprocessableEntity, rr.Code)
+
+				problem := decodeProblem(t, rr.Body.Bytes())
+				requires.Equal(utils.ErrorCode(utils.ErrMalformedRequest), problem.Code)
+				requires.Contains(problem.Detail, "request body too large")
 			},
 		},
 		{
@@ -92,12 +146,10 @@ func TestCreateSignatureDevice(t *testing.T) {
 				body, err := io.ReadAll(rr.Body)
 				requires.NoError(err)
 				requires.NotNil(body)
-				var response ErrorResponse
-				err = json.Unmarshal(body, &response)
-				requires.NoError(err)
-				requires.Len(response.Errors, 2)
-				requires.Contains(response.Errors, fmt.Sprintf("invalid device id: %s is not a valid UUID", ""))
-				requires.Contains(response.Errors, fmt.Sprintf("algorithm must be one of %s", utils.Algorithms))
+				messages := problemMessages(t, body)
+				requires.Len(messages, 2)
+				requires.Contains(messages, fmt.Sprintf("invalid device id: %s is not a valid UUID", ""))
+				requires.Contains(messages, fmt.Sprintf("algorithm must be one of %s", utils.Algorithms))
 			},
 		},
 		{
@@ -119,7 +171,7 @@ func TestCreateSignatureDevice(t *testing.T) {
 				request, err := http.NewRequest(http.MethodPost, url, body)
 				requires.NoError(err)
 				recorder := httptest.NewRecorder()
-				s.Handler(recorder, request)
+				serve(t, s.Routes(), recorder, request)
 			},
 			checkResponse: func(rr *httptest.ResponseRecorder) {
 				requires.Equal(http.StatusBadRequest, rr.Code)
@@ -127,11 +179,9 @@ func TestCreateSignatureDevice(t *testing.T) {
 				body, err := io.ReadAll(rr.Body)
 				requires.NoError(err)
 				requires.NotNil(body)
-				var response ErrorResponse
-				err = json.Unmarshal(body, &response)
-				requires.NoError(err)
-				requires.NotEmpty(response.Errors)
-				requires.Equal(response.Errors[0], utils.ErrDeviceAlreadyExists.Error())
+				messages := problemMessages(t, body)
+				requires.NotEmpty(messages)
+				requires.Equal(messages[0], utils.ErrDeviceAlreadyExists.Error())
 			},
 		},
 	}
@@ -144,13 +194,13 @@ func TestCreateSignatureDevice(t *testing.T) {
 			b, err := json.Marshal(tc.request)
 			requires.NoError(err)
 
-			url := "/api/v0/signature-devices"
+			url := cmp.Or(tc.url, "/api/v0/signature-devices")
 			body := bytes.NewReader(b)
 
 			request, err := http.NewRequest(http.MethodPost, url, body)
 			requires.NoError(err)
 
-			server.Handler(recorder, request)
+			serve(t, server.Routes(), recorder, request)
 			tc.checkResponse(recorder)
 		})
 	}
@@ -199,7 +249,7 @@ func TestListSignatureDevices(t *testing.T) {
 				request, err := http.NewRequest(http.MethodPost, url, body)
 				requires.NoError(err)
 				recorder := httptest.NewRecorder()
-				s.Handler(recorder, request)
+				serve(t, s.Routes(), recorder, request)
 			},
 			checkResponse: func(rr *httptest.ResponseRecorder) {
 				requires.Equal(http.StatusOK, rr.Code)
@@ -230,12 +280,135 @@ func TestListSignatureDevices(t *testing.T) {
 			request, err := http.NewRequest(http.MethodGet, url, nil)
 			requires.NoError(err)
 
-			server.Handler(recorder, request)
+			serve(t, server.Routes(), recorder, request)
 			tc.checkResponse(recorder)
 		})
 	}
 }
 
+func TestListSignatureDevicesQuery(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(config).Routes()
+	for i, algorithm := range []string{"RSA", "ECC", "ECC"} {
+		id, _ := uuid.NewRandom()
+		label := fmt.Sprintf("till-%d", i)
+		rr := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", domain.SignatureDeviceRequest{
+			ID:        id.String(),
+			Algorithm: algorithm,
+			Label:     &label,
+			Metadata:  map[string]string{"site": fmt.Sprintf("store-%d", i%2)},
+		})
+		requires.Equal(http.StatusCreated, rr.Code)
+	}
+	list := func(url string) ([]domain.SignatureDevice, string) {
+		rr := serveWithAPIKey(t, handler, http.MethodGet, url, "", nil)
+		requires.Equal(http.StatusOK, rr.Code, rr.Body.String())
+		var response struct {
+			Data       []domain.SignatureDevice `json:"data"`
+			Pagination *Pagination              `json:"pagination"`
+		}
+		requires.NoError(json.Unmarshal(rr.Body.Bytes(), &response))
+		if response.Pagination == nil {
+			return response.Data, ""
+		}
+		requires.NotEmpty(response.Pagination.NextCursor)
+		return response.Data, response.Pagination.NextCursor
+	}
+
+	devices, nextCursor := list("/api/v0/signature-devices?algorithm=ECC&labelPrefix=till-&metadata.site=store-0")
+	requires.Len(devices, 1)
+	requires.Equal("till-2", devices[0].Label)
+	requires.Empty(nextCursor)
+
+	devices, nextCursor = list("/api/v0/signature-devices?sort=created&order=desc&limit=2")
+	requires.Len(devices, 2)
+	requires.Equal("till-2", devices[0].Label)
+	requires.Equal("till-1", devices[1].Label)
+	requires.NotEmpty(nextCursor)
+	devices, nextCursor = list("/api/v0/signature-devices?sort=created&order=desc&limit=2&cursor=" + url.QueryEscape(nextCursor))
+	requires.Len(devices, 1)
+	requires.Equal("till-0", devices[0].Label)
+	requires.Empty(nextCursor)
+
+	devices, _ = list("/api/v0/signature-devices?status=suspended")
+	requires.Empty(devices)
+
+	devices, _ = list("/api/v0/signature-devices?sort=updated")
+	requires.Len(devices, 3)
+	for _, device := range devices {
+		requires.False(device.CreatedAt.IsZero())
+		requires.Equal(device.CreatedAt, device.UpdatedAt)
+		requires.Nil(device.LastSignedAt)
+	}
+	devices, _ = list("/api/v0/signature-devices?createdAfter=" + url.QueryEscape(devices[0].CreatedAt.Add(-time.Hour).Format(time.RFC3339)))
+	requires.Len(devices, 3)
+	devices, _ = list("/api/v0/signature-devices?lastSignedAfter=2000-01-01T00:00:00Z")
+	requires.Empty(devices)
+
+	for _, query := range []string{
+		"algorithm=DSA",
+		"status=deleted",
+		"sort=label",
+		"order=up",
+		"limit=0",
+		"limit=1001",
+		"metadata.bad%20key=x",
+		"cursor=not-a-cursor",
+		"createdAfter=yesterday",
+		"lastSignedBefore=2024-01-01",
+	} {
+		rr := serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices?"+query, "", nil)
+		requires.Equal(http.StatusBadRequest, rr.Code, query)
+	}
+}
+
+func TestListSignatureDevicesUnpaginated(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(config).Routes()
+	for range utils.DefaultPageSize + 1 {
+		rr := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", domain.SignatureDeviceRequest{
+			ID:        uuid.NewString(),
+			Algorithm: "ECC",
+		})
+		requires.Equal(http.StatusCreated, rr.Code)
+	}
+	list := func(url string) ([]domain.SignatureDevice, string) {
+		rr := serveWithAPIKey(t, handler, http.MethodGet, url, "", nil)
+		requires.Equal(http.StatusOK, rr.Code, rr.Body.String())
+		var response struct {
+			Data       []domain.SignatureDevice `json:"data"`
+			Pagination *Pagination              `json:"pagination"`
+		}
+		requires.NoError(json.Unmarshal(rr.Body.Bytes(), &response))
+		if response.Pagination == nil {
+			return response.Data, ""
+		}
+		requires.NotEmpty(response.Pagination.NextCursor)
+		return response.Data, response.Pagination.NextCursor
+	}
+
+	// v0 clients that don't know about pagination get every device, however
+	// many pages it takes to read them.
+	devices, nextCursor := list("/api/v0/signature-devices")
+	requires.Len(devices, utils.DefaultPageSize+1)
+	requires.Empty(nextCursor)
+	defer func(pageSize int) { unpaginatedPageSize = pageSize }(unpaginatedPageSize)
+	unpaginatedPageSize = 7
+	devices, nextCursor = list("/api/v0/signature-devices")
+	requires.Len(devices, utils.DefaultPageSize+1)
+	requires.Empty(nextCursor)
+
+	devices, nextCursor = list("/api/v0/signature-devices?limit=100")
+	requires.Len(devices, 100)
+	requires.NotEmpty(nextCursor)
+
+	devices, nextCursor = list("/api/v1/signature-devices")
+	requires.Len(devices, utils.DefaultPageSize)
+	devices, nextCursor = list("/api/v1/signature-devices?cursor=" + url.QueryEscape(nextCursor))
+	requires.Len(devices, 1)
+	requires.Empty(nextCursor)
+}
+
 func TestGetSignatureDevice(t *testing.T) {
 	requires := require.New(t)
 	id, _ := uuid.NewRandom()
@@ -261,7 +434,7 @@ func TestGetSignatureDevice(t *testing.T) {
 				request, err := http.NewRequest(http.MethodPost, url, body)
 				requires.NoError(err)
 				recorder := httptest.NewRecorder()
-				s.Handler(recorder, request)
+				serve(t, s.Routes(), recorder, request)
 			},
 			checkResponse: func(rr *httptest.ResponseRecorder) {
 				requires.Equal(http.StatusOK, rr.Code)
@@ -293,11 +466,9 @@ func TestGetSignatureDevice(t *testing.T) {
 				body, err := io.ReadAll(rr.Body)
 				requires.NoError(err)
 				requires.NotNil(body)
-				var response ErrorResponse
-				err = json.Unmarshal(body, &response)
-				requires.NoError(err)
-				requires.Len(response.Errors, 1)
-				requires.Equal(response.Errors[0], utils.ErrDeviceNotFound.Error())
+				messages := problemMessages(t, body)
+				requires.Len(messages, 1)
+				requires.Equal(messages[0], utils.ErrDeviceNotFound.Error())
 			},
 		},
 		{
@@ -310,11 +481,9 @@ func TestGetSignatureDevice(t *testing.T) {
 				body, err := io.ReadAll(rr.Body)
 				requires.NoError(err)
 				requires.NotNil(body)
-				var response ErrorResponse
-				err = json.Unmarshal(body, &response)
-				requires.NoError(err)
-				requires.Len(response.Errors, 1)
-				requires.Equal(response.Errors[0], "device ID must be a valid UUID")
+				messages := problemMessages(t, body)
+				requires.Len(messages, 1)
+				requires.Equal(messages[0], "device ID must be a valid UUID")
 			},
 		},
 	}
@@ -329,7 +498,7 @@ func TestGetSignatureDevice(t *testing.T) {
 			request, err := http.NewRequest(http.MethodGet, url, nil)
 			requires.NoError(err)
 
-			server.GetSignatureDevice(recorder, request)
+			serve(t, server.Routes(), recorder, request)
 			tc.checkResponse(recorder)
 		})
 	}
@@ -365,7 +534,7 @@ func TestSignTransaction(t *testing.T) {
 				request, err := http.NewRequest(http.MethodPost, url, body)
 				requires.NoError(err)
 				recorder := httptest.NewRecorder()
-				s.Handler(recorder, request)
+				serve(t, s.Routes(), recorder, request)
 			},
 			checkResponse: func(rr *httptest.ResponseRecorder) {
 				requires.Equal(http.StatusOK, rr.Code)
@@ -395,11 +564,7 @@ func TestSignTransaction(t *testing.T) {
 				body, err := io.ReadAll(rr.Body)
 				requires.NoError(err)
 				requires.NotNil(body)
-				var response ErrorResponse
-				err = json.Unmarshal(body, &response)
-				requires.NoError(err)
-				requires.NotEmpty(response.Errors)
-				requires.Equal(response.Errors[0], http.StatusText(http.StatusUnprocessableEntity))
+				requires.Equal(utils.ErrorCode(utils.ErrMalformedRequest), decodeProblem(t, body).Code)
 			},
 		},
 		{
@@ -412,12 +577,10 @@ func TestSignTransaction(t *testing.T) {
 				body, err := io.ReadAll(rr.Body)
 				requires.NoError(err)
 				requires.NotNil(body)
-				var response ErrorResponse
-				err = json.Unmarshal(body, &response)
-				requires.NoError(err)
-				requires.Len(response.Errors, 2)
-				requires.Contains(response.Errors, fmt.Sprintf("invalid device id: %s is not a valid UUID", ""))
-				requires.Contains(response.Errors, "invalid data: data must be in the format signatureCounter_data_lastSignature")
+				messages := problemMessages(t, body)
+				requires.Len(messages, 2)
+				requires.Contains(messages, fmt.Sprintf("invalid device id: %s is not a valid UUID", ""))
+				requires.Contains(messages, "invalid data: data must be in the format signatureCounter_data_lastSignature")
 			},
 		},
 		{
@@ -439,7 +602,7 @@ func TestSignTransaction(t *testing.T) {
 				request, err := http.NewRequest(http.MethodPost, url, body)
 				requires.NoError(err)
 				recorder := httptest.NewRecorder()
-				s.Handler(recorder, request)
+				serve(t, s.Routes(), recorder, request)
 			},
 			checkResponse: func(rr *httptest.ResponseRecorder) {
 				requires.Equal(http.StatusNotFound, rr.Code)
@@ -447,11 +610,9 @@ func TestSignTransaction(t *testing.T) {
 				body, err := io.ReadAll(rr.Body)
 				requires.NoError(err)
 				requires.NotNil(body)
-				var response ErrorResponse
-				err = json.Unmarshal(body, &response)
-				requires.NoError(err)
-				requires.NotEmpty(response.Errors)
-				requires.Equal(response.Errors[0], utils.ErrDeviceNotFound.Error())
+				messages := problemMessages(t, body)
+				requires.NotEmpty(messages)
+				requires.Equal(messages[0], utils.ErrDeviceNotFound.Error())
 			},
 		},
 	}
@@ -470,8 +631,467 @@ func TestSignTransaction(t *testing.T) {
 			request, err := http.NewRequest(http.MethodPost, url, body)
 			requires.NoError(err)
 
-			server.SignTransaction(recorder, request)
+			serve(t, http.HandlerFunc(server.SignTransaction), recorder, request)
 			tc.checkResponse(recorder)
 		})
 	}
 }
+
+func TestUpdateSignatureDevice(t *testing.T) {
+	requires := require.New(t)
+	status := func(s string) *string { return &s }
+	createDevice := func(handler http.Handler, id string) {
+		recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{
+			ID:        id,
+			Algorithm: utils.Algorithms[1],
+		})
+		requires.Equal(http.StatusCreated, recorder.Code)
+	}
+	sign := func(handler http.Handler, id string) *httptest.ResponseRecorder {
+		return serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "", &domain.SignTransactionRequest{
+			ID:   id,
+			Data: fmt.Sprintf("0_TESTDATA_%s", base64.StdEncoding.EncodeToString([]byte(id))),
+		})
+	}
+	decodeDevice := func(rr *httptest.ResponseRecorder) domain.SignatureDevice {
+		var response Response
+		requires.NoError(json.Unmarshal(rr.Body.Bytes(), &response))
+		b, err := json.Marshal(response.Data)
+		requires.NoError(err)
+		var device domain.SignatureDevice
+		requires.NoError(json.Unmarshal(b, &device))
+		return device
+	}
+	decodeErrors := func(rr *httptest.ResponseRecorder) []string {
+		return problemMessages(t, rr.Body.Bytes())
+	}
+
+	testCases := []struct {
+		name          string
+		id            string
+		request       any
+		setup         func(handler http.Handler, id string)
+		checkResponse func(handler http.Handler, id string, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "UpdateSignatureDevice_Suspend",
+			id:      uuid.NewString(),
+			request: &domain.UpdateSignatureDeviceRequest{Status: status(utils.DeviceStatusSuspended)},
+			setup:   createDevice,
+			checkResponse: func(handler http.Handler, id string, rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusOK, rr.Code)
+				requires.Equal(utils.DeviceStatusSuspended, decodeDevice(rr).Status)
+
+				recorder := sign(handler, id)
+				requires.Equal(http.StatusConflict, recorder.Code)
+				requires.Equal([]string{utils.ErrDeviceNotActive.Error()}, decodeErrors(recorder))
+			},
+		},
+		{
+			name:    "UpdateSignatureDevice_Reactivate",
+			id:      uuid.NewString(),
+			request: &domain.UpdateSignatureDeviceRequest{Status: status(utils.DeviceStatusActive)},
+			setup: func(handler http.Handler, id string) {
+				createDevice(handler, id)
+				recorder := serveWithAPIKey(t, handler, http.MethodPatch, "/api/v0/signature-devices/"+id, "", &domain.UpdateSignatureDeviceRequest{
+					Status: status(utils.DeviceStatusSuspended),
+				})
+				requires.Equal(http.StatusOK, recorder.Code)
+			},
+			checkResponse: func(handler http.Handler, id string, rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusOK, rr.Code)
+				requires.Equal(utils.DeviceStatusActive, decodeDevice(rr).Status)
+				requires.Equal(http.StatusOK, sign(handler, id).Code)
+			},
+		},
+		{
+			name:    "UpdateSignatureDevice_Decommission",
+			id:      uuid.NewString(),
+			request: &domain.UpdateSignatureDeviceRequest{Status: status(utils.DeviceStatusDecommissioned)},
+			setup:   createDevice,
+			checkResponse: func(handler http.Handler, id string, rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusOK, rr.Code)
+				requires.Equal(utils.DeviceStatusDecommissioned, decodeDevice(rr).Status)
+				requires.Equal(http.StatusConflict, sign(handler, id).Code)
+
+				// The device stays available for verification but can't come back.
+				recorder := serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices/"+id, "", nil)
+				requires.Equal(http.StatusOK, recorder.Code)
+				recorder = serveWithAPIKey(t, handler, http.MethodPatch, "/api/v0/signature-devices/"+id, "", &domain.UpdateSignatureDeviceRequest{
+					Status: status(utils.DeviceStatusActive),
+				})
+				requires.Equal(http.StatusConflict, recorder.Code)
+				requires.Equal([]string{utils.ErrInvalidStatusTransition.Error()}, decodeErrors(recorder))
+			},
+		},
+		{
+			name:    "UpdateSignatureDevice_BAD_REQUEST",
+			id:      uuid.NewString(),
+			request: &domain.UpdateSignatureDeviceRequest{Status: status("retired")},
+			setup:   createDevice,
+			checkResponse: func(handler http.Handler, id string, rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusBadRequest, rr.Code)
+				requires.Equal([]string{fmt.Sprintf("status must be one of %s", utils.DeviceStatuses)}, decodeErrors(rr))
+			},
+		},
+		{
+			name:    "UpdateSignatureDevice_Invalid_Id",
+			id:      utils.RandomString(12),
+			request: &domain.UpdateSignatureDeviceRequest{Status: status(utils.DeviceStatusSuspended)},
+			setup:   func(handler http.Handler, id string) {},
+			checkResponse: func(handler http.Handler, id string, rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusBadRequest, rr.Code)
+				requires.Equal([]string{utils.ErrInvalidDeviceId.Error()}, decodeErrors(rr))
+			},
+		},
+		{
+			name:    "UpdateSignatureDevice_NOT_FOUND",
+			id:      uuid.NewString(),
+			request: &domain.UpdateSignatureDeviceRequest{Status: status(utils.DeviceStatusSuspended)},
+			setup:   func(handler http.Handler, id string) {},
+			checkResponse: func(handler http.Handler, id string, rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusNotFound, rr.Code)
+				requires.Equal([]string{utils.ErrDeviceNotFound.Error()}, decodeErrors(rr))
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewServer(config).Routes()
+			tc.setup(handler, tc.id)
+			recorder := serveWithAPIKey(t, handler, http.MethodPatch, "/api/v0/signature-devices/"+tc.id, "", tc.request)
+			tc.checkResponse(handler, tc.id, recorder)
+		})
+	}
+}
+
+func TestRotateDeviceKey(t *testing.T) {
+	requires := require.New(t)
+	id := uuid.NewString()
+
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		checkResponse func(handler http.Handler, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "RotateDeviceKey_OK",
+			method: http.MethodPost,
+			url:    "/api/v0/signature-devices/" + id + "/rotate-key",
+			checkResponse: func(handler http.Handler, rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusOK, rr.Code)
+				var response Response
+				requires.NoError(json.Unmarshal(rr.Body.Bytes(), &response))
+				b, err := json.Marshal(response.Data)
+				requires.NoError(err)
+				var rotation domain.KeyRotation
+				requires.NoError(json.Unmarshal(b, &rotation))
+				requires.Equal(id, rotation.DeviceID)
+				requires.Equal(2, rotation.KeyVersion)
+				requires.NotEqual(rotation.PreviousPublicKey, rotation.PublicKey)
+				requires.NotEmpty(rotation.Signature)
+
+				recorder := serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices/"+id, "", nil)
+				requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+				b, err = json.Marshal(response.Data)
+				requires.NoError(err)
+				var device domain.SignatureDevice
+				requires.NoError(json.Unmarshal(b, &device))
+				requires.Equal(2, device.KeyVersion)
+				requires.Equal(1, device.SignatureCounter)
+				requires.Equal(rotation.Signature, device.LastSignature)
+				requires.Equal([]domain.DeviceKey{{Version: 1, PublicKey: rotation.PreviousPublicKey}}, device.KeyHistory)
+			},
+		},
+		{
+			name:   "RotateDeviceKey_Tenant_Route",
+			method: http.MethodPost,
+			url:    "/api/v1/tenants/default/signature-devices/" + id + "/rotate-key",
+			checkResponse: func(handler http.Handler, rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusOK, rr.Code)
+			},
+		},
+		{
+			name:   "RotateDeviceKey_NOT_FOUND",
+			method: http.MethodPost,
+			url:    "/api/v0/signature-devices/" + uuid.NewString() + "/rotate-key",
+			checkResponse: func(handler http.Handler, rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusNotFound, rr.Code)
+			},
+		},
+		{
+			name:   "RotateDeviceKey_BAD_REQUEST",
+			method: http.MethodPost,
+			url:    "/api/v0/signature-devices/" + utils.RandomString(12) + "/rotate-key",
+			checkResponse: func(handler http.Handler, rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusBadRequest, rr.Code)
+			},
+		},
+		{
+			name:   "RotateDeviceKey_METHOD_NOT_ALLOWED",
+			method: http.MethodGet,
+			url:    "/api/v0/signature-devices/" + id + "/rotate-key",
+			checkResponse: func(handler http.Handler, rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusMethodNotAllowed, rr.Code)
+			},
+		},
+		{
+			name:   "RotateDeviceKey_Unknown_Action",
+			method: http.MethodPost,
+			url:    "/api/v0/signature-devices/" + id + "/rotate",
+			checkResponse: func(handler http.Handler, rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusNotFound, rr.Code)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewServer(config).Routes()
+			recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{
+				ID:        id,
+				Algorithm: utils.Algorithms[1],
+			})
+			requires.Equal(http.StatusCreated, recorder.Code)
+
+			recorder = serveWithAPIKey(t, handler, tc.method, tc.url, "", nil)
+			tc.checkResponse(handler, recorder)
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(config).Routes()
+	id := uuid.NewString()
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{
+		ID:        id,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "", &domain.SignTransactionRequest{
+		ID:   id,
+		Data: "0_TESTDATA_" + base64.StdEncoding.EncodeToString([]byte(id)),
+	})
+	requires.Equal(http.StatusOK, recorder.Code)
+	var response Response
+	requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	b, err := json.Marshal(response.Data)
+	requires.NoError(err)
+	var signed domain.SignTransactionResponse
+	requires.NoError(json.Unmarshal(b, &signed))
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/"+id+"/rotate-key", "", nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	b, err = json.Marshal(response.Data)
+	requires.NoError(err)
+	var rotation domain.KeyRotation
+	requires.NoError(json.Unmarshal(b, &rotation))
+
+	testCases := []struct {
+		name    string
+		url     string
+		request *domain.VerifySignatureRequest
+		code    int
+		result  domain.SignatureVerification
+	}{
+		{
+			name:    "VerifySignature_Retired_Key",
+			url:     "/api/v0/signature-devices/" + id + "/verify",
+			request: &domain.VerifySignatureRequest{SignedData: signed.SignedData, Signature: signed.Signature},
+			code:    http.StatusOK,
+			result:  domain.SignatureVerification{Valid: true, KeyVersion: 1},
+		},
+		{
+			name:    "VerifySignature_Key_Rotation",
+			url:     "/api/v1/signature-devices/" + id + "/verify",
+			request: &domain.VerifySignatureRequest{SignedData: rotation.SignedData, Signature: rotation.Signature},
+			code:    http.StatusOK,
+			result:  domain.SignatureVerification{Valid: true, KeyVersion: 1},
+		},
+		{
+			name:    "VerifySignature_Tampered",
+			url:     "/api/v1/tenants/default/signature-devices/" + id + "/verify",
+			request: &domain.VerifySignatureRequest{SignedData: "0_OTHERDATA_" + base64.StdEncoding.EncodeToString([]byte(id)), Signature: signed.Signature},
+			code:    http.StatusOK,
+			result:  domain.SignatureVerification{Valid: false},
+		},
+		{
+			name:    "VerifySignature_Invalid_Request",
+			url:     "/api/v0/signature-devices/" + id + "/verify",
+			request: &domain.VerifySignatureRequest{SignedData: "data"},
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:    "VerifySignature_NOT_FOUND",
+			url:     "/api/v0/signature-devices/" + uuid.NewString() + "/verify",
+			request: &domain.VerifySignatureRequest{SignedData: signed.SignedData, Signature: signed.Signature},
+			code:    http.StatusNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := serveWithAPIKey(t, handler, http.MethodPost, tc.url, "", tc.request)
+			requires.Equal(tc.code, recorder.Code)
+			if tc.code != http.StatusOK {
+				return
+			}
+			var response Response
+			requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+			b, err := json.Marshal(response.Data)
+			requires.NoError(err)
+			var verification domain.SignatureVerification
+			requires.NoError(json.Unmarshal(b, &verification))
+			requires.Equal(tc.result, verification)
+		})
+	}
+}
+
+func TestCreateSignatureDeviceImport(t *testing.T) {
+	requires := require.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	requires.NoError(err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	requires.NoError(err)
+	privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	wrappedPrivateKey, err := crypto.EncryptAES([]byte(privateKey), config.AESKey)
+	requires.NoError(err)
+
+	testCases := []struct {
+		name    string
+		request *domain.SignatureDeviceRequest
+		code    int
+		errors  []string
+	}{
+		{
+			name:    "Import_PrivateKey",
+			request: &domain.SignatureDeviceRequest{ID: uuid.NewString(), Algorithm: "ECC", PrivateKey: &privateKey},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "Import_WrappedPrivateKey",
+			request: &domain.SignatureDeviceRequest{ID: uuid.NewString(), Algorithm: "ECC", WrappedPrivateKey: &wrappedPrivateKey},
+			code:    http.StatusCreated,
+		},
+		{
+			name:    "Import_Algorithm_Mismatch",
+			request: &domain.SignatureDeviceRequest{ID: uuid.NewString(), Algorithm: "RSA", PrivateKey: &privateKey},
+			code:    http.StatusBadRequest,
+			errors:  []string{utils.ErrKeyAlgorithmMismatch.Error()},
+		},
+		{
+			name:    "Import_Both_Keys",
+			request: &domain.SignatureDeviceRequest{ID: uuid.NewString(), Algorithm: "ECC", PrivateKey: &privateKey, WrappedPrivateKey: &wrappedPrivateKey},
+			code:    http.StatusBadRequest,
+			errors:  []string{"only one of privateKey and wrappedPrivateKey may be set"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewServer(config).Routes()
+			recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", tc.request)
+			requires.Equal(tc.code, recorder.Code)
+			// The imported key is never echoed back.
+			requires.NotContains(recorder.Body.String(), "PRIVATE KEY")
+			requires.NotContains(recorder.Body.String(), wrappedPrivateKey)
+			if tc.errors != nil {
+				requires.Equal(tc.errors, problemMessages(t, recorder.Body.Bytes()))
+				return
+			}
+
+			recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "", &domain.SignTransactionRequest{
+				ID:   tc.request.ID,
+				Data: fmt.Sprintf("0_TESTDATA_%s", base64.StdEncoding.EncodeToString([]byte(tc.request.ID))),
+			})
+			requires.Equal(http.StatusOK, recorder.Code)
+		})
+	}
+}
+
+func TestUpdateSignatureDeviceDetails(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(config).Routes()
+	id := uuid.NewString()
+	value := func(v string) *string { return &v }
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{
+		ID:        id,
+		Algorithm: utils.Algorithms[1],
+		Metadata:  map[string]string{"store": "berlin-1"},
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+
+	recorder = serveWithAPIKey(t, handler, http.MethodPatch, "/api/v0/signature-devices/"+id, "", &domain.UpdateSignatureDeviceRequest{
+		Label:    value("till 1"),
+		Metadata: map[string]*string{"store": nil, "serial": value("SN-1")},
+	})
+	requires.Equal(http.StatusOK, recorder.Code)
+	var response Response
+	requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	b, err := json.Marshal(response.Data)
+	requires.NoError(err)
+	var device domain.SignatureDevice
+	requires.NoError(json.Unmarshal(b, &device))
+	requires.Equal("till 1", device.Label)
+	requires.Equal(map[string]string{"serial": "SN-1"}, device.Metadata)
+	requires.Equal(utils.DeviceStatusActive, device.Status)
+
+	recorder = serveWithAPIKey(t, handler, http.MethodPatch, "/api/v0/signature-devices/"+id, "", &domain.UpdateSignatureDeviceRequest{
+		Metadata: map[string]*string{"serial": value(strings.Repeat("x", utils.MaxMetadataValueLength+1))},
+	})
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodPatch, "/api/v0/signature-devices/"+id, "", &domain.UpdateSignatureDeviceRequest{})
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+}
+
+func TestSignTransactionLimits(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(config).Routes()
+	id := uuid.NewString()
+	maxSignatures := 1
+	notAfter := time.Now().Add(time.Hour)
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{
+		ID:            id,
+		Algorithm:     utils.Algorithms[1],
+		MaxSignatures: &maxSignatures,
+		NotAfter:      &notAfter,
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+	remainingSignatures := func() any {
+		recorder := serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices/"+id, "", nil)
+		requires.Equal(http.StatusOK, recorder.Code)
+		var response struct {
+			Data map[string]any `json:"data"`
+		}
+		requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+		return response.Data["remainingSignatures"]
+	}
+	requires.EqualValues(1, remainingSignatures())
+
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "", signRequest(t, handler, id))
+	requires.Equal(http.StatusOK, recorder.Code)
+	requires.EqualValues(0, remainingSignatures())
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "", signRequest(t, handler, id))
+	requires.Equal(http.StatusConflict, recorder.Code)
+	requires.Contains(recorder.Body.String(), utils.ErrSignatureQuotaExhausted.Error())
+
+	expired := time.Now().Add(-time.Minute)
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{
+		ID:        uuid.NewString(),
+		Algorithm: utils.Algorithms[1],
+		NotAfter:  &expired,
+	})
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+	zero := 0
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{
+		ID:            uuid.NewString(),
+		Algorithm:     utils.Algorithms[1],
+		MaxSignatures: &zero,
+	})
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	HandleError(recorder, httptest.NewRequest(http.MethodPost, "/api/v0/signature-devices/sign", nil), utils.ErrDeviceExpired)
+	requires.Equal(http.StatusGone, recorder.Code)
+}
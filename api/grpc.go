@@ -0,0 +1,327 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	signingv1 "github.com/uwemakan/signing-service/proto/signing/v1"
+	"github.com/uwemakan/signing-service/tracing"
+	"github.com/uwemakan/signing-service/utils"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// rpcErrorDomain is the domain of the google.rpc.ErrorInfo details of errors
+// of the gRPC API.
+const rpcErrorDomain = "signing-service"
+
+// rpcScopes are the scopes required by the methods of the gRPC API.
+var rpcScopes = map[string]string{
+	signingv1.SignatureService_CreateDevice_FullMethodName:    utils.ScopeDevicesWrite,
+	signingv1.SignatureService_GetDevice_FullMethodName:       utils.ScopeDevicesRead,
+	signingv1.SignatureService_ListDevices_FullMethodName:     utils.ScopeDevicesRead,
+	signingv1.SignatureService_SignTransaction_FullMethodName: utils.ScopeTransactionsSign,
+	signingv1.SignatureService_VerifySignature_FullMethodName: utils.ScopeDevicesRead,
+}
+
+// kindCodes are the gRPC status codes errors are answered with by kind.
+// Errors of other kinds are internal errors.
+var kindCodes = map[utils.ErrorKind]codes.Code{
+	utils.KindInvalid:          codes.InvalidArgument,
+	utils.KindUnprocessable:    codes.InvalidArgument,
+	utils.KindUnauthenticated:  codes.Unauthenticated,
+	utils.KindForbidden:        codes.PermissionDenied,
+	utils.KindNotFound:         codes.NotFound,
+	utils.KindMethodNotAllowed: codes.Unimplemented,
+	utils.KindConflict:         codes.FailedPrecondition,
+	utils.KindGone:             codes.FailedPrecondition,
+	utils.KindRateLimited:      codes.ResourceExhausted,
+	utils.KindUnavailable:      codes.Unavailable,
+	utils.KindTimeout:          codes.DeadlineExceeded,
+	utils.KindCanceled:         codes.Canceled,
+}
+
+// validationError is the error of a call whose request has invalid fields.
+type validationError struct {
+	params []InvalidParam
+}
+
+func (e *validationError) Error() string {
+	return utils.ErrInvalidRequest.Error()
+}
+
+func (e *validationError) Unwrap() error {
+	return utils.ErrInvalidRequest
+}
+
+// invalidRequest reports the invalid fields of a request, renaming the fields
+// the validators name like the HTTP API to their names in the gRPC API.
+func invalidRequest(params []InvalidParam, fields map[string]string) error {
+	for i, param := range params {
+		if field, exists := fields[param.Name]; exists {
+			params[i].Name = field
+		}
+	}
+	return &validationError{params: params}
+}
+
+// GRPCServer returns a gRPC server serving the gRPC API with the signature
+// service of the Server. Like the HTTP API, calls are traced, logged, counted
+// as in flight and cancelled past their configured deadline, which is looked
+// up by full method name. Callers are authenticated with the credentials of
+// the HTTP API sent as metadata, and are authorized and rate limited alike.
+// The server serves TLS when a certificate is configured.
+func (s *Server) GRPCServer() (*grpc.Server, error) {
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.TraceRPC, s.LogRPC, s.CountRPC, s.ErrorRPC, s.DeadlineRPC, s.AuthenticateRPC),
+	}
+	if s.config.TLS.Enabled() {
+		tlsConfig, err := newTLSConfig(s.config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := tls.LoadX509KeyPair(s.config.TLS.CertFile, s.config.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
+	signingv1.RegisterSignatureServiceServer(server, &rpcServer{server: s})
+	return server, nil
+}
+
+// metadataCarrier carries trace context in gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// TraceRPC is an interceptor that serves every call in a server span named
+// after its method. Trace context sent by callers in the W3C traceparent
+// metadata is continued.
+func (s *Server) TraceRPC(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ any, err error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = tracing.Propagator.Extract(ctx, metadataCarrier(md))
+	service, method, _ := strings.Cut(strings.TrimPrefix(info.FullMethod, "/"), "/")
+	ctx, span := s.tracer.Start(ctx, service+"/"+method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		semconv.RPCSystemGRPC,
+		semconv.RPCService(service),
+		semconv.RPCMethod(method),
+	))
+	defer tracing.End(span, &err)
+	response, err := handler(ctx, request)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))))
+	return response, err
+}
+
+// rpcOutcomeOf classifies a status code for the log like outcomeOf does
+// HTTP statuses.
+func rpcOutcomeOf(code codes.Code) (string, slog.Level) {
+	switch code {
+	case codes.OK:
+		return "success", slog.LevelInfo
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unimplemented, codes.Unavailable, codes.DeadlineExceeded:
+		return "error", slog.LevelError
+	default:
+		return "rejected", slog.LevelWarn
+	}
+}
+
+// LogRPC is an interceptor that assigns every call an ID, sent back in the
+// x-request-id header metadata, and logs the outcome of the call once it has
+// been served. Requests and responses are never logged.
+func (s *Server) LogRPC(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	log := &requestLog{}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(RequestIDHeader); len(ids) > 0 {
+			log.id = ids[0]
+		}
+	}
+	if !requestIdPattern.MatchString(log.id) {
+		log.id = uuid.NewString()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, log.id))
+	response, err := handler(context.WithValue(ctx, requestLogContextKey{}, log), request)
+
+	code := status.Code(err)
+	outcome, level := rpcOutcomeOf(code)
+	attrs := []slog.Attr{
+		slog.String("request_id", log.id),
+		slog.String("method", info.FullMethod),
+		slog.String("code", code.String()),
+		slog.String("outcome", outcome),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		attrs = append(attrs, slog.String("trace_id", spanContext.TraceID().String()))
+	}
+	attrs = append(attrs, log.attrs...)
+	if len(log.errors) > 0 {
+		attrs = append(attrs, slog.Any("errors", log.errors))
+	}
+	s.logger.LogAttrs(ctx, level, "call served", attrs...)
+	return response, err
+}
+
+// CountRPC is an interceptor that counts the calls of a method being served.
+func (s *Server) CountRPC(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	defer s.metrics.RequestStarted(info.FullMethod)()
+	return handler(ctx, request)
+}
+
+// ErrorRPC is an interceptor that answers failed calls with the status code
+// matching the kind of the error. The status carries a google.rpc.ErrorInfo
+// with the stable code of the error as reason, and a google.rpc.BadRequest or
+// google.rpc.RetryInfo for invalid and rate limited calls. Only the log
+// learns about the cause of internal errors.
+func (s *Server) ErrorRPC(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	response, err := handler(ctx, request)
+	if err == nil {
+		return response, nil
+	}
+	if log, ok := ctx.Value(requestLogContextKey{}).(*requestLog); ok {
+		log.errors = append(log.errors, err.Error())
+	}
+	return nil, rpcStatus(err).Err()
+}
+
+// rpcStatus returns the status err is answered with.
+func rpcStatus(err error) *status.Status {
+	code, exists := kindCodes[utils.ErrorKindOf(err)]
+	if !exists {
+		code = codes.Internal
+	}
+	message := err.Error()
+	if code == codes.Internal {
+		message = "internal error"
+	}
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: utils.ErrorCode(err), Domain: rpcErrorDomain}}
+	var invalid *validationError
+	if errors.As(err, &invalid) {
+		badRequest := &errdetails.BadRequest{}
+		for _, param := range invalid.params {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       param.Name,
+				Description: param.Reason,
+			})
+		}
+		details = append(details, badRequest)
+	}
+	var limited *utils.RateLimitedError
+	if errors.As(err, &limited) {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(limited.RetryAfter)})
+	}
+	st := status.New(code, message)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// DeadlineRPC is an interceptor that cancels the work done for calls once
+// the deadline configured for their method has passed. Deadlines set by
+// callers apply as well.
+func (s *Server) DeadlineRPC(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	timeout := s.config.RequestTimeouts.For(info.FullMethod)
+	if timeout <= 0 {
+		return handler(ctx, request)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return handler(ctx, request)
+}
+
+// peerCertificateSubject returns the subject of the verified client
+// certificate of a call, if any.
+func peerCertificateSubject(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return tlsInfo.State.VerifiedChains[0][0].Subject.String()
+}
+
+// rpcCallerOf identifies the caller of a call by its principal, or by its
+// peer address when authentication is disabled.
+func rpcCallerOf(ctx context.Context) string {
+	if principal := principalFromContext(ctx); principal != nil {
+		return "principal:" + principal.ID
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "address:"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "address:" + host
+}
+
+// AuthenticateRPC is an interceptor that rejects calls without a valid
+// bearer token in the authorization metadata or API key in the x-api-key
+// metadata, rate limits every caller and rejects callers lacking the scope
+// required for the method. The resolved principal is attached to the context.
+func (s *Server) AuthenticateRPC(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.authenticationEnabled() {
+		md, _ := metadata.FromIncomingContext(ctx)
+		first := func(key string) string {
+			if values := md.Get(key); len(values) > 0 {
+				return values[0]
+			}
+			return ""
+		}
+		principal, err := s.authenticateCredentials(first("authorization"), first(APIKeyHeader), peerCertificateSubject(ctx))
+		if err != nil {
+			return nil, err
+		}
+		logContextAttrs(ctx, slog.String("principal", principal.ID))
+		ctx = context.WithValue(ctx, principalContextKey{}, principal)
+	}
+	caller := rpcCallerOf(ctx)
+	if allowed, retryAfter := s.clientLimiter.allow(caller, caller); !allowed {
+		return nil, &utils.RateLimitedError{RetryAfter: retryAfter}
+	}
+	if principal := principalFromContext(ctx); principal != nil && !principal.HasScope(rpcScopes[info.FullMethod]) {
+		return nil, utils.ErrInsufficientScope
+	}
+	return handler(ctx, request)
+}
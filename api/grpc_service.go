@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/uwemakan/signing-service/domain"
+	signingv1 "github.com/uwemakan/signing-service/proto/signing/v1"
+	"github.com/uwemakan/signing-service/utils"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// rpcServer serves the SignatureService of the gRPC API with the signature
+// service of the Server, validating requests like the HTTP API does.
+type rpcServer struct {
+	signingv1.UnimplementedSignatureServiceServer
+	server *Server
+}
+
+// rpcTenant returns the tenant addressed by a request, the default tenant
+// when none is given.
+func rpcTenant(tenantID string) (string, error) {
+	if tenantID == "" {
+		return utils.DefaultTenant, nil
+	}
+	if !validateTenantID(tenantID) {
+		return "", utils.ErrInvalidTenantId
+	}
+	return tenantID, nil
+}
+
+// rpcDeviceID checks the device ID of a request and adds it to the log of
+// the call.
+func rpcDeviceID(ctx context.Context, id string) error {
+	if !validateUUID(id) {
+		return utils.ErrInvalidDeviceId
+	}
+	logContextAttrs(ctx, slog.String("device_id", id))
+	return nil
+}
+
+func (r *rpcServer) CreateDevice(ctx context.Context, request *signingv1.CreateDeviceRequest) (*signingv1.CreateDeviceResponse, error) {
+	tenantID, err := rpcTenant(request.GetTenantId())
+	if err != nil {
+		return nil, err
+	}
+	deviceRequest := &domain.SignatureDeviceRequest{
+		ID:                request.GetId(),
+		Algorithm:         request.GetAlgorithm(),
+		Label:             request.Label,
+		Metadata:          request.GetMetadata(),
+		PrivateKey:        request.PrivateKey,
+		WrappedPrivateKey: request.WrappedPrivateKey,
+	}
+	if request.MaxSignatures != nil {
+		maxSignatures := int(request.GetMaxSignatures())
+		deviceRequest.MaxSignatures = &maxSignatures
+	}
+	if request.NotAfter != nil {
+		notAfter := request.GetNotAfter().AsTime()
+		deviceRequest.NotAfter = &notAfter
+	}
+	if errs := validateSignatureDeviceRequest(deviceRequest); len(errs) > 0 {
+		return nil, invalidRequest(errs, map[string]string{
+			"privateKey":        "private_key",
+			"wrappedPrivateKey": "wrapped_private_key",
+			"maxSignatures":     "max_signatures",
+		})
+	}
+	logContextAttrs(ctx, slog.String("device_id", deviceRequest.ID))
+	device, err := r.server.signatureDeviceService.CreateSignatureDevice(ctx, principalFromContext(ctx), tenantID, deviceRequest)
+	if err != nil {
+		return nil, err
+	}
+	return &signingv1.CreateDeviceResponse{Device: deviceToProto(device)}, nil
+}
+
+func (r *rpcServer) GetDevice(ctx context.Context, request *signingv1.GetDeviceRequest) (*signingv1.GetDeviceResponse, error) {
+	tenantID, err := rpcTenant(request.GetTenantId())
+	if err != nil {
+		return nil, err
+	}
+	if err := rpcDeviceID(ctx, request.GetId()); err != nil {
+		return nil, err
+	}
+	device, err := r.server.signatureDeviceService.GetSignatureDevice(ctx, principalFromContext(ctx), tenantID, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &signingv1.GetDeviceResponse{Device: deviceToProto(device)}, nil
+}
+
+// ListDevices reads the query like the HTTP API reads its query parameters.
+// The page token is the cursor of the HTTP API.
+func (r *rpcServer) ListDevices(ctx context.Context, request *signingv1.ListDevicesRequest) (*signingv1.ListDevicesResponse, error) {
+	tenantID, err := rpcTenant(request.GetTenantId())
+	if err != nil {
+		return nil, err
+	}
+	values := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	set("algorithm", request.GetAlgorithm())
+	set("status", request.GetStatus())
+	set("labelPrefix", request.GetLabelPrefix())
+	set("sort", request.GetSort())
+	set("cursor", request.GetPageToken())
+	if request.GetDescending() {
+		values.Set("order", "desc")
+	}
+	if request.GetPageSize() != 0 {
+		values.Set("limit", strconv.Itoa(int(request.GetPageSize())))
+	}
+	for key, value := range request.GetMetadata() {
+		values.Set(metadataQueryPrefix+key, value)
+	}
+	for name, filter := range map[string]*timestamppb.Timestamp{
+		"createdAfter":     request.GetCreatedAfter(),
+		"createdBefore":    request.GetCreatedBefore(),
+		"lastSignedAfter":  request.GetLastSignedAfter(),
+		"lastSignedBefore": request.GetLastSignedBefore(),
+	} {
+		if filter != nil {
+			values.Set(name, filter.AsTime().Format(time.RFC3339Nano))
+		}
+	}
+	query, errs := parseDeviceQuery(values)
+	if len(errs) > 0 {
+		return nil, invalidRequest(errs, map[string]string{
+			"labelPrefix":      "label_prefix",
+			"createdAfter":     "created_after",
+			"createdBefore":    "created_before",
+			"lastSignedAfter":  "last_signed_after",
+			"lastSignedBefore": "last_signed_before",
+			"limit":            "page_size",
+			"cursor":           "page_token",
+		})
+	}
+	page, err := r.server.signatureDeviceService.ListSignatureDevices(ctx, principalFromContext(ctx), tenantID, query)
+	if err != nil {
+		return nil, err
+	}
+	response := &signingv1.ListDevicesResponse{NextPageToken: page.NextCursor}
+	for _, device := range page.Devices {
+		response.Devices = append(response.Devices, deviceToProto(device))
+	}
+	return response, nil
+}
+
+// SignTransaction is rejected while the server drains before shutting down,
+// like signing over HTTP.
+func (r *rpcServer) SignTransaction(ctx context.Context, request *signingv1.SignTransactionRequest) (*signingv1.SignTransactionResponse, error) {
+	if r.server.draining.Load() {
+		return nil, utils.ErrShuttingDown
+	}
+	tenantID, err := rpcTenant(request.GetTenantId())
+	if err != nil {
+		return nil, err
+	}
+	signatureRequest := &domain.SignTransactionRequest{ID: request.GetDeviceId(), Data: request.GetData()}
+	if errs := validateTransactionSignatureRequest(signatureRequest); len(errs) > 0 {
+		return nil, invalidRequest(errs, map[string]string{"id": "device_id"})
+	}
+	logContextAttrs(ctx, slog.String("device_id", signatureRequest.ID))
+	signature, err := r.server.signatureDeviceService.SignTransaction(ctx, principalFromContext(ctx), tenantID, signatureRequest.ID, signatureRequest.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &signingv1.SignTransactionResponse{Signature: signature.Signature, SignedData: signature.SignedData}, nil
+}
+
+func (r *rpcServer) VerifySignature(ctx context.Context, request *signingv1.VerifySignatureRequest) (*signingv1.VerifySignatureResponse, error) {
+	tenantID, err := rpcTenant(request.GetTenantId())
+	if err != nil {
+		return nil, err
+	}
+	var errs []InvalidParam
+	if !validateUUID(request.GetDeviceId()) {
+		errs = append(errs, invalidParam("device_id", "invalid device id: %s is not a valid UUID", request.GetDeviceId()))
+	}
+	if !validateData(request.GetSignedData()) {
+		errs = append(errs, invalidParam("signed_data", "invalid signed data: signed data must be in the format signatureCounter_data_lastSignature"))
+	}
+	if request.GetSignature() == "" {
+		errs = append(errs, invalidParam("signature", "signature is required"))
+	}
+	if len(errs) > 0 {
+		return nil, invalidRequest(errs, nil)
+	}
+	logContextAttrs(ctx, slog.String("device_id", request.GetDeviceId()))
+	verification, err := r.server.signatureDeviceService.VerifySignature(ctx, principalFromContext(ctx), tenantID, request.GetDeviceId(), request.GetSignedData(), request.GetSignature())
+	if err != nil {
+		return nil, err
+	}
+	return &signingv1.VerifySignatureResponse{Valid: verification.Valid, KeyVersion: int64(verification.KeyVersion)}, nil
+}
+
+// deviceToProto converts a device to its message in the gRPC API.
+func deviceToProto(device *domain.SignatureDevice) *signingv1.Device {
+	message := &signingv1.Device{
+		Id:               device.ID,
+		TenantId:         device.TenantID,
+		Algorithm:        device.Algorithm,
+		Label:            device.Label,
+		Owner:            device.Owner,
+		Terminal:         device.Terminal,
+		Status:           device.Status,
+		SignatureCounter: int64(device.SignatureCounter),
+		LastSignature:    device.LastSignature,
+		KeyVersion:       int64(device.KeyVersion),
+		Metadata:         device.Metadata,
+		CreatedAt:        timestamppb.New(device.CreatedAt),
+		UpdatedAt:        timestamppb.New(device.UpdatedAt),
+	}
+	for _, key := range device.KeyHistory {
+		message.KeyHistory = append(message.KeyHistory, &signingv1.DeviceKey{Version: int64(key.Version), PublicKey: key.PublicKey})
+	}
+	if device.LastSignedAt != nil {
+		message.LastSignedAt = timestamppb.New(*device.LastSignedAt)
+	}
+	if device.MaxSignatures != nil {
+		message.MaxSignatures = proto.Int64(int64(*device.MaxSignatures))
+		message.RemainingSignatures = proto.Int64(int64(*device.RemainingSignatures()))
+	}
+	if device.NotAfter != nil {
+		message.NotAfter = timestamppb.New(*device.NotAfter)
+	}
+	return message
+}
@@ -0,0 +1,412 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	signingv1 "github.com/uwemakan/signing-service/proto/signing/v1"
+	"github.com/uwemakan/signing-service/utils"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// dialGRPC returns a client of the gRPC API of server, served over an
+// in-memory connection on listener.
+func dialGRPC(t *testing.T, listener *bufconn.Listener) signingv1.SignatureServiceClient {
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return signingv1.NewSignatureServiceClient(conn)
+}
+
+// serveGRPC serves the gRPC API of server until the test ends and returns a
+// client of it.
+func serveGRPC(t *testing.T, server *Server) signingv1.SignatureServiceClient {
+	listener := bufconn.Listen(1 << 20)
+	grpcServer, err := server.GRPCServer()
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+	return dialGRPC(t, listener)
+}
+
+func withAPIKey(apiKey string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), APIKeyHeader, apiKey)
+}
+
+// requireStatus checks that err is a status with code and the error code as
+// reason of its ErrorInfo, and returns the status.
+func requireStatus(t *testing.T, err error, code codes.Code, errorCode string) *status.Status {
+	requires := require.New(t)
+	st, ok := status.FromError(err)
+	requires.True(ok, "%v is not a status", err)
+	requires.Equal(code, st.Code(), st.Message())
+	var info *errdetails.ErrorInfo
+	for _, detail := range st.Details() {
+		if detail, ok := detail.(*errdetails.ErrorInfo); ok {
+			info = detail
+		}
+	}
+	requires.NotNil(info)
+	requires.Equal(errorCode, info.Reason)
+	requires.Equal(rpcErrorDomain, info.Domain)
+	return st
+}
+
+func TestGRPCDevices(t *testing.T) {
+	requires := require.New(t)
+	server := NewServer(authConfig)
+	client := serveGRPC(t, server)
+	ctx := withAPIKey("secret-a")
+
+	id := uuid.NewString()
+	var header metadata.MD
+	created, err := client.CreateDevice(ctx, &signingv1.CreateDeviceRequest{
+		Id:            id,
+		Algorithm:     "ECC",
+		Label:         proto.String("till 1"),
+		Metadata:      map[string]string{"site": "berlin"},
+		MaxSignatures: proto.Int64(10),
+	}, grpc.Header(&header))
+	requires.NoError(err)
+	requires.Len(header.Get(RequestIDHeader), 1)
+	requires.Equal(id, created.Device.Id)
+	requires.Equal(utils.DefaultTenant, created.Device.TenantId)
+	requires.Equal("till 1", created.Device.Label)
+	requires.Equal("key:merchant-a", created.Device.Owner)
+	requires.Equal(utils.DeviceStatusActive, created.Device.Status)
+	requires.Equal(map[string]string{"site": "berlin"}, created.Device.Metadata)
+	requires.EqualValues(10, created.Device.GetRemainingSignatures())
+	requires.Equal(base64.StdEncoding.EncodeToString([]byte(id)), created.Device.LastSignature)
+
+	got, err := client.GetDevice(ctx, &signingv1.GetDeviceRequest{Id: id})
+	requires.NoError(err)
+	requires.True(proto.Equal(created.Device, got.Device))
+
+	// The chain of signatures continues across calls and verifies.
+	lastSignature := created.Device.LastSignature
+	var signed *signingv1.SignTransactionResponse
+	for counter := range 2 {
+		signed, err = client.SignTransaction(ctx, &signingv1.SignTransactionRequest{
+			DeviceId: id,
+			Data:     formatData(counter, "TESTDATA", lastSignature),
+		})
+		requires.NoError(err)
+		lastSignature = signed.Signature
+	}
+	verified, err := client.VerifySignature(ctx, &signingv1.VerifySignatureRequest{
+		DeviceId:   id,
+		SignedData: signed.SignedData,
+		Signature:  signed.Signature,
+	})
+	requires.NoError(err)
+	requires.True(verified.Valid)
+	requires.EqualValues(1, verified.KeyVersion)
+	verified, err = client.VerifySignature(ctx, &signingv1.VerifySignatureRequest{
+		DeviceId:   id,
+		SignedData: formatData(1, "OTHERDATA", signed.Signature),
+		Signature:  signed.Signature,
+	})
+	requires.NoError(err)
+	requires.False(verified.Valid)
+
+	// The HTTP API serves the same devices.
+	recorder := serveWithAPIKey(t, server.Routes(), http.MethodGet, "/api/v1/signature-devices/"+id, "secret-a", nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	requires.Contains(recorder.Body.String(), `"signatureCounter": 2`)
+
+	// Devices are listed a page at a time.
+	for range 2 {
+		_, err := client.CreateDevice(ctx, &signingv1.CreateDeviceRequest{Id: uuid.NewString(), Algorithm: "ECC"})
+		requires.NoError(err)
+	}
+	var listed []string
+	request := &signingv1.ListDevicesRequest{PageSize: 2}
+	for {
+		page, err := client.ListDevices(ctx, request)
+		requires.NoError(err)
+		requires.LessOrEqual(len(page.Devices), 2)
+		for _, device := range page.Devices {
+			listed = append(listed, device.Id)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		request.PageToken = page.NextPageToken
+	}
+	requires.Len(listed, 3)
+	requires.Contains(listed, id)
+
+	page, err := client.ListDevices(ctx, &signingv1.ListDevicesRequest{Metadata: map[string]string{"site": "berlin"}})
+	requires.NoError(err)
+	requires.Len(page.Devices, 1)
+	requires.Equal(id, page.Devices[0].Id)
+
+	// Devices are only visible to their owner.
+	_, err = client.GetDevice(withAPIKey("secret-b"), &signingv1.GetDeviceRequest{Id: id})
+	requireStatus(t, err, codes.NotFound, "device_not_found")
+}
+
+// formatData formats the data of a signature request.
+func formatData(counter int, data, lastSignature string) string {
+	return fmt.Sprintf("%d_%s_%s", counter, data, lastSignature)
+}
+
+func TestGRPCErrors(t *testing.T) {
+	rateLimitedConfig := *authConfig
+	rateLimitedConfig.RateLimits = utils.RateLimitConfig{Device: utils.RateLimit{Rate: 0.01, Burst: 1}}
+	server := NewServer(&rateLimitedConfig)
+	client := serveGRPC(t, server)
+	ctx := withAPIKey("secret-a")
+	id := uuid.NewString()
+	_, err := client.CreateDevice(ctx, &signingv1.CreateDeviceRequest{Id: id, Algorithm: "RSA"})
+	require.NoError(t, err)
+	lastSignature := base64.StdEncoding.EncodeToString([]byte(id))
+
+	testCases := []struct {
+		name      string
+		call      func() error
+		code      codes.Code
+		errorCode string
+		fields    []string
+	}{
+		{
+			name: "Unauthenticated",
+			call: func() error {
+				_, err := client.GetDevice(context.Background(), &signingv1.GetDeviceRequest{Id: id})
+				return err
+			},
+			code:      codes.Unauthenticated,
+			errorCode: "unauthenticated",
+		},
+		{
+			name: "Invalid_Device",
+			call: func() error {
+				_, err := client.CreateDevice(ctx, &signingv1.CreateDeviceRequest{Id: "device", Algorithm: "DSA", PrivateKey: proto.String("")})
+				return err
+			},
+			code:      codes.InvalidArgument,
+			errorCode: "invalid_request",
+			fields:    []string{"id", "algorithm", "private_key"},
+		},
+		{
+			name: "Invalid_Page",
+			call: func() error {
+				_, err := client.ListDevices(ctx, &signingv1.ListDevicesRequest{PageSize: -1, Sort: "label"})
+				return err
+			},
+			code:      codes.InvalidArgument,
+			errorCode: "invalid_request",
+			fields:    []string{"sort", "page_size"},
+		},
+		{
+			name: "Invalid_Page_Token",
+			call: func() error {
+				_, err := client.ListDevices(ctx, &signingv1.ListDevicesRequest{PageToken: "not-a-token"})
+				return err
+			},
+			code:      codes.InvalidArgument,
+			errorCode: "invalid_cursor",
+		},
+		{
+			name: "Invalid_Tenant",
+			call: func() error {
+				_, err := client.GetDevice(ctx, &signingv1.GetDeviceRequest{TenantId: "Tenant A", Id: id})
+				return err
+			},
+			code:      codes.InvalidArgument,
+			errorCode: "invalid_tenant_id",
+		},
+		{
+			name: "Invalid_Device_Id",
+			call: func() error {
+				_, err := client.GetDevice(ctx, &signingv1.GetDeviceRequest{Id: "device"})
+				return err
+			},
+			code:      codes.InvalidArgument,
+			errorCode: "invalid_device_id",
+		},
+		{
+			name: "Device_Not_Found",
+			call: func() error {
+				_, err := client.GetDevice(ctx, &signingv1.GetDeviceRequest{Id: uuid.NewString()})
+				return err
+			},
+			code:      codes.NotFound,
+			errorCode: "device_not_found",
+		},
+		{
+			name: "Invalid_Signature_Request",
+			call: func() error {
+				_, err := client.SignTransaction(ctx, &signingv1.SignTransactionRequest{DeviceId: "device", Data: "TESTDATA"})
+				return err
+			},
+			code:      codes.InvalidArgument,
+			errorCode: "invalid_request",
+			fields:    []string{"device_id", "data"},
+		},
+		{
+			name: "Invalid_Signature_Counter",
+			call: func() error {
+				_, err := client.SignTransaction(ctx, &signingv1.SignTransactionRequest{DeviceId: id, Data: formatData(1, "TESTDATA", lastSignature)})
+				return err
+			},
+			code:      codes.InvalidArgument,
+			errorCode: "invalid_signature_counter",
+		},
+		{
+			name: "Device_Rate_Limited",
+			call: func() error {
+				_, err := client.SignTransaction(ctx, &signingv1.SignTransactionRequest{DeviceId: id, Data: formatData(0, "TESTDATA", lastSignature)})
+				return err
+			},
+			code:      codes.ResourceExhausted,
+			errorCode: "rate_limited",
+		},
+		{
+			name: "Invalid_Verification",
+			call: func() error {
+				_, err := client.VerifySignature(ctx, &signingv1.VerifySignatureRequest{DeviceId: id, SignedData: "TESTDATA"})
+				return err
+			},
+			code:      codes.InvalidArgument,
+			errorCode: "invalid_request",
+			fields:    []string{"signed_data", "signature"},
+		},
+		{
+			name: "Signature_Not_Base64",
+			call: func() error {
+				_, err := client.VerifySignature(ctx, &signingv1.VerifySignatureRequest{DeviceId: id, SignedData: formatData(0, "TESTDATA", lastSignature), Signature: "not base64!"})
+				return err
+			},
+			code:      codes.InvalidArgument,
+			errorCode: "invalid_signature",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			st := requireStatus(t, tc.call(), tc.code, tc.errorCode)
+			var fields []string
+			for _, detail := range st.Details() {
+				if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+					for _, violation := range badRequest.FieldViolations {
+						fields = append(fields, violation.Field)
+					}
+				}
+			}
+			require.Equal(t, tc.fields, fields)
+		})
+	}
+
+	// Callers are told when to retry after being rate limited.
+	_, err = client.SignTransaction(ctx, &signingv1.SignTransactionRequest{DeviceId: id, Data: formatData(1, "TESTDATA", lastSignature)})
+	st := requireStatus(t, err, codes.ResourceExhausted, "rate_limited")
+	require.Len(t, st.Details(), 2)
+	require.IsType(t, &errdetails.RetryInfo{}, st.Details()[1])
+	require.Positive(t, st.Details()[1].(*errdetails.RetryInfo).RetryDelay.AsDuration())
+
+	// Signing is rejected while the server drains.
+	server.draining.Store(true)
+	_, err = client.SignTransaction(ctx, &signingv1.SignTransactionRequest{DeviceId: id, Data: formatData(1, "TESTDATA", lastSignature)})
+	requireStatus(t, err, codes.Unavailable, "shutting_down")
+}
+
+func TestGRPCStatus(t *testing.T) {
+	requires := require.New(t)
+
+	// Only the log learns about the cause of internal errors.
+	st := rpcStatus(errors.New("disk on fire"))
+	requires.Equal(codes.Internal, st.Code())
+	requires.Equal("internal error", st.Message())
+	requires.Equal(utils.ErrorInternal, st.Details()[0].(*errdetails.ErrorInfo).Reason)
+
+	for err, code := range map[error]codes.Code{
+		utils.ErrDeviceNotActive:    codes.FailedPrecondition,
+		utils.ErrDeviceExpired:      codes.FailedPrecondition,
+		utils.ErrTenantAccessDenied: codes.PermissionDenied,
+		utils.ErrMalformedRequest:   codes.InvalidArgument,
+		utils.ErrJobQueueFull:       codes.Unavailable,
+		context.DeadlineExceeded:    codes.DeadlineExceeded,
+		context.Canceled:            codes.Canceled,
+	} {
+		st := rpcStatus(err)
+		requires.Equal(code, st.Code(), err.Error())
+		requires.Equal(err.Error(), st.Message())
+		requires.Equal(utils.ErrorCode(err), st.Details()[0].(*errdetails.ErrorInfo).Reason)
+	}
+}
+
+func TestGRPCScopes(t *testing.T) {
+	requires := require.New(t)
+	jwtConfig, keys := newJWTTestConfig(t)
+	client := serveGRPC(t, NewServer(jwtConfig))
+	withToken := func(scopes ...string) context.Context {
+		token := signJWT(t, "RS256", "rsa", keys.rsa, validClaims(scopes...))
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	id := uuid.NewString()
+	_, err := client.CreateDevice(withToken(utils.ScopeDevicesRead), &signingv1.CreateDeviceRequest{Id: id, Algorithm: "ECC"})
+	requireStatus(t, err, codes.PermissionDenied, "insufficient_scope")
+	_, err = client.CreateDevice(withToken(utils.ScopeDevicesWrite), &signingv1.CreateDeviceRequest{Id: id, Algorithm: "ECC"})
+	requires.NoError(err)
+	_, err = client.SignTransaction(withToken(utils.ScopeDevicesRead), &signingv1.SignTransactionRequest{
+		DeviceId: id,
+		Data:     formatData(0, "TESTDATA", base64.StdEncoding.EncodeToString([]byte(id))),
+	})
+	requireStatus(t, err, codes.PermissionDenied, "insufficient_scope")
+	_, err = client.SignTransaction(withToken(utils.ScopeTransactionsSign), &signingv1.SignTransactionRequest{
+		DeviceId: id,
+		Data:     formatData(0, "TESTDATA", base64.StdEncoding.EncodeToString([]byte(id))),
+	})
+	requires.NoError(err)
+
+	_, err = client.GetDevice(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer invalid"), &signingv1.GetDeviceRequest{Id: id})
+	requireStatus(t, err, codes.Unauthenticated, "invalid_token")
+}
+
+func TestGRPCServe(t *testing.T) {
+	requires := require.New(t)
+	serveConfig := *authConfig
+	serveConfig.Shutdown = utils.ShutdownConfig{Timeout: 5 * time.Second}
+	server := NewServer(&serveConfig)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	requires.NoError(err)
+	grpcListener := bufconn.Listen(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Serve(ctx, listener, grpcListener) }()
+
+	client := dialGRPC(t, grpcListener)
+	_, err = client.CreateDevice(withAPIKey("secret-a"), &signingv1.CreateDeviceRequest{Id: uuid.NewString(), Algorithm: "ECC"})
+	requires.NoError(err)
+
+	cancel()
+	select {
+	case err := <-stopped:
+		requires.NoError(err)
+	case <-time.After(5 * time.Second):
+		requires.FailNow("server did not shut down")
+	}
+	_, err = client.GetDevice(withAPIKey("secret-a"), &signingv1.GetDeviceRequest{Id: uuid.NewString()})
+	requires.Equal(codes.Unavailable, status.Code(err))
+}
@@ -1,21 +1,36 @@
 package api
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// healthContentType is the media type of the health check response draft
+// (draft-inadarei-api-health-check).
+const healthContentType = "application/health+json"
 
 type HealthResponse struct {
 	Status  string `json:"status"`
 	Version string `json:"version"`
 }
 
+// ProbeResponse is the response of the liveness and readiness probes in the
+// health check response draft format. Version is the build version of the
+// service.
+type ProbeResponse struct {
+	Status  string                          `json:"status"`
+	Version string                          `json:"version"`
+	Output  string                          `json:"output,omitempty"`
+	Checks  map[string][]domain.HealthCheck `json:"checks,omitempty"`
+}
+
 // Health evaluates the health of the service and writes a standardized response.
+// It is kept for clients of the v0 API and only reports that the service is
+// alive, like Livez.
 func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
-	if request.Method != http.MethodGet {
-		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
-			http.StatusText(http.StatusMethodNotAllowed),
-		})
-		return
-	}
-
 	health := HealthResponse{
 		Status:  "pass",
 		Version: "v0",
@@ -23,3 +38,56 @@ func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
 
 	WriteAPIResponse(response, http.StatusOK, health)
 }
+
+// Livez reports that the process is alive and serving requests. It checks no
+// dependencies, so that a failing dependency doesn't get the process
+// restarted.
+func (s *Server) Livez(response http.ResponseWriter, request *http.Request) {
+	writeProbeResponse(response, &ProbeResponse{Status: utils.HealthStatusPass, Version: utils.Version})
+}
+
+// Readyz reports whether the service can serve requests, checking the
+// repository, the key encryption key, signing with a canary key and the key
+// generation queue. It fails with 503 Service Unavailable when a check fails
+// or the server is draining before shutting down; warnings leave the service
+// ready.
+func (s *Server) Readyz(response http.ResponseWriter, request *http.Request) {
+	probe := &ProbeResponse{
+		Status:  utils.HealthStatusPass,
+		Version: utils.Version,
+		Checks:  s.healthService.Ready(request.Context()),
+	}
+	for _, checks := range probe.Checks {
+		for _, check := range checks {
+			switch {
+			case check.Status == utils.HealthStatusFail:
+				probe.Status = utils.HealthStatusFail
+			case check.Status == utils.HealthStatusWarn && probe.Status == utils.HealthStatusPass:
+				probe.Status = utils.HealthStatusWarn
+			}
+		}
+	}
+	if s.draining.Load() {
+		probe.Status = utils.HealthStatusFail
+		probe.Output = utils.ErrShuttingDown.Error()
+	}
+	writeProbeResponse(response, probe)
+}
+
+// writeProbeResponse writes probe as application/health+json, with 503
+// Service Unavailable when it failed.
+func writeProbeResponse(w http.ResponseWriter, probe *ProbeResponse) {
+	bytes, err := json.MarshalIndent(probe, "", "  ")
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	code := http.StatusOK
+	if probe.Status == utils.HealthStatusFail {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", healthContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(bytes)
+}
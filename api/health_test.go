@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func TestProbes(t *testing.T) {
+	requires := require.New(t)
+	server := NewServer(authConfig)
+	handler := server.Routes()
+	probe := func(url string, code int) *ProbeResponse {
+		recorder := serveWithAPIKey(t, handler, http.MethodGet, url, "", nil)
+		requires.Equal(code, recorder.Code, recorder.Body.String())
+		requires.Equal("application/health+json", recorder.Header().Get("Content-Type"))
+		var response ProbeResponse
+		requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+		requires.Equal(utils.Version, response.Version)
+		return &response
+	}
+
+	// Probes are public, like the health check.
+	live := probe("/livez", http.StatusOK)
+	requires.Equal(utils.HealthStatusPass, live.Status)
+	requires.Empty(live.Checks)
+
+	ready := probe("/readyz", http.StatusOK)
+	requires.Equal(utils.HealthStatusPass, ready.Status)
+	requires.Len(ready.Checks, 4)
+	for name, checks := range ready.Checks {
+		requires.Equal(utils.HealthStatusPass, checks[0].Status, name)
+	}
+	requires.Equal("ms", ready.Checks["signer:responseTime"][0].ObservedUnit)
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/readyz", "", nil)
+	requires.Equal(http.StatusMethodNotAllowed, recorder.Code)
+
+	// A draining server is alive but no longer ready.
+	server.draining.Store(true)
+	ready = probe("/readyz", http.StatusServiceUnavailable)
+	requires.Equal(utils.HealthStatusFail, ready.Status)
+	requires.Equal(utils.ErrShuttingDown.Error(), ready.Output)
+	probe("/livez", http.StatusOK)
+
+	// A failing dependency fails readiness only.
+	brokenConfig := *config
+	brokenConfig.AESKey = []byte("short")
+	handler = NewServer(&brokenConfig).Routes()
+	ready = probe("/readyz", http.StatusServiceUnavailable)
+	requires.Equal(utils.HealthStatusFail, ready.Status)
+	requires.Equal(utils.HealthStatusFail, ready.Checks["kek:availability"][0].Status)
+	requires.Equal(utils.HealthStatusPass, ready.Checks["repository:responseTime"][0].Status)
+	probe("/livez", http.StatusOK)
+}
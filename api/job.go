@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// GetJob reports the status of an asynchronous device creation job.
+func (s *Server) GetJob(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	if !validateUUID(id) {
+		HandleError(response, request, utils.ErrInvalidJobId)
+		return
+	}
+	job, err := s.signatureDeviceService.GetJob(request.Context(), principalFromRequest(request), requestTenant(request), id)
+	if err != nil {
+		HandleError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, job)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func createSignatureDeviceAsync(t *testing.T, server *Server, request *domain.SignatureDeviceRequest) *httptest.ResponseRecorder {
+	requires := require.New(t)
+	b, err := json.Marshal(request)
+	requires.NoError(err)
+
+	url := "/api/v0/signature-devices?async=true"
+	body := bytes.NewReader(b)
+
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	requires.NoError(err)
+	recorder := httptest.NewRecorder()
+	server.Routes().ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestCreateSignatureDeviceAsync(t *testing.T) {
+	requires := require.New(t)
+	server := NewServer(config)
+	id, _ := uuid.NewRandom()
+
+	recorder := createSignatureDeviceAsync(t, server, &domain.SignatureDeviceRequest{
+		ID:        id.String(),
+		Algorithm: utils.Algorithms[0],
+	})
+	requires.Equal(http.StatusAccepted, recorder.Code)
+
+	body, err := io.ReadAll(recorder.Body)
+	requires.NoError(err)
+	var response Response
+	err = json.Unmarshal(body, &response)
+	requires.NoError(err)
+	b, err := json.Marshal(response.Data)
+	requires.NoError(err)
+	var job domain.Job
+	err = json.Unmarshal(b, &job)
+	requires.NoError(err)
+	requires.True(validateUUID(job.ID))
+	requires.Equal(utils.JobStatusPending, job.Status)
+	requires.Equal(fmt.Sprintf("/api/v0/jobs/%s", job.ID), recorder.Header().Get("Location"))
+
+	requires.Eventually(func() bool {
+		request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v0/jobs/%s", job.ID), nil)
+		requires.NoError(err)
+		rr := httptest.NewRecorder()
+		server.Routes().ServeHTTP(rr, request)
+		requires.Equal(http.StatusOK, rr.Code)
+
+		var response Response
+		requires.NoError(json.Unmarshal(rr.Body.Bytes(), &response))
+		b, err := json.Marshal(response.Data)
+		requires.NoError(err)
+		requires.NoError(json.Unmarshal(b, &job))
+		return job.Status == utils.JobStatusSucceeded
+	}, 10*time.Second, 20*time.Millisecond)
+	requires.NotNil(job.Device)
+	requires.Equal(id.String(), job.Device.ID)
+	requires.Equal(utils.Algorithms[0], job.Device.Algorithm)
+	requires.Equal(0, job.Device.SignatureCounter)
+
+	recorder = createSignatureDeviceAsync(t, server, &domain.SignatureDeviceRequest{
+		ID:        id.String(),
+		Algorithm: utils.Algorithms[0],
+	})
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+}
+
+func TestGetJob(t *testing.T) {
+	requires := require.New(t)
+	id, _ := uuid.NewRandom()
+	testCases := []struct {
+		name          string
+		method        string
+		id            string
+		checkResponse func(*httptest.ResponseRecorder)
+	}{
+		{
+			name:   "GetJob_NOT_FOUND",
+			method: http.MethodGet,
+			id:     id.String(),
+			checkResponse: func(rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusNotFound, rr.Code)
+
+				messages := problemMessages(t, rr.Body.Bytes())
+				requires.Len(messages, 1)
+				requires.Equal(utils.ErrJobNotFound.Error(), messages[0])
+			},
+		},
+		{
+			name:   "GetJob_BAD_REQUEST",
+			method: http.MethodGet,
+			id:     utils.RandomString(12),
+			checkResponse: func(rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusBadRequest, rr.Code)
+
+				messages := problemMessages(t, rr.Body.Bytes())
+				requires.Len(messages, 1)
+				requires.Equal(utils.ErrInvalidJobId.Error(), messages[0])
+			},
+		},
+		{
+			name:   "GetJob_METHOD_NOT_ALLOWED",
+			method: http.MethodDelete,
+			id:     id.String(),
+			checkResponse: func(rr *httptest.ResponseRecorder) {
+				requires.Equal(http.StatusMethodNotAllowed, rr.Code)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer(config)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/api/v0/jobs/%s", tc.id)
+
+			request, err := http.NewRequest(tc.method, url, nil)
+			requires.NoError(err)
+
+			server.Routes().ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+type jwtTestKeys struct {
+	rsa     *rsa.PrivateKey
+	ecdsa   *ecdsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+// newJWTTestConfig writes the RSA and EC keys to a JWKS file and the Ed25519
+// key to a PEM file and returns a config that trusts both.
+func newJWTTestConfig(t *testing.T) (*utils.Config, *jwtTestKeys) {
+	requires := require.New(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	requires.NoError(err)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	requires.NoError(err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	requires.NoError(err)
+
+	encode := base64.RawURLEncoding.EncodeToString
+	jwks := map[string]any{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecdsaKey.X.FillBytes(make([]byte, 32))), "y": encode(ecdsaKey.Y.FillBytes(make([]byte, 32)))},
+		},
+	}
+	dir := t.TempDir()
+	jwksFile := filepath.Join(dir, "jwks.json")
+	b, err := json.Marshal(jwks)
+	requires.NoError(err)
+	requires.NoError(os.WriteFile(jwksFile, b, 0600))
+
+	publicKey, err := x509.MarshalPKIXPublicKey(ed25519Key.Public())
+	requires.NoError(err)
+	pemFile := filepath.Join(dir, "ed25519.pem")
+	requires.NoError(os.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0600))
+
+	config := &utils.Config{
+		ServerAddress: ":0",
+		AESKey:        []byte("1234567890123456"),
+		JWT: utils.JWTConfig{
+			JWKSFile:   jwksFile,
+			PublicKeys: map[string]string{"ed": pemFile},
+			Issuer:     "https://issuer.example",
+			Audience:   "signature-service",
+		},
+	}
+	return config, &jwtTestKeys{rsa: rsaKey, ecdsa: ecdsaKey, ed25519: ed25519Key}
+}
+
+func signJWT(t *testing.T, algorithm, kid string, key crypto.Signer, claims map[string]any) string {
+	requires := require.New(t)
+	header, err := json.Marshal(map[string]string{"alg": algorithm, "kid": kid, "typ": "JWT"})
+	requires.NoError(err)
+	payload, err := json.Marshal(claims)
+	requires.NoError(err)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		hashed := sha256.Sum256([]byte(signingInput))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hashed[:])
+	case *ecdsa.PrivateKey:
+		hashed := sha256.Sum256([]byte(signingInput))
+		r, s, signErr := ecdsa.Sign(rand.Reader, k, hashed[:])
+		err = signErr
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(signingInput))
+	}
+	requires.NoError(err)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims(scopes ...string) map[string]any {
+	return map[string]any{
+		"sub":   "billing-service",
+		"iss":   "https://issuer.example",
+		"aud":   []string{"signature-service"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": strings.Join(scopes, " "),
+	}
+}
+
+func serveWithBearer(t *testing.T, handler http.Handler, method, url, token string, payload any) *httptest.ResponseRecorder {
+	requires := require.New(t)
+	body := &strings.Builder{}
+	if payload != nil {
+		requires.NoError(json.NewEncoder(body).Encode(payload))
+	}
+	request, err := http.NewRequest(method, url, strings.NewReader(body.String()))
+	requires.NoError(err)
+	request.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	requires := require.New(t)
+	config, keys := newJWTTestConfig(t)
+	handler := NewServer(config).Routes()
+
+	expired := validClaims(utils.ScopeDevicesRead)
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongAudience := validClaims(utils.ScopeDevicesRead)
+	wrongAudience["aud"] = "other-service"
+	wrongIssuer := validClaims(utils.ScopeDevicesRead)
+	wrongIssuer["iss"] = "https://attacker.example"
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	requires.NoError(err)
+
+	testCases := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{name: "JWT_RS256_OK", token: signJWT(t, "RS256", "rsa", keys.rsa, validClaims(utils.ScopeDevicesRead)), code: http.StatusOK},
+		{name: "JWT_ES256_OK", token: signJWT(t, "ES256", "ec", keys.ecdsa, validClaims(utils.ScopeDevicesRead)), code: http.StatusOK},
+		{name: "JWT_EdDSA_OK", token: signJWT(t, "EdDSA", "ed", keys.ed25519, validClaims(utils.ScopeDevicesRead)), code: http.StatusOK},
+		{name: "JWT_Without_Kid_OK", token: signJWT(t, "ES256", "", keys.ecdsa, validClaims(utils.ScopeDevicesRead)), code: http.StatusOK},
+		{name: "JWT_Unknown_Key", token: signJWT(t, "ES256", "ec", otherKey, validClaims(utils.ScopeDevicesRead)), code: http.StatusUnauthorized},
+		{name: "JWT_Algorithm_Mismatch", token: signJWT(t, "ES256", "rsa", keys.ecdsa, validClaims(utils.ScopeDevicesRead)), code: http.StatusUnauthorized},
+		{name: "JWT_Expired", token: signJWT(t, "RS256", "rsa", keys.rsa, expired), code: http.StatusUnauthorized},
+		{name: "JWT_Wrong_Audience", token: signJWT(t, "RS256", "rsa", keys.rsa, wrongAudience), code: http.StatusUnauthorized},
+		{name: "JWT_Wrong_Issuer", token: signJWT(t, "RS256", "rsa", keys.rsa, wrongIssuer), code: http.StatusUnauthorized},
+		{name: "JWT_Malformed", token: "not.a.token", code: http.StatusUnauthorized},
+		{name: "JWT_Missing_Scope", token: signJWT(t, "RS256", "rsa", keys.rsa, validClaims(utils.ScopeTransactionsSign)), code: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := serveWithBearer(t, handler, http.MethodGet, "/api/v0/signature-devices", tc.token, nil)
+			requires.Equal(tc.code, recorder.Code)
+			switch tc.code {
+			case http.StatusUnauthorized:
+				requires.Equal([]string{utils.ErrInvalidToken.Error()}, problemMessages(t, recorder.Body.Bytes()))
+				requires.Contains(recorder.Header().Get("WWW-Authenticate"), "invalid_token")
+			case http.StatusForbidden:
+				requires.Equal([]string{utils.ErrInsufficientScope.Error()}, problemMessages(t, recorder.Body.Bytes()))
+				requires.Contains(recorder.Header().Get("WWW-Authenticate"), "insufficient_scope")
+			}
+		})
+	}
+}
+
+func TestJWTScopes(t *testing.T) {
+	requires := require.New(t)
+	config, keys := newJWTTestConfig(t)
+	handler := NewServer(config).Routes()
+	id := uuid.NewString()
+	token := func(scopes ...string) string {
+		return signJWT(t, "EdDSA", "ed", keys.ed25519, validClaims(scopes...))
+	}
+	createRequest := &domain.SignatureDeviceRequest{ID: id, Algorithm: utils.Algorithms[1]}
+	signRequest := &domain.SignTransactionRequest{
+		ID:   id,
+		Data: "0_TESTDATA_" + base64.StdEncoding.EncodeToString([]byte(id)),
+	}
+
+	testCases := []struct {
+		name    string
+		method  string
+		url     string
+		scope   string
+		payload any
+		code    int
+	}{
+		{name: "Create_Without_Write", method: http.MethodPost, url: "/api/v0/signature-devices", scope: utils.ScopeDevicesRead, payload: createRequest, code: http.StatusForbidden},
+		{name: "Create_With_Write", method: http.MethodPost, url: "/api/v0/signature-devices", scope: utils.ScopeDevicesWrite, payload: createRequest, code: http.StatusCreated},
+		{name: "List_Without_Read", method: http.MethodGet, url: "/api/v0/signature-devices", scope: utils.ScopeDevicesWrite, code: http.StatusForbidden},
+		{name: "List_With_Read", method: http.MethodGet, url: "/api/v0/signature-devices", scope: utils.ScopeDevicesRead, code: http.StatusOK},
+		{name: "Get_Without_Read", method: http.MethodGet, url: "/api/v0/signature-devices/" + id, scope: utils.ScopeTransactionsSign, code: http.StatusForbidden},
+		{name: "Get_With_Read", method: http.MethodGet, url: "/api/v0/signature-devices/" + id, scope: utils.ScopeDevicesRead, code: http.StatusOK},
+		{name: "Job_Without_Read", method: http.MethodGet, url: "/api/v0/jobs/" + uuid.NewString(), scope: utils.ScopeDevicesWrite, code: http.StatusForbidden},
+		{name: "Job_With_Read", method: http.MethodGet, url: "/api/v0/jobs/" + uuid.NewString(), scope: utils.ScopeDevicesRead, code: http.StatusNotFound},
+		{name: "Sign_Without_Sign", method: http.MethodPost, url: "/api/v0/signature-devices/sign", scope: utils.ScopeDevicesWrite, payload: signRequest, code: http.StatusForbidden},
+		{name: "Sign_With_Sign", method: http.MethodPost, url: "/api/v0/signature-devices/sign", scope: utils.ScopeTransactionsSign, payload: signRequest, code: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := serveWithBearer(t, handler, tc.method, tc.url, token(tc.scope), tc.payload)
+			requires.Equal(tc.code, recorder.Code)
+		})
+	}
+}
+
+func TestJWTOwnerAndTenant(t *testing.T) {
+	requires := require.New(t)
+	config, keys := newJWTTestConfig(t)
+	config.APIKeys = []utils.APIKeyConfig{{ID: "key-a", Owner: "billing-service", Secret: "secret-a"}}
+	handler := NewServer(config).Routes()
+	id := uuid.NewString()
+	token := signJWT(t, "EdDSA", "ed", keys.ed25519, validClaims(utils.ScopeDevicesRead))
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "secret-a", &domain.SignatureDeviceRequest{
+		ID:        id,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+
+	// The token subject is the owner ID of the API key, but owners are only
+	// the same for the same credential type.
+	recorder = serveWithBearer(t, handler, http.MethodGet, "/api/v0/signature-devices/"+id, token, nil)
+	requires.Equal(http.StatusNotFound, recorder.Code)
+
+	// Without a tenant claim the token is limited to the default tenant.
+	recorder = serveWithBearer(t, handler, http.MethodGet, "/api/v1/tenants/default/signature-devices", token, nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	recorder = serveWithBearer(t, handler, http.MethodGet, "/api/v1/tenants/tenant-a/signature-devices", token, nil)
+	requires.Equal(http.StatusForbidden, recorder.Code)
+}
@@ -20,14 +20,15 @@ import (
 	"github.com/uwemakan/signing-service/domain"
 	"github.com/uwemakan/signing-service/utils"
 )
-var config = &utils.Config{ServerAddress: ":0", AESKey: []byte("1234567890123456")}
+
+var config = &utils.Config{ServerAddress: ":0", AESKey: []byte("1234567890123456"), InsecureNoAuth: true}
 
 func TestLoadCreateSignatureDevice(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping TestLoadCreateSignatureDevice in short mode.")
 	}
 	var wg sync.WaitGroup
-	server := NewServer(config)
+	handler := NewServer(config).Routes()
 	// You can vary the number of devices
 	numberOfDevices := 100
 	for i := range numberOfDevices {
@@ -51,7 +52,7 @@ func TestLoadCreateSignatureDevice(t *testing.T) {
 			request, err := http.NewRequest(http.MethodPost, url, body)
 			requires.NoError(err)
 
-			server.Handler(recorder, request)
+			handler.ServeHTTP(recorder, request)
 			requires.Equal(http.StatusCreated, recorder.Code)
 		}(t, i)
 	}
@@ -63,7 +64,7 @@ func TestLoadCreateSignatureDevice(t *testing.T) {
 	requires.NoError(err)
 
 	recorder := httptest.NewRecorder()
-	server.Handler(recorder, request)
+	handler.ServeHTTP(recorder, request)
 	requires.Equal(http.StatusOK, recorder.Code)
 
 	body, err := io.ReadAll(recorder.Body)
@@ -80,7 +81,7 @@ func TestLoadCreateSignatureDevice(t *testing.T) {
 	requires.Len(devices, numberOfDevices)
 }
 
-func createSignatureDevice(t *testing.T, server *Server, n int, dch chan time.Duration) *domain.SignatureDevice {
+func createSignatureDevice(t *testing.T, handler http.Handler, n int, dch chan time.Duration) *domain.SignatureDevice {
 	requires := require.New(t)
 	id, _ := uuid.NewRandom()
 	payload := &domain.SignatureDeviceRequest{
@@ -98,7 +99,7 @@ func createSignatureDevice(t *testing.T, server *Server, n int, dch chan time.Du
 	request, err := http.NewRequest(http.MethodPost, url, body)
 	requires.NoError(err)
 	start := time.Now()
-	server.Handler(recorder, request)
+	handler.ServeHTTP(recorder, request)
 	end := time.Now()
 	dch <- end.Sub(start)
 	requires.Equal(http.StatusCreated, recorder.Code)
@@ -127,6 +128,7 @@ func TestLoadSignTransaction(t *testing.T) {
 
 	var wg sync.WaitGroup
 	server := NewServer(config)
+	handler := server.Routes()
 	// You can vary the number of devices and the number of signings
 	numberOfDevices := 100
 	numberOfSignings := 1000
@@ -138,7 +140,7 @@ func TestLoadSignTransaction(t *testing.T) {
 		go func(n int) {
 			defer wg.Done()
 			requires := require.New(t)
-			device := createSignatureDevice(t, server, n, dch)
+			device := createSignatureDevice(t, handler, n, dch)
 			requires.NotNil(device)
 
 			for j := 0; j < numberOfSignings; j++ {
@@ -201,7 +203,7 @@ func TestLoadSignTransaction(t *testing.T) {
 	request, err := http.NewRequest(http.MethodGet, url, nil)
 	requires.NoError(err)
 
-	server.Handler(recorder, request)
+	handler.ServeHTTP(recorder, request)
 	requires.Equal(http.StatusOK, recorder.Code)
 
 	body, err := io.ReadAll(recorder.Body)
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID of a request. IDs sent by callers are kept
+// so that requests can be traced across services, otherwise one is generated.
+const RequestIDHeader = "X-Request-ID"
+
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestLogContextKey struct{}
+
+// requestLog collects what is logged about a request while it is served.
+type requestLog struct {
+	id     string
+	attrs  []slog.Attr
+	errors []string
+}
+
+// requestIDFromContext returns the ID of the request being served, if any.
+func requestIDFromContext(ctx context.Context) string {
+	if log, ok := ctx.Value(requestLogContextKey{}).(*requestLog); ok {
+		return log.id
+	}
+	return ""
+}
+
+// logAttrs adds attributes, such as the device ID, to the log record of the
+// request.
+func logAttrs(request *http.Request, attrs ...slog.Attr) {
+	logContextAttrs(request.Context(), attrs...)
+}
+
+// logContextAttrs adds attributes to the log record of the request or call of
+// ctx.
+func logContextAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if log, ok := ctx.Value(requestLogContextKey{}).(*requestLog); ok {
+		log.attrs = append(log.attrs, attrs...)
+	}
+}
+
+// loggingResponseWriter records the status and errors of a response.
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	log    *requestLog
+	status int
+}
+
+func (w *loggingResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *loggingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// logErrors adds the errors of a response to the log record of the request.
+func logErrors(w http.ResponseWriter, errors ...string) {
+	if lw, ok := w.(*loggingResponseWriter); ok {
+		lw.log.errors = append(lw.log.errors, errors...)
+	}
+}
+
+// outcomeOf classifies a response status for the log.
+func outcomeOf(status int) (string, slog.Level) {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return "error", slog.LevelError
+	case status >= http.StatusBadRequest:
+		return "rejected", slog.LevelWarn
+	default:
+		return "success", slog.LevelInfo
+	}
+}
+
+// LogRequests is a middleware that assigns every request an ID, echoed in
+// the X-Request-ID response header, and logs the outcome of the request once
+// it has been served. Request and response bodies are never logged.
+func (s *Server) LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		log := &requestLog{id: request.Header.Get(RequestIDHeader)}
+		if !requestIdPattern.MatchString(log.id) {
+			log.id = uuid.NewString()
+		}
+		response.Header().Set(RequestIDHeader, log.id)
+		writer := &loggingResponseWriter{ResponseWriter: response, log: log}
+		next.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), requestLogContextKey{}, log)))
+
+		if writer.status == 0 {
+			writer.status = http.StatusOK
+		}
+		outcome, level := outcomeOf(writer.status)
+		attrs := []slog.Attr{
+			slog.String("request_id", log.id),
+			slog.String("method", request.Method),
+			slog.String("path", request.URL.Path),
+			slog.Int("status", writer.status),
+			slog.String("outcome", outcome),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if spanContext := trace.SpanContextFromContext(request.Context()); spanContext.HasTraceID() {
+			attrs = append(attrs, slog.String("trace_id", spanContext.TraceID().String()))
+		}
+		attrs = append(attrs, log.attrs...)
+		if len(log.errors) > 0 {
+			attrs = append(attrs, slog.Any("errors", log.errors))
+		}
+		s.logger.LogAttrs(request.Context(), level, "request served", attrs...)
+	})
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func TestMetrics(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(authConfig).Routes()
+	id := uuid.NewString()
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "secret-a", &domain.SignatureDeviceRequest{
+		ID:        id,
+		Algorithm: "ECC",
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "secret-a", &domain.SignTransactionRequest{
+		ID:   id,
+		Data: "0_TESTDATA_" + base64.StdEncoding.EncodeToString([]byte(id)),
+	})
+	requires.Equal(http.StatusOK, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "secret-a", &domain.SignTransactionRequest{
+		ID:   id,
+		Data: "7_TESTDATA_" + base64.StdEncoding.EncodeToString([]byte(id)),
+	})
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "secret-a", &domain.SignTransactionRequest{
+		ID:   uuid.NewString(),
+		Data: "0_TESTDATA_x",
+	})
+	requires.Equal(http.StatusNotFound, recorder.Code)
+
+	// Metrics are public, like the health check.
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, "/metrics", "", nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	for _, line := range []string{
+		`signing_service_devices_created_total{algorithm="ECC"} 1`,
+		`signing_service_devices_created_total{algorithm="RSA"} 0`,
+		`signing_service_signatures_total{algorithm="ECC",outcome="success"} 1`,
+		`signing_service_signatures_total{algorithm="ECC",outcome="invalid_signature_counter"} 1`,
+		`signing_service_signatures_total{algorithm="RSA",outcome="device_expired"} 0`,
+		`signing_service_signatures_total{algorithm="unknown",outcome="device_not_found"} 1`,
+		`signing_service_key_generation_seconds_count{algorithm="ECC"} 1`,
+		`signing_service_private_key_decryption_seconds_count 1`,
+		`signing_service_signing_seconds_count{algorithm="ECC"} 1`,
+		`signing_service_repository_operation_seconds_count{operation="CreateDevice"} 1`,
+		`signing_service_http_requests_in_flight{route="/api/v0/signature-devices/sign"} 0`,
+		`signing_service_http_requests_in_flight{route="/metrics"} 1`,
+		`go_goroutines`,
+	} {
+		requires.Contains(body, line)
+	}
+	// Every error has an outcome.
+	for _, code := range utils.ErrorCodes() {
+		requires.Contains(body, `signing_service_signatures_total{algorithm="ECC",outcome="`+code+`"}`)
+	}
+}
+
+func TestCountInFlight(t *testing.T) {
+	requires := require.New(t)
+	server := NewServer(config)
+	gauge := server.metrics.RequestsInFlight.WithLabelValues("/test")
+
+	handler := server.CountInFlight("/test", http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		requires.Equal(1.0, testutil.ToFloat64(gauge))
+		response.WriteHeader(http.StatusNoContent)
+	}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/test", nil))
+	requires.Equal(http.StatusNoContent, recorder.Code)
+	requires.Zero(testutil.ToFloat64(gauge))
+}
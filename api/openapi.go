@@ -0,0 +1,19 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPIDocument is the OpenAPI 3.1 document describing the routes of the
+// service.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// OpenAPI serves the OpenAPI document of the service.
+func (s *Server) OpenAPI(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Content-Type", "application/json")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.Write(openAPIDocument)
+}
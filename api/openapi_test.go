@@ -0,0 +1,379 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// openAPIURL is the URL the OpenAPI document is compiled under.
+const openAPIURL = "https://signing-service/openapi.json"
+
+// specReplay is set while TestOpenAPIConformance replays the device tests,
+// having serve check their requests and responses against the OpenAPI
+// document.
+var specReplay bool
+
+// openAPISpec is the parsed OpenAPI document. Schemas are compiled by the
+// JSON pointer of their location in the document.
+type openAPISpec struct {
+	document map[string]any
+	compiler *jsonschema.Compiler
+	schemas  map[string]*jsonschema.Schema
+	mu       sync.Mutex
+}
+
+var loadOpenAPISpec = sync.OnceValues(func() (*openAPISpec, error) {
+	document, err := jsonschema.UnmarshalJSON(bytes.NewReader(openAPIDocument))
+	if err != nil {
+		return nil, err
+	}
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft2020)
+	compiler.AssertFormat()
+	if err := compiler.AddResource(openAPIURL, document); err != nil {
+		return nil, err
+	}
+	return &openAPISpec{document: document.(map[string]any), compiler: compiler, schemas: make(map[string]*jsonschema.Schema)}, nil
+})
+
+// escapePointer escapes a token of a JSON pointer.
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// at returns the value at pointer, or nil when there is none.
+func (s *openAPISpec) at(pointer string) any {
+	var value any = s.document
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		switch node := value.(type) {
+		case map[string]any:
+			value = node[strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")]
+		case []any:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil
+			}
+			value = node[index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// resolve follows the reference of the object at pointer, if any.
+func (s *openAPISpec) resolve(pointer string) string {
+	if object, ok := s.at(pointer).(map[string]any); ok {
+		if ref, ok := object["$ref"].(string); ok {
+			return s.resolve(strings.TrimPrefix(ref, "#"))
+		}
+	}
+	return pointer
+}
+
+// validate validates instance against the schema at pointer.
+func (s *openAPISpec) validate(pointer string, instance any) error {
+	s.mu.Lock()
+	schema, exists := s.schemas[pointer]
+	if !exists {
+		var err error
+		schema, err = s.compiler.Compile(openAPIURL + "#" + pointer)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		s.schemas[pointer] = schema
+	}
+	s.mu.Unlock()
+	return schema.Validate(instance)
+}
+
+// match returns the pointer of the path item serving path and the values of
+// its path parameters. Paths are prefixed with the URLs of their servers and
+// server variables match a path segment like path parameters. Paths with
+// more literal segments take precedence.
+func (s *openAPISpec) match(path string) (string, map[string]string, bool) {
+	var item string
+	var params map[string]string
+	most := -1
+	for name := range s.at("/paths").(map[string]any) {
+		pointer := "/paths/" + escapePointer(name)
+		servers, _ := s.at(pointer + "/servers").([]any)
+		if servers == nil {
+			servers = s.at("/servers").([]any)
+		}
+		for _, server := range servers {
+			url := server.(map[string]any)["url"].(string)
+			values, literals, ok := matchTemplate(strings.TrimSuffix(url, "/")+name, path)
+			if ok && literals > most {
+				item, params, most = pointer, values, literals
+			}
+		}
+	}
+	return item, params, most >= 0
+}
+
+// matchTemplate matches path against a path template, returning the values
+// of its {parameters} and the number of literal segments.
+func matchTemplate(template, path string) (map[string]string, int, bool) {
+	templateSegments, segments := strings.Split(template, "/"), strings.Split(path, "/")
+	if len(templateSegments) != len(segments) {
+		return nil, 0, false
+	}
+	values := make(map[string]string)
+	literals := 0
+	for i, segment := range templateSegments {
+		if name, found := strings.CutPrefix(segment, "{"); found && segments[i] != "" {
+			values[strings.TrimSuffix(name, "}")] = segments[i]
+			continue
+		}
+		if segment != segments[i] {
+			return nil, 0, false
+		}
+		literals++
+	}
+	return values, literals, true
+}
+
+// validateRequest validates the parameters and the body of a request against
+// the operation at pointer.
+func (s *openAPISpec) validateRequest(operation string, request *http.Request, pathParams map[string]string, body []byte) error {
+	item := operation[:strings.LastIndex(operation, "/")]
+	for _, parameters := range []string{item + "/parameters", operation + "/parameters"} {
+		list, _ := s.at(parameters).([]any)
+		for i := range list {
+			parameter := s.resolve(fmt.Sprintf("%s/%d", parameters, i))
+			name, in := s.at(parameter+"/name").(string), s.at(parameter+"/in").(string)
+			var value string
+			var present bool
+			switch in {
+			case "path":
+				value, present = pathParams[name]
+			case "query":
+				present = request.URL.Query().Has(name)
+				value = request.URL.Query().Get(name)
+			default:
+				continue
+			}
+			if !present {
+				if required, _ := s.at(parameter + "/required").(bool); required {
+					return fmt.Errorf("%s parameter %s is required", in, name)
+				}
+				continue
+			}
+			var instance any = value
+			switch s.at(s.resolve(parameter+"/schema") + "/type") {
+			case "integer":
+				number, err := strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("%s parameter %s: %w", in, name, err)
+				}
+				instance = json.Number(strconv.Itoa(number))
+			case "boolean":
+				boolean, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("%s parameter %s: %w", in, name, err)
+				}
+				instance = boolean
+			}
+			if err := s.validate(parameter+"/schema", instance); err != nil {
+				return fmt.Errorf("%s parameter %s: %w", in, name, err)
+			}
+		}
+	}
+	if s.at(operation+"/requestBody") == nil {
+		return nil
+	}
+	requestBody := s.resolve(operation + "/requestBody")
+	if len(bytes.TrimSpace(body)) == 0 {
+		if required, _ := s.at(requestBody + "/required").(bool); required {
+			return fmt.Errorf("request body is required")
+		}
+		return nil
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return s.validate(requestBody+"/content/application~1json/schema", instance)
+}
+
+// validateResponse validates the status, the media type and the body of a
+// response against the operation at pointer.
+func (s *openAPISpec) validateResponse(operation string, recorder *httptest.ResponseRecorder) error {
+	status := strconv.Itoa(recorder.Code)
+	var response string
+	for _, key := range []string{status, status[:1] + "XX", "default"} {
+		if s.at(operation+"/responses/"+key) != nil {
+			response = s.resolve(operation + "/responses/" + key)
+			break
+		}
+	}
+	if response == "" {
+		return fmt.Errorf("status %s is not documented", status)
+	}
+	content, _ := s.at(response + "/content").(map[string]any)
+	if content == nil {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(recorder.Result().Header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("status %s: %w", status, err)
+	}
+	if _, exists := content[mediaType]; !exists {
+		return fmt.Errorf("status %s: media type %s is not documented", status, mediaType)
+	}
+	if !strings.HasSuffix(mediaType, "json") {
+		return nil
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(recorder.Body.Bytes()))
+	if err != nil {
+		return fmt.Errorf("status %s: %w", status, err)
+	}
+	if err := s.validate(response+"/content/"+escapePointer(mediaType)+"/schema", instance); err != nil {
+		return fmt.Errorf("status %s: %w", status, err)
+	}
+	return nil
+}
+
+// checkOpenAPI checks a request and its response against the OpenAPI
+// document. Requests the document considers invalid must be rejected with
+// 400 Bad Request or 422 Unprocessable Entity, requests on undocumented paths
+// and methods with 404 Not Found and 405 Method Not Allowed.
+func checkOpenAPI(t *testing.T, request *http.Request, body []byte, recorder *httptest.ResponseRecorder) {
+	t.Helper()
+	requires := require.New(t)
+	spec, err := loadOpenAPISpec()
+	requires.NoError(err)
+	name := request.Method + " " + request.URL.Path
+
+	item, pathParams, found := spec.match(request.URL.Path)
+	if !found {
+		requires.Equal(http.StatusNotFound, recorder.Code, "%s is not documented", name)
+		return
+	}
+	method := strings.ToLower(request.Method)
+	if method == "head" {
+		method = "get"
+	}
+	operation := item + "/" + method
+	if spec.at(operation) == nil {
+		requires.Equal(http.StatusMethodNotAllowed, recorder.Code, "%s is not documented", name)
+		return
+	}
+	if err := spec.validateRequest(operation, request, pathParams, body); err != nil {
+		requires.Contains([]int{http.StatusBadRequest, http.StatusUnprocessableEntity}, recorder.Code, "%s is invalid: %v", name, err)
+	}
+	requires.NoError(spec.validateResponse(operation, recorder), name)
+}
+
+// serve serves request with handler. While TestOpenAPIConformance replays
+// the device tests, the request and the response are checked against the
+// OpenAPI document.
+func serve(t *testing.T, handler http.Handler, recorder *httptest.ResponseRecorder, request *http.Request) {
+	t.Helper()
+	if !specReplay {
+		handler.ServeHTTP(recorder, request)
+		return
+	}
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = io.ReadAll(request.Body)
+		require.NoError(t, err)
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	handler.ServeHTTP(recorder, request)
+	checkOpenAPI(t, request, body, recorder)
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(config).Routes()
+
+	recorder := serveWithAPIKey(t, handler, http.MethodGet, "/api/openapi.json", "", nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	requires.Equal("application/json", recorder.Header().Get("Content-Type"))
+	requires.Equal(openAPIDocument, recorder.Body.Bytes())
+
+	spec, err := loadOpenAPISpec()
+	requires.NoError(err)
+	requires.Equal("3.1.0", spec.at("/openapi"))
+	for name := range spec.at("/components/schemas").(map[string]any) {
+		_, err := spec.compiler.Compile(openAPIURL + "#/components/schemas/" + name)
+		requires.NoError(err, name)
+	}
+
+	// The documented error codes are the codes of the errors of utils.
+	var codes []string
+	for _, code := range spec.at("/components/schemas/ErrorCode/enum").([]any) {
+		codes = append(codes, code.(string))
+	}
+	requires.Equal(utils.ErrorCodes(), codes)
+
+	// Every documented operation is served.
+	for name := range spec.at("/paths").(map[string]any) {
+		item := "/paths/" + escapePointer(name)
+		servers, _ := spec.at(item + "/servers").([]any)
+		if servers == nil {
+			servers = spec.at("/servers").([]any)
+		}
+		for method := range spec.at(item).(map[string]any) {
+			if !slices.Contains([]string{"get", "post", "put", "patch", "delete"}, method) {
+				continue
+			}
+			for _, server := range servers {
+				url := strings.TrimSuffix(server.(map[string]any)["url"].(string), "/") + name
+				url = strings.NewReplacer("{tenant}", utils.DefaultTenant, "{id}", uuid.NewString()).Replace(url)
+				recorder := serveWithAPIKey(t, handler, strings.ToUpper(method), url, "", nil)
+				requires.NotEqual(http.StatusMethodNotAllowed, recorder.Code, "%s %s", method, url)
+				if recorder.Code == http.StatusNotFound {
+					requires.Equal(problemContentType, recorder.Header().Get("Content-Type"), "%s %s is not routed", method, url)
+				}
+			}
+		}
+	}
+}
+
+// TestOpenAPIConformance replays the device tests, checking that their
+// requests and the responses conform to the OpenAPI document.
+func TestOpenAPIConformance(t *testing.T) {
+	specReplay = true
+	defer func() { specReplay = false }()
+
+	tests := []struct {
+		name string
+		test func(*testing.T)
+	}{
+		{name: "SignatureDevicesMethodNotAllowed", test: TestSignatureDevicesMethodNotAllowed},
+		{name: "CreateSignatureDevice", test: TestCreateSignatureDevice},
+		{name: "ListSignatureDevices", test: TestListSignatureDevices},
+		{name: "ListSignatureDevicesQuery", test: TestListSignatureDevicesQuery},
+		{name: "GetSignatureDevice", test: TestGetSignatureDevice},
+		{name: "SignTransaction", test: TestSignTransaction},
+		{name: "UpdateSignatureDevice", test: TestUpdateSignatureDevice},
+		{name: "RotateDeviceKey", test: TestRotateDeviceKey},
+		{name: "VerifySignature", test: TestVerifySignature},
+		{name: "CreateSignatureDeviceImport", test: TestCreateSignatureDeviceImport},
+		{name: "UpdateSignatureDeviceDetails", test: TestUpdateSignatureDeviceDetails},
+		{name: "SignTransactionLimits", test: TestSignTransactionLimits},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, tc.test)
+	}
+}
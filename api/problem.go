@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// problemContentType is the media type of problem details (RFC 7807).
+const problemContentType = "application/problem+json"
+
+// problemTypePrefix prefixes the error code to form the type of a problem.
+const problemTypePrefix = "urn:signing-service:problem:"
+
+// Problem is an error response in the problem details format of RFC 7807.
+// Code is the stable, machine readable code of the error that clients match
+// on. InvalidParams lists the fields of invalid requests with the reason each
+// is invalid.
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	Code          string         `json:"code"`
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+}
+
+// InvalidParam is a field of a request, or a query parameter, that is invalid.
+type InvalidParam struct {
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// kindStatuses are the HTTP statuses errors are answered with by kind.
+// Errors of other kinds are internal errors.
+var kindStatuses = map[utils.ErrorKind]int{
+	utils.KindInvalid:          http.StatusBadRequest,
+	utils.KindUnprocessable:    http.StatusUnprocessableEntity,
+	utils.KindUnauthenticated:  http.StatusUnauthorized,
+	utils.KindForbidden:        http.StatusForbidden,
+	utils.KindNotFound:         http.StatusNotFound,
+	utils.KindMethodNotAllowed: http.StatusMethodNotAllowed,
+	utils.KindConflict:         http.StatusConflict,
+	utils.KindGone:             http.StatusGone,
+	utils.KindRateLimited:      http.StatusTooManyRequests,
+	utils.KindUnavailable:      http.StatusServiceUnavailable,
+	utils.KindTimeout:          http.StatusGatewayTimeout,
+	utils.KindCanceled:         statusClientClosedRequest,
+}
+
+// statusOf returns the HTTP status err is answered with.
+func statusOf(err error) int {
+	if status, exists := kindStatuses[utils.ErrorKindOf(err)]; exists {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+type legacyErrorsContextKey struct{}
+
+// ErrorFormat is a middleware that has errors written in the v0 format, a
+// list of messages, when legacy error responses are configured. Otherwise
+// they are written as problem details.
+func (s *Server) ErrorFormat(next http.Handler) http.Handler {
+	if !s.config.LegacyErrorResponses {
+		return next
+	}
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		next.ServeHTTP(response, request.WithContext(context.WithValue(request.Context(), legacyErrorsContextKey{}, true)))
+	})
+}
+
+// HandleError answers a request with the status matching the kind of err,
+// which may wrap one of the errors of utils. Only the log learns about the
+// cause of internal errors. Callers that are rate limited are told when to
+// retry.
+func HandleError(w http.ResponseWriter, r *http.Request, err error) {
+	var limited *utils.RateLimitedError
+	if errors.As(err, &limited) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+	}
+	status := statusOf(err)
+	if status == http.StatusInternalServerError {
+		logErrors(w, err.Error())
+		detail := http.StatusText(http.StatusInternalServerError)
+		writeError(w, r, &Problem{Status: status, Code: utils.ErrorInternal, Detail: detail}, []string{detail})
+		return
+	}
+	writeError(w, r, &Problem{Status: status, Code: utils.ErrorCode(err), Detail: err.Error()}, []string{err.Error()})
+}
+
+// WriteValidationErrors answers a request with invalid fields with 400 Bad
+// Request.
+func WriteValidationErrors(w http.ResponseWriter, r *http.Request, params []InvalidParam) {
+	reasons := make([]string, len(params))
+	for i, param := range params {
+		reasons[i] = param.Reason
+	}
+	writeError(w, r, &Problem{
+		Status:        http.StatusBadRequest,
+		Code:          utils.ErrorCode(utils.ErrInvalidRequest),
+		Detail:        utils.ErrInvalidRequest.Error(),
+		InvalidParams: params,
+	}, reasons)
+}
+
+// WriteMalformedRequest answers a request whose body could not be decoded
+// with 422 Unprocessable Entity.
+func WriteMalformedRequest(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, &Problem{
+		Status: http.StatusUnprocessableEntity,
+		Code:   utils.ErrorCode(utils.ErrMalformedRequest),
+		Detail: utils.ErrMalformedRequest.Error() + ": " + err.Error(),
+	}, []string{http.StatusText(http.StatusUnprocessableEntity)})
+}
+
+// WriteMethodNotAllowed answers a request with a method the route doesn't
+// serve with 405 Method Not Allowed.
+func WriteMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, &Problem{
+		Status: http.StatusMethodNotAllowed,
+		Code:   utils.ErrorCode(utils.ErrMethodNotAllowed),
+		Detail: utils.ErrMethodNotAllowed.Error(),
+	}, []string{http.StatusText(http.StatusMethodNotAllowed)})
+}
+
+// writeError writes problem, completing its type, title and instance, or
+// the legacy errors in the v0 format when legacy error responses are
+// configured. Problems are identified by the ID of the request.
+func writeError(w http.ResponseWriter, r *http.Request, problem *Problem, legacyErrors []string) {
+	if legacy, _ := r.Context().Value(legacyErrorsContextKey{}).(bool); legacy {
+		WriteErrorResponse(w, problem.Status, legacyErrors)
+		return
+	}
+	logErrors(w, problem.Detail)
+	problem.Type = problemTypePrefix + problem.Code
+	problem.Title = http.StatusText(problem.Status)
+	if problem.Status == statusClientClosedRequest {
+		problem.Title = "Client Closed Request"
+	}
+	if id := requestIDFromContext(r.Context()); id != "" {
+		problem.Instance = "urn:request:" + id
+	}
+	bytes, err := json.Marshal(problem)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(bytes)
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// decodeProblem decodes the problem details of an error response.
+func decodeProblem(t *testing.T, body []byte) *Problem {
+	var problem Problem
+	require.NoError(t, json.Unmarshal(body, &problem))
+	return &problem
+}
+
+// problemMessages returns what a problem reports as wrong: the reasons of its
+// invalid params, or its detail.
+func problemMessages(t *testing.T, body []byte) []string {
+	problem := decodeProblem(t, body)
+	if len(problem.InvalidParams) == 0 {
+		return []string{problem.Detail}
+	}
+	reasons := make([]string, len(problem.InvalidParams))
+	for i, param := range problem.InvalidParams {
+		reasons[i] = param.Reason
+	}
+	return reasons
+}
+
+func TestProblemDetails(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(config).Routes()
+
+	recorder := serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices/"+uuid.NewString(), "", nil)
+	requires.Equal(http.StatusNotFound, recorder.Code)
+	requires.Equal("application/problem+json", recorder.Header().Get("Content-Type"))
+	requires.Equal(&Problem{
+		Type:     "urn:signing-service:problem:device_not_found",
+		Title:    "Not Found",
+		Status:   http.StatusNotFound,
+		Detail:   utils.ErrDeviceNotFound.Error(),
+		Instance: "urn:request:" + recorder.Header().Get(RequestIDHeader),
+		Code:     "device_not_found",
+	}, decodeProblem(t, recorder.Body.Bytes()))
+
+	// Every invalid field is reported by name.
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{
+		ID:        "not-a-uuid",
+		Algorithm: "DSA",
+		Metadata:  map[string]string{"bad key": "value"},
+	})
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+	problem := decodeProblem(t, recorder.Body.Bytes())
+	requires.Equal("invalid_request", problem.Code)
+	requires.Equal([]InvalidParam{
+		{Name: "id", Reason: "invalid device id: not-a-uuid is not a valid UUID"},
+		{Name: "algorithm", Reason: fmt.Sprintf("algorithm must be one of %s", utils.Algorithms)},
+		{Name: "metadata.bad key", Reason: fmt.Sprintf("invalid metadata key %q: keys must be 1-%d letters, digits, dots, dashes or underscores", "bad key", utils.MaxMetadataKeyLength)},
+	}, problem.InvalidParams)
+
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices?limit=0&order=up", "", nil)
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+	problem = decodeProblem(t, recorder.Body.Bytes())
+	requires.Equal([]string{"order", "limit"}, []string{problem.InvalidParams[0].Name, problem.InvalidParams[1].Name})
+
+	recorder = serveWithAPIKey(t, handler, http.MethodPut, "/api/v0/jobs/"+uuid.NewString(), "", nil)
+	requires.Equal(http.StatusMethodNotAllowed, recorder.Code)
+	requires.Equal("method_not_allowed", decodeProblem(t, recorder.Body.Bytes()).Code)
+}
+
+func TestHandleError(t *testing.T) {
+	requires := require.New(t)
+	testCases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{utils.ErrDeviceNotFound, http.StatusNotFound, "device_not_found"},
+		// Wrapped errors are answered like the error they wrap.
+		{fmt.Errorf("restoring device 3: %w", utils.ErrDeviceAlreadyExists), http.StatusBadRequest, "device_already_exists"},
+		{fmt.Errorf("signing: %w", utils.ErrSignatureQuotaExhausted), http.StatusConflict, "signature_quota_exhausted"},
+		{utils.ErrTenantDeviceLimit, http.StatusForbidden, "tenant_device_limit"},
+		{utils.ErrDeviceExpired, http.StatusGone, "device_expired"},
+		{utils.ErrJobQueueFull, http.StatusServiceUnavailable, "job_queue_full"},
+		{fmt.Errorf("waiting: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "deadline_exceeded"},
+		{utils.ErrInvalidCiphertext, http.StatusInternalServerError, utils.ErrorInternal},
+		{fmt.Errorf("disk on fire"), http.StatusInternalServerError, utils.ErrorInternal},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.code, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			HandleError(recorder, httptest.NewRequest(http.MethodGet, "/", nil), tc.err)
+			requires.Equal(tc.status, recorder.Code)
+			problem := decodeProblem(t, recorder.Body.Bytes())
+			requires.Equal(tc.code, problem.Code)
+			requires.Equal(tc.status, problem.Status)
+			if tc.status == http.StatusInternalServerError {
+				// The cause of internal errors is not disclosed.
+				requires.Equal(http.StatusText(http.StatusInternalServerError), problem.Detail)
+			} else {
+				requires.Equal(tc.err.Error(), problem.Detail)
+			}
+		})
+	}
+}
+
+func TestLegacyErrorResponses(t *testing.T) {
+	requires := require.New(t)
+	legacyConfig := *config
+	legacyConfig.LegacyErrorResponses = true
+	handler := NewServer(&legacyConfig).Routes()
+
+	recorder := serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices/"+uuid.NewString(), "", nil)
+	requires.Equal(http.StatusNotFound, recorder.Code)
+	requires.JSONEq(`{"errors":["device not found"]}`, recorder.Body.String())
+
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{})
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+	var response ErrorResponse
+	requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	requires.Equal([]string{
+		"invalid device id:  is not a valid UUID",
+		fmt.Sprintf("algorithm must be one of %s", utils.Algorithms),
+	}, response.Errors)
+
+	recorder = serveWithAPIKey(t, handler, http.MethodPut, "/api/v0/jobs/"+uuid.NewString(), "", nil)
+	requires.Equal(http.StatusMethodNotAllowed, recorder.Code)
+	requires.JSONEq(`{"errors":["Method Not Allowed"]}`, recorder.Body.String())
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uwemakan/signing-service/metrics"
+	"github.com/uwemakan/signing-service/utils"
+	"golang.org/x/time/rate"
+)
+
+// rateLimitSweepInterval is how often buckets that have refilled are dropped.
+// A full bucket behaves like a new one, so dropping it loses no state.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter holds a token bucket per key. Keys without an override share
+// the default limit.
+type rateLimiter struct {
+	name      string
+	limit     utils.RateLimit
+	overrides map[string]utils.RateLimit
+	clock     utils.Clock
+	metrics   *metrics.Metrics
+	buckets   map[string]*rate.Limiter
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func newRateLimiter(name string, limit utils.RateLimit, overrides map[string]utils.RateLimit, clock utils.Clock, m *metrics.Metrics) *rateLimiter {
+	return &rateLimiter{
+		name:      name,
+		limit:     limit,
+		overrides: overrides,
+		clock:     clock,
+		metrics:   m,
+		buckets:   make(map[string]*rate.Limiter),
+		lastSweep: clock.Now(),
+	}
+}
+
+// limitOf returns the limit of the key, looked up in the overrides by
+// overrideKey.
+func (l *rateLimiter) limitOf(overrideKey string) utils.RateLimit {
+	if limit, exists := l.overrides[overrideKey]; exists {
+		return limit
+	}
+	return l.limit
+}
+
+// allow takes a token from the bucket of key. When the bucket is empty it
+// returns false and how long until a token is available.
+func (l *rateLimiter) allow(key, overrideKey string) (bool, time.Duration) {
+	limit := l.limitOf(overrideKey)
+	if !limit.Enabled() {
+		return true, 0
+	}
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+		l.buckets[key] = bucket
+		l.metrics.RateLimitBucketsChanged(l.name, 1)
+	}
+	reservation := bucket.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		l.metrics.RateLimitChecked(l.name, false)
+		return false, delay
+	}
+	l.metrics.RateLimitChecked(l.name, true)
+	return true, 0
+}
+
+// sweep drops the buckets that have refilled. The caller must hold the lock.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if bucket.TokensAt(now) >= float64(bucket.Burst()) {
+			delete(l.buckets, key)
+			l.metrics.RateLimitBucketsChanged(l.name, -1)
+		}
+	}
+}
+
+// signatureLimiter rate limits the signatures of every device of a tenant. It
+// is the services.SignatureLimiter of the signature service, which only takes
+// a token once the caller was found to be allowed to sign with the device.
+type signatureLimiter struct {
+	*rateLimiter
+}
+
+func (l signatureLimiter) AllowSignature(tenantID, deviceID string) (bool, time.Duration) {
+	return l.allow(tenantID+"/"+deviceID, deviceID)
+}
+
+// callerOf identifies the caller of a request by its principal, or by its
+// remote address when authentication is disabled.
+func callerOf(request *http.Request) string {
+	if principal := principalFromRequest(request); principal != nil {
+		return "principal:" + principal.ID
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	return "address:" + host
+}
+
+// LimitClient is a middleware that rate limits the requests of every caller.
+func (s *Server) LimitClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		caller := callerOf(request)
+		if allowed, retryAfter := s.clientLimiter.allow(caller, caller); !allowed {
+			HandleError(response, request, &utils.RateLimitedError{RetryAfter: retryAfter})
+			return
+		}
+		next.ServeHTTP(response, request)
+	})
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/metrics"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func TestRateLimiter(t *testing.T) {
+	requires := require.New(t)
+	clock := utils.NewFakeClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	m := metrics.New(prometheus.NewRegistry())
+	limiter := newRateLimiter("test", utils.RateLimit{Rate: 1, Burst: 2}, map[string]utils.RateLimit{
+		"unlimited": {},
+		"slow":      {Rate: 0.1, Burst: 1},
+	}, clock, m)
+
+	allowed, _ := limiter.allow("a", "a")
+	requires.True(allowed)
+	allowed, _ = limiter.allow("a", "a")
+	requires.True(allowed)
+	allowed, retryAfter := limiter.allow("a", "a")
+	requires.False(allowed)
+	requires.Equal(time.Second, retryAfter)
+	// Every key has its own bucket.
+	allowed, _ = limiter.allow("b", "b")
+	requires.True(allowed)
+
+	clock.Advance(time.Second)
+	allowed, _ = limiter.allow("a", "a")
+	requires.True(allowed)
+	allowed, _ = limiter.allow("a", "a")
+	requires.False(allowed)
+
+	for range 10 {
+		allowed, _ = limiter.allow("tenant/unlimited", "unlimited")
+		requires.True(allowed)
+	}
+	allowed, _ = limiter.allow("tenant/slow", "slow")
+	requires.True(allowed)
+	allowed, retryAfter = limiter.allow("tenant/slow", "slow")
+	requires.False(allowed)
+	requires.Equal(10*time.Second, retryAfter)
+
+	// Refilled buckets are dropped on the next sweep.
+	requires.Len(limiter.buckets, 3)
+	clock.Advance(rateLimitSweepInterval)
+	allowed, _ = limiter.allow("a", "a")
+	requires.True(allowed)
+	requires.Len(limiter.buckets, 1)
+
+	requires.Equal(6.0, testutil.ToFloat64(m.RateLimitRequests.WithLabelValues("test", "allowed")))
+	requires.Equal(3.0, testutil.ToFloat64(m.RateLimitRequests.WithLabelValues("test", "limited")))
+	requires.Equal(1.0, testutil.ToFloat64(m.RateLimitBuckets.WithLabelValues("test")))
+}
+
+func TestRateLimitRoutes(t *testing.T) {
+	requires := require.New(t)
+	deviceId := uuid.NewString()
+	otherDeviceId := uuid.NewString()
+	rateLimitConfig := *config
+	rateLimitConfig.RateLimits = utils.RateLimitConfig{
+		Client: utils.RateLimit{Rate: 0.01, Burst: 5},
+		Device: utils.RateLimit{Rate: 0.01, Burst: 1},
+		DeviceOverrides: map[string]utils.RateLimit{
+			otherDeviceId: {Rate: 0.01, Burst: 2},
+		},
+	}
+	handler := NewServer(&rateLimitConfig).Routes()
+
+	for _, id := range []string{deviceId, otherDeviceId} {
+		recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{
+			ID:        id,
+			Algorithm: utils.Algorithms[1],
+		})
+		requires.Equal(http.StatusCreated, recorder.Code)
+	}
+	// The device limit applies once the device is found, before the data is
+	// checked, so the invalid signature counter is only reported while
+	// tokens are left.
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "", &domain.SignTransactionRequest{
+		ID:   deviceId,
+		Data: "9_TESTDATA_x",
+	})
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "", &domain.SignTransactionRequest{
+		ID:   deviceId,
+		Data: "9_TESTDATA_x",
+	})
+	requires.Equal(http.StatusTooManyRequests, recorder.Code)
+	requires.Equal("100", recorder.Header().Get("Retry-After"))
+	requires.Equal([]string{utils.ErrRateLimited.Error()}, problemMessages(t, recorder.Body.Bytes()))
+
+	// The other device has its own bucket. Its signature takes the last of
+	// the five tokens of the client, which is limited on any further request.
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "", &domain.SignTransactionRequest{
+		ID:   otherDeviceId,
+		Data: "9_TESTDATA_x",
+	})
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices", "", nil)
+	requires.Equal(http.StatusTooManyRequests, recorder.Code)
+	requires.NotEmpty(recorder.Header().Get("Retry-After"))
+
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, "/metrics", "", nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	for _, line := range []string{
+		`signing_service_rate_limit_requests_total{limiter="device",result="limited"} 1`,
+		`signing_service_rate_limit_requests_total{limiter="client",result="limited"} 1`,
+		`signing_service_rate_limit_buckets{limiter="device"} 2`,
+	} {
+		requires.Contains(recorder.Body.String(), line)
+	}
+}
+
+func TestRateLimitDeviceOwner(t *testing.T) {
+	requires := require.New(t)
+	deviceId := uuid.NewString()
+	rateLimitConfig := *authConfig
+	rateLimitConfig.RateLimits = utils.RateLimitConfig{
+		Device: utils.RateLimit{Rate: 0.01, Burst: 1},
+	}
+	handler := NewServer(&rateLimitConfig).Routes()
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v1/signature-devices", "secret-a", &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+
+	// Callers that can't see the device don't spend its tokens.
+	for range 3 {
+		recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v1/signature-devices/"+deviceId+"/signatures", "secret-b", &domain.SignTransactionRequest{
+			Data: "0_TESTDATA_" + base64.StdEncoding.EncodeToString([]byte(deviceId)),
+		})
+		requires.Equal(http.StatusNotFound, recorder.Code)
+	}
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v1/signature-devices/"+deviceId+"/signatures", "secret-a", &domain.SignTransactionRequest{
+		Data: "0_TESTDATA_" + base64.StdEncoding.EncodeToString([]byte(deviceId)),
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v1/signature-devices/"+deviceId+"/signatures", "secret-a", &domain.SignTransactionRequest{
+		Data: "1_TESTDATA_x",
+	})
+	requires.Equal(http.StatusTooManyRequests, recorder.Code)
+	requires.Equal("100", recorder.Header().Get("Retry-After"))
+}
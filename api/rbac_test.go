@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/services"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func newRBACTestConfig(t *testing.T, assignedDevice string) *utils.Config {
+	requires := require.New(t)
+	policy := services.Policy{
+		Bindings: map[string]services.RoleBinding{
+			"key:key-admin":      {Roles: []string{utils.RoleAdmin}},
+			"key:key-operator":   {Roles: []string{utils.RoleOperator}},
+			"key:key-signer":     {Roles: []string{utils.RoleSigner}, Devices: []string{assignedDevice}},
+			"key:key-signer-two": {Roles: []string{utils.RoleSigner}, Devices: []string{uuid.NewString()}},
+		},
+	}
+	b, err := json.Marshal(policy)
+	requires.NoError(err)
+	path := filepath.Join(t.TempDir(), "policy.json")
+	requires.NoError(os.WriteFile(path, b, 0o600))
+
+	return &utils.Config{
+		ServerAddress: ":0",
+		AESKey:        []byte("1234567890123456"),
+		APIKeys: []utils.APIKeyConfig{
+			{ID: "key-admin", Owner: "merchant", Secret: "secret-admin"},
+			{ID: "key-operator", Owner: "merchant", Secret: "secret-operator"},
+			{ID: "key-signer", Owner: "merchant", Secret: "secret-signer"},
+			{ID: "key-signer-two", Owner: "merchant", Secret: "secret-signer-two"},
+			{ID: "key-unbound", Owner: "merchant", Secret: "secret-unbound"},
+		},
+		RBACPolicyFile: path,
+	}
+}
+
+// signRequest builds a valid sign request for the device's current state.
+func signRequest(t *testing.T, handler http.Handler, id string) *domain.SignTransactionRequest {
+	requires := require.New(t)
+	recorder := serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices/"+id, "secret-admin", nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	var response Response
+	requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	b, err := json.Marshal(response.Data)
+	requires.NoError(err)
+	var device domain.SignatureDevice
+	requires.NoError(json.Unmarshal(b, &device))
+	return &domain.SignTransactionRequest{
+		ID:   id,
+		Data: fmt.Sprintf("%d_TESTDATA_%s", device.SignatureCounter, device.LastSignature),
+	}
+}
+
+func TestRoleBasedAccessControl(t *testing.T) {
+	requires := require.New(t)
+	deviceId := uuid.NewString()
+	handler := NewServer(newRBACTestConfig(t, deviceId)).Routes()
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "secret-admin", &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices?async=true", "secret-admin", &domain.SignatureDeviceRequest{
+		ID:        uuid.NewString(),
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusAccepted, recorder.Code)
+	jobURL := recorder.Header().Get("Location")
+	secret := domain.BackupSecret{Passphrase: "correct horse battery staple"}
+	archive := exportSignatureDevices(t, handler, "/api/v0", "secret-admin", secret)
+
+	type route struct {
+		method  string
+		url     string
+		payload func() any
+	}
+	newDevice := func() any {
+		return &domain.SignatureDeviceRequest{ID: uuid.NewString(), Algorithm: utils.Algorithms[1]}
+	}
+	suspended := utils.DeviceStatusSuspended
+	sign := func() any { return signRequest(t, handler, deviceId) }
+	routes := map[string]route{
+		"List":        {method: http.MethodGet, url: "/api/v0/signature-devices"},
+		"Get":         {method: http.MethodGet, url: "/api/v0/signature-devices/" + deviceId},
+		"Create":      {method: http.MethodPost, url: "/api/v0/signature-devices", payload: newDevice},
+		"CreateAsync": {method: http.MethodPost, url: "/api/v0/signature-devices?async=true", payload: newDevice},
+		"Job":         {method: http.MethodGet, url: jobURL},
+		"Sign":        {method: http.MethodPost, url: "/api/v0/signature-devices/sign", payload: sign},
+		"TenantList":  {method: http.MethodGet, url: "/api/v1/tenants/default/signature-devices"},
+		"TenantSign":  {method: http.MethodPost, url: "/api/v1/tenants/default/signature-devices/" + deviceId + "/signatures", payload: sign},
+		"Backup":      {method: http.MethodPost, url: "/api/v0/backups", payload: func() any { return &secret }},
+		"Restore": {method: http.MethodPost, url: "/api/v1/tenants/restored/backups/restore", payload: func() any {
+			return &domain.RestoreRequest{BackupSecret: secret, Archive: archive}
+		}},
+		"Relabel": {method: http.MethodPatch, url: "/api/v0/signature-devices/" + deviceId, payload: func() any {
+			label := "till 1"
+			return &domain.UpdateSignatureDeviceRequest{Label: &label}
+		}},
+		"Rotate": {method: http.MethodPost, url: "/api/v0/signature-devices/" + deviceId + "/rotate-key"},
+		"Suspend": {method: http.MethodPatch, url: "/api/v0/signature-devices/" + deviceId, payload: func() any {
+			return &domain.UpdateSignatureDeviceRequest{Status: &suspended}
+		}},
+	}
+
+	testCases := []struct {
+		route string
+		codes map[string]int
+	}{
+		{route: "List", codes: map[string]int{"secret-admin": http.StatusOK, "secret-operator": http.StatusOK, "secret-signer": http.StatusForbidden, "secret-unbound": http.StatusForbidden}},
+		{route: "Get", codes: map[string]int{"secret-admin": http.StatusOK, "secret-operator": http.StatusOK, "secret-signer": http.StatusForbidden, "secret-unbound": http.StatusForbidden}},
+		{route: "Create", codes: map[string]int{"secret-admin": http.StatusCreated, "secret-operator": http.StatusForbidden, "secret-signer": http.StatusForbidden, "secret-unbound": http.StatusForbidden}},
+		{route: "CreateAsync", codes: map[string]int{"secret-admin": http.StatusAccepted, "secret-operator": http.StatusForbidden, "secret-signer": http.StatusForbidden, "secret-unbound": http.StatusForbidden}},
+		{route: "Job", codes: map[string]int{"secret-admin": http.StatusOK, "secret-operator": http.StatusOK, "secret-signer": http.StatusForbidden, "secret-unbound": http.StatusForbidden}},
+		{route: "Sign", codes: map[string]int{"secret-admin": http.StatusOK, "secret-operator": http.StatusForbidden, "secret-signer": http.StatusOK, "secret-signer-two": http.StatusForbidden, "secret-unbound": http.StatusForbidden}},
+		{route: "TenantList", codes: map[string]int{"secret-operator": http.StatusOK, "secret-signer": http.StatusForbidden}},
+		{route: "TenantSign", codes: map[string]int{"secret-signer": http.StatusCreated, "secret-operator": http.StatusForbidden}},
+		{route: "Backup", codes: map[string]int{"secret-operator": http.StatusOK, "secret-signer": http.StatusForbidden, "secret-unbound": http.StatusForbidden, "secret-admin": http.StatusOK}},
+		{route: "Restore", codes: map[string]int{"secret-operator": http.StatusForbidden, "secret-signer": http.StatusForbidden, "secret-unbound": http.StatusForbidden, "secret-admin": http.StatusOK}},
+		{route: "Relabel", codes: map[string]int{"secret-operator": http.StatusForbidden, "secret-signer": http.StatusForbidden, "secret-unbound": http.StatusForbidden, "secret-admin": http.StatusOK}},
+		{route: "Rotate", codes: map[string]int{"secret-operator": http.StatusForbidden, "secret-signer": http.StatusForbidden, "secret-unbound": http.StatusForbidden, "secret-admin": http.StatusOK}},
+		{route: "Suspend", codes: map[string]int{"secret-operator": http.StatusForbidden, "secret-signer": http.StatusForbidden, "secret-unbound": http.StatusForbidden, "secret-admin": http.StatusOK}},
+	}
+	for _, tc := range testCases {
+		for apiKey, code := range tc.codes {
+			t.Run(fmt.Sprintf("%s_%s", tc.route, apiKey), func(t *testing.T) {
+				route := routes[tc.route]
+				var payload any
+				if route.payload != nil {
+					payload = route.payload()
+				}
+				recorder := serveWithAPIKey(t, handler, route.method, route.url, apiKey, payload)
+				requires.Equal(code, recorder.Code, recorder.Body.String())
+				if code == http.StatusForbidden {
+					requires.Equal([]string{utils.ErrPermissionDenied.Error()}, problemMessages(t, recorder.Body.Bytes()))
+				}
+			})
+		}
+	}
+}
+
+func TestRoleBindingsByCredential(t *testing.T) {
+	requires := require.New(t)
+	config, keys := newJWTTestConfig(t)
+	rbacConfig := newRBACTestConfig(t, uuid.NewString())
+	config.APIKeys = rbacConfig.APIKeys
+	config.RBACPolicyFile = rbacConfig.RBACPolicyFile
+	handler := NewServer(config).Routes()
+
+	create := func(token string) int {
+		return serveWithBearer(t, handler, http.MethodPost, "/api/v0/signature-devices", token, &domain.SignatureDeviceRequest{
+			ID:        uuid.NewString(),
+			Algorithm: utils.Algorithms[0],
+		}).Code
+	}
+
+	// The subject of a token is not bound to the roles of the API key with the
+	// same ID.
+	claims := validClaims(utils.Scopes...)
+	claims["sub"] = "key-admin"
+	requires.Equal(http.StatusForbidden, create(signJWT(t, "RS256", "rsa", keys.rsa, claims)))
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "secret-admin", &domain.SignatureDeviceRequest{
+		ID:        uuid.NewString(),
+		Algorithm: utils.Algorithms[0],
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+}
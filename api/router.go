@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// routeMethods are the methods answered with 405 Method Not Allowed on the
+// paths of the API that don't serve them. GET also covers HEAD.
+var routeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// router registers handlers on a ServeMux by method and path pattern, e.g.
+// "GET /api/v1/signature-devices/{id}". Requests on a registered path with
+// another method are answered with 405 Method Not Allowed as problem details
+// and an Allow header listing the methods that are served.
+type router struct {
+	mux     *http.ServeMux
+	wrap    func(route string, handler http.Handler) http.Handler
+	methods map[string][]string
+	paths   []string
+}
+
+// newRouter returns a router that wraps every handler with wrap, passing the
+// path pattern as the route.
+func newRouter(wrap func(route string, handler http.Handler) http.Handler) *router {
+	return &router{mux: http.NewServeMux(), wrap: wrap, methods: make(map[string][]string)}
+}
+
+// handle registers handler for requests with method on the path pattern.
+func (r *router) handle(method, path string, handler http.Handler) {
+	r.mux.Handle(method+" "+path, r.wrap(path, handler))
+	if _, exists := r.methods[path]; !exists {
+		r.paths = append(r.paths, path)
+	}
+	r.methods[path] = append(r.methods[path], method)
+}
+
+// Handler registers the method not allowed handlers of the registered paths
+// and returns the ServeMux.
+func (r *router) Handler() http.Handler {
+	for _, path := range r.paths {
+		allowed := r.methods[path]
+		allow := allowHeader(allowed)
+		for _, method := range routeMethods {
+			if slices.Contains(allowed, method) {
+				continue
+			}
+			r.mux.Handle(method+" "+path, r.wrap(path, http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				response.Header().Set("Allow", allow)
+				WriteMethodNotAllowed(response, request)
+			})))
+		}
+	}
+	return r.mux
+}
+
+// allowHeader returns the Allow header of a path serving methods, adding
+// HEAD when GET is served since the ServeMux routes it to the GET handler.
+func allowHeader(methods []string) string {
+	allowed := slices.Clone(methods)
+	if slices.Contains(allowed, http.MethodGet) {
+		allowed = append(allowed, http.MethodHead)
+	}
+	slices.Sort(allowed)
+	return strings.Join(allowed, ", ")
+}
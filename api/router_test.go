@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func TestVersionedRoutes(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(config).Routes()
+	id := uuid.NewString()
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v1/signature-devices", "", &domain.SignatureDeviceRequest{
+		ID:        id,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	// v1 signs at the device, the v0 route keeps signing with the device in the body.
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v1/signature-devices/"+id+"/signatures", "", &domain.SignTransactionRequest{
+		Data: "0_TESTDATA_" + base64.StdEncoding.EncodeToString([]byte(id)),
+	})
+	requires.Equal(http.StatusCreated, recorder.Code, recorder.Body.String())
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices/sign", "", &domain.SignTransactionRequest{
+		ID:   id,
+		Data: "1_TESTDATA_" + lastSignatureOf(t, handler, "/api/v1", id),
+	})
+	requires.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+
+	// Both versions serve the devices of the default tenant.
+	for _, prefix := range []string{"/api/v0", "/api/v1", "/api/v1/tenants/default"} {
+		recorder = serveWithAPIKey(t, handler, http.MethodGet, prefix+"/signature-devices/"+id, "", nil)
+		requires.Equal(http.StatusOK, recorder.Code, prefix)
+		var response Response
+		requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+		requires.EqualValues(2, response.Data.(map[string]any)["signatureCounter"], prefix)
+	}
+
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v1/signature-devices/"+utils.RandomString(12)+"/signatures", "", &domain.SignTransactionRequest{
+		Data: "0_TESTDATA_",
+	})
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+	requires.Equal(utils.ErrorCode(utils.ErrInvalidDeviceId), decodeProblem(t, recorder.Body.Bytes()).Code)
+
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, "/api/v1/signature-devices?async=true", "", &domain.SignatureDeviceRequest{
+		ID:        uuid.NewString(),
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusAccepted, recorder.Code)
+	requires.Regexp(`^/api/v1/jobs/[0-9a-f-]{36}$`, recorder.Header().Get("Location"))
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(config).Routes()
+	id := uuid.NewString()
+
+	testCases := []struct {
+		name   string
+		method string
+		url    string
+		allow  string
+	}{
+		{name: "Sign_Is_Not_A_Device", method: http.MethodGet, url: "/api/v0/signature-devices/sign", allow: "POST"},
+		{name: "Collection", method: http.MethodDelete, url: "/api/v1/signature-devices", allow: "GET, HEAD, POST"},
+		{name: "Device", method: http.MethodPost, url: "/api/v1/signature-devices/" + id, allow: "GET, HEAD, PATCH"},
+		{name: "Tenant_Device", method: http.MethodPut, url: "/api/v1/tenants/tenant-a/signature-devices/" + id, allow: "GET, HEAD, PATCH"},
+		{name: "Signatures", method: http.MethodGet, url: "/api/v1/signature-devices/" + id + "/signatures", allow: "POST"},
+		{name: "Job", method: http.MethodDelete, url: "/api/v1/jobs/" + id, allow: "GET, HEAD"},
+		{name: "Readyz", method: http.MethodPost, url: "/readyz", allow: "GET, HEAD"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := serveWithAPIKey(t, handler, tc.method, tc.url, "", nil)
+			requires.Equal(http.StatusMethodNotAllowed, recorder.Code)
+			requires.Equal(tc.allow, recorder.Header().Get("Allow"))
+			requires.Equal(problemContentType, recorder.Header().Get("Content-Type"))
+			requires.Equal(utils.ErrorCode(utils.ErrMethodNotAllowed), decodeProblem(t, recorder.Body.Bytes()).Code)
+		})
+	}
+
+	// The v1 API has no sign route, the path names a device.
+	recorder := serveWithAPIKey(t, handler, http.MethodGet, "/api/v1/signature-devices/sign", "", nil)
+	requires.Equal(http.StatusBadRequest, recorder.Code)
+}
@@ -1,21 +1,41 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"sync/atomic"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/uwemakan/signing-service/crypto"
+	"github.com/uwemakan/signing-service/metrics"
 	"github.com/uwemakan/signing-service/persistence"
 	"github.com/uwemakan/signing-service/services"
+	"github.com/uwemakan/signing-service/tracing"
 	"github.com/uwemakan/signing-service/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Response is the generic API response container.
 type Response struct {
-	Data interface{} `json:"data"`
+	Data       interface{} `json:"data"`
+	Pagination *Pagination `json:"pagination,omitempty"`
 }
 
-// ErrorResponse is the generic error API response container.
+// Pagination links a page of results to the next one. NextCursor is passed as
+// the cursor query parameter to fetch the next page. The last page has no
+// pagination.
+type Pagination struct {
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// ErrorResponse is the generic error API response container of the v0 API,
+// used when legacy error responses are configured.
 type ErrorResponse struct {
 	Errors []string `json:"errors"`
 }
@@ -24,32 +44,171 @@ type ErrorResponse struct {
 type Server struct {
 	config                 *utils.Config
 	signatureDeviceService services.SignatureService
+	authService            services.AuthService
+	healthService          services.HealthService
+	jwtVerifier            *crypto.JWTVerifier
+	clientLimiter          *rateLimiter
+	logger                 *slog.Logger
+	registry               *prometheus.Registry
+	metrics                *metrics.Metrics
+	tracerProvider         trace.TracerProvider
+	tracer                 trace.Tracer
+	repository             persistence.SignatureDeviceRepository
+	workerPool             *services.WorkerPool
+	draining               atomic.Bool
 }
 
 // NewServer is a factory to instantiate a new Server.
+// API keys from the config are registered with the auth service and the
+// configured JWT verification keys are loaded. It exits when no
+// authentication is configured, unless the config allows InsecureNoAuth.
+// The server logs to the default slog logger, keeps its metrics in a
+// registry of its own and traces with the global OpenTelemetry tracer
+// provider.
 func NewServer(config *utils.Config) *Server {
-	return &Server{
-		config: config,
-		signatureDeviceService: services.NewSignatureService(
-			services.SignatureServiceParams{
-				Repo:           persistence.NewInMemorySignatureDeviceRepository(),
-				KeyPairFactory: crypto.NewKeyPairFactory(),
-				SignerFactory:  crypto.NewSignerFactory(),
-			},
-		),
+	registry := prometheus.NewRegistry()
+	serverMetrics := metrics.New(registry)
+	tracerProvider := otel.GetTracerProvider()
+	authService := services.NewAuthService(persistence.NewInMemoryAPIKeyRepository())
+	for _, key := range config.APIKeys {
+		if err := authService.RegisterAPIKey(key.ID, key.Owner, key.Tenant, key.Secret); err != nil {
+			log.Fatalf("Could not register API key %s: %v", key.ID, err)
+		}
+	}
+	jwtVerifier, err := newJWTVerifier(config.JWT)
+	if err != nil {
+		log.Fatalf("Could not load JWT verification keys: %v", err)
+	}
+	deviceLimiter := newRateLimiter("device", config.RateLimits.Device, config.RateLimits.DeviceOverrides, utils.SystemClock{}, serverMetrics)
+	repository := persistence.NewInstrumentedSignatureDeviceRepository(persistence.NewInMemorySignatureDeviceRepository(slog.Default()), serverMetrics)
+	workerPool := services.NewWorkerPool(config.WorkerPoolSize, config.JobQueueSize)
+	healthService := services.NewHealthService(services.HealthServiceParams{
+		Repo:           repository,
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+		WorkerPool:     workerPool,
+		KEK:            config.AESKey,
+	})
+	signatureDeviceService := services.NewSignatureService(
+		services.SignatureServiceParams{
+			Repo:               repository,
+			Logger:             slog.Default(),
+			Metrics:            serverMetrics,
+			TracerProvider:     tracerProvider,
+			Jobs:               persistence.NewInMemoryJobRepository(),
+			WorkerPool:         workerPool,
+			KeyPairFactory:     crypto.NewKeyPairFactory(),
+			SignerFactory:      crypto.NewSignerFactory(),
+			KEK:                config.AESKey,
+			DeviceLimit:        config.TenantDeviceLimit,
+			TenantDeviceLimits: config.TenantDeviceLimits,
+			SignatureLimiter:   signatureLimiter{deviceLimiter},
+		},
+	)
+	if config.RBACPolicyFile != "" {
+		policy, err := services.LoadPolicy(config.RBACPolicyFile)
+		if err != nil {
+			log.Fatalf("Could not load RBAC policy: %v", err)
+		}
+		signatureDeviceService = services.NewAuthorizedSignatureService(signatureDeviceService, policy)
+	} else {
+		slog.Warn("role-based access control is disabled, authenticated principals are only limited by their scopes", "hint", "set RBAC_POLICY_FILE to enable it")
+	}
+	server := &Server{
+		config:                 config,
+		authService:            authService,
+		healthService:          healthService,
+		jwtVerifier:            jwtVerifier,
+		signatureDeviceService: signatureDeviceService,
+		clientLimiter:          newRateLimiter("client", config.RateLimits.Client, nil, utils.SystemClock{}, serverMetrics),
+		logger:                 slog.Default(),
+		registry:               registry,
+		metrics:                serverMetrics,
+		tracerProvider:         tracerProvider,
+		tracer:                 tracerProvider.Tracer(tracing.InstrumentationName),
+		repository:             repository,
+		workerPool:             workerPool,
+	}
+	if !server.authenticationEnabled() {
+		if !config.InsecureNoAuth {
+			log.Fatalf("No authentication configured: set API_KEYS, JWT_JWKS_FILE or JWT_PUBLIC_KEYS, or TLS_CLIENT_AUTH, or start with --insecure-no-auth to serve every request unauthenticated")
+		}
+		slog.Warn("authentication is disabled, every request is served unauthenticated", "flag", "--insecure-no-auth")
 	}
+	return server
 }
 
-// Run registers all HandlerFuncs for the existing HTTP routes and starts the Server.
-func (s *Server) Run() error {
-	mux := http.NewServeMux()
+// Routes registers all HandlerFuncs for the existing HTTP routes by method and
+// path; other methods on a path are answered with 405 Method Not Allowed.
+// Every route except the health checks, the metrics and the OpenAPI document
+// requires authentication and is rate limited per caller; signing is also rate limited
+// per device, and is rejected while the server drains before shutting down.
+// Requests in flight are counted and traced by route, and are
+// cancelled once past the deadline configured for it.
+func (s *Server) Routes() http.Handler {
+	routes := newRouter(func(route string, handler http.Handler) http.Handler {
+		return s.CountInFlight(route, s.TraceRoute(route, s.Deadline(route, handler)))
+	})
+	protect := func(scope string, handler http.Handler) http.Handler {
+		return s.Authenticate(s.LimitClient(s.Authorize(scope, handler)))
+	}
+
+	routes.handle(http.MethodGet, "/api/v0/health", http.HandlerFunc(s.Health))
+	routes.handle(http.MethodGet, "/livez", http.HandlerFunc(s.Livez))
+	routes.handle(http.MethodGet, "/readyz", http.HandlerFunc(s.Readyz))
+	routes.handle(http.MethodGet, "/metrics", promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}))
+	routes.handle(http.MethodGet, "/api/openapi.json", http.HandlerFunc(s.OpenAPI))
+	// The v0 routes are kept for compatibility. The v1 routes address the
+	// default tenant, or the tenant of the path, and sign at the device.
+	for _, prefix := range []string{"/api/v0", "/api/v1", "/api/v1/tenants/{tenant}"} {
+		handle := func(method, path string, handler http.Handler) {
+			routes.handle(method, prefix+path, s.Tenant(prefix, handler))
+		}
+		handle(http.MethodGet, "/signature-devices", protect(utils.ScopeDevicesRead, http.HandlerFunc(s.ListSignatureDevices)))
+		handle(http.MethodPost, "/signature-devices", protect(utils.ScopeDevicesWrite, http.HandlerFunc(s.CreateSignatureDevice)))
+		handle(http.MethodGet, "/signature-devices/{id}", protect(utils.ScopeDevicesRead, http.HandlerFunc(s.GetSignatureDevice)))
+		handle(http.MethodPatch, "/signature-devices/{id}", protect(utils.ScopeDevicesWrite, http.HandlerFunc(s.UpdateSignatureDevice)))
+		handle(http.MethodPost, "/signature-devices/{id}/rotate-key", protect(utils.ScopeDevicesWrite, http.HandlerFunc(s.RotateDeviceKey)))
+		handle(http.MethodPost, "/signature-devices/{id}/verify", protect(utils.ScopeDevicesRead, http.HandlerFunc(s.VerifySignature)))
+		if prefix == "/api/v0" {
+			handle(http.MethodPost, "/signature-devices/sign", s.Drain(protect(utils.ScopeTransactionsSign, http.HandlerFunc(s.SignTransaction))))
+		} else {
+			handle(http.MethodPost, "/signature-devices/{id}/signatures", s.Drain(protect(utils.ScopeTransactionsSign, http.HandlerFunc(s.CreateSignature))))
+		}
+		handle(http.MethodPost, "/backups", protect(utils.ScopeDevicesBackup, http.HandlerFunc(s.ExportSignatureDevices)))
+		handle(http.MethodPost, "/backups/restore", protect(utils.ScopeDevicesBackup, http.HandlerFunc(s.ImportSignatureDevices)))
+		handle(http.MethodGet, "/jobs/{id}", protect(utils.ScopeDevicesRead, http.HandlerFunc(s.GetJob)))
+	}
+
+	return s.TraceRequests(s.LogRequests(s.ErrorFormat(routes.Handler())))
+}
 
-	mux.Handle("/api/v0/health", http.HandlerFunc(s.Health))
-	mux.Handle("/api/v0/signature-devices", http.HandlerFunc(s.Handler))
-	mux.Handle("/api/v0/signature-devices/", http.HandlerFunc(s.GetSignatureDevice))
-	mux.Handle("/api/v0/signature-devices/sign", http.HandlerFunc(s.SignTransaction))
+// Run starts the Server, serving HTTPS when a TLS certificate is configured
+// and the gRPC API when a gRPC address is, until it is shut down by SIGINT or
+// SIGTERM.
+func (s *Server) Run() error {
+	listener, err := net.Listen("tcp", s.config.ServerAddress)
+	if err != nil {
+		return err
+	}
+	var grpcListener net.Listener
+	if s.config.GRPCAddress != "" {
+		grpcListener, err = net.Listen("tcp", s.config.GRPCAddress)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	return s.Serve(context.Background(), listener, grpcListener)
+}
 
-	return http.ListenAndServe(s.config.ServerAddress, mux)
+// CountInFlight is a middleware that counts the requests of a route being
+// served.
+func (s *Server) CountInFlight(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		defer s.metrics.RequestStarted(route)()
+		next.ServeHTTP(response, request)
+	})
 }
 
 // WriteInternalError writes a default internal error message as an HTTP response.
@@ -61,6 +220,8 @@ func WriteInternalError(w http.ResponseWriter) {
 // WriteErrorResponse takes an HTTP status code and a slice of errors
 // and writes those as an HTTP error response in a structured format.
 func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
+	logErrors(w, errors...)
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 
 	errorResponse := ErrorResponse{
@@ -78,36 +239,27 @@ func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
 // WriteAPIResponse takes an HTTP status code and a generic data struct
 // and writes those as an HTTP response in a structured format.
 func WriteAPIResponse(w http.ResponseWriter, code int, data interface{}) {
-	w.WriteHeader(code)
+	writeResponse(w, code, Response{Data: data})
+}
 
-	response := Response{
-		Data: data,
+// WritePageResponse writes a page of results along with its pagination,
+// unless it is the last page.
+func WritePageResponse(w http.ResponseWriter, code int, data interface{}, nextCursor string) {
+	response := Response{Data: data}
+	if nextCursor != "" {
+		response.Pagination = &Pagination{NextCursor: nextCursor}
 	}
+	writeResponse(w, code, response)
+}
 
+func writeResponse(w http.ResponseWriter, code int, response Response) {
 	bytes, err := json.MarshalIndent(response, "", "  ")
 	if err != nil {
 		WriteInternalError(w)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	w.Write(bytes)
 }
-
-// HandleError matches errors to their corresponding http status codes
-func HandleError(w http.ResponseWriter, err error) {
-	switch err {
-	case utils.ErrInvalidSignatureCounter,
-		utils.ErrInvalidLastSignature,
-		utils.ErrInvalidData,
-		utils.ErrDeviceAlreadyExists,
-		utils.ErrUnsupportedAlgorithm,
-		utils.ErrInvalidDeviceId:
-		WriteErrorResponse(w, http.StatusBadRequest, []string{err.Error()})
-	case utils.ErrDeviceNotFound:
-		WriteErrorResponse(w, http.StatusNotFound, []string{err.Error()})
-	default:
-		WriteErrorResponse(w, http.StatusInternalServerError, []string{
-			http.StatusText(http.StatusInternalServerError),
-		})
-	}
-}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/uwemakan/signing-service/persistence"
+	"github.com/uwemakan/signing-service/utils"
+	"google.golang.org/grpc"
+)
+
+// Serve serves requests on listener, and calls of the gRPC API on
+// grpcListener unless it is nil, until ctx is done or the process receives
+// SIGINT or SIGTERM, and then shuts the Server down gracefully:
+//
+//  1. For the configured drain period new sign requests are rejected with
+//     503 Service Unavailable, or UNAVAILABLE over gRPC, while everything
+//     else is still served.
+//  2. The listeners are closed and requests in flight are finished.
+//  3. Queued jobs are run and writes buffered by the repository are flushed.
+//
+// Steps 2 and 3 are bounded by the configured shutdown timeout. Serve returns
+// nil once the Server is shut down cleanly. A second signal stops the process
+// without waiting.
+func (s *Server) Serve(ctx context.Context, listener, grpcListener net.Listener) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	closeListeners := func() {
+		listener.Close()
+		if grpcListener != nil {
+			grpcListener.Close()
+		}
+	}
+	server := &http.Server{Handler: s.Routes()}
+	if s.config.TLS.Enabled() {
+		tlsConfig, err := newTLSConfig(s.config.TLS)
+		if err != nil {
+			closeListeners()
+			return err
+		}
+		server.TLSConfig = tlsConfig
+	}
+	var grpcServer *grpc.Server
+	if grpcListener != nil {
+		var err error
+		grpcServer, err = s.GRPCServer()
+		if err != nil {
+			closeListeners()
+			return err
+		}
+	}
+
+	served := make(chan error, 2)
+	go func() {
+		if s.config.TLS.Enabled() {
+			served <- server.ServeTLS(listener, s.config.TLS.CertFile, s.config.TLS.KeyFile)
+		} else {
+			served <- server.Serve(listener)
+		}
+	}()
+	if grpcServer != nil {
+		go func() { served <- grpcServer.Serve(grpcListener) }()
+	}
+	select {
+	case err := <-served:
+		server.Close()
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+		return err
+	case <-ctx.Done():
+		stop()
+	}
+	return s.shutdown(server, grpcServer)
+}
+
+// shutdown drains and stops server and grpcServer, if any, and then the
+// background work of the Server. The worker pool is shut down and the
+// repository flushed even if the servers didn't stop in time.
+func (s *Server) shutdown(server *http.Server, grpcServer *grpc.Server) error {
+	s.logger.Info("draining", "period", s.config.Shutdown.DrainPeriod)
+	s.draining.Store(true)
+	time.Sleep(s.config.Shutdown.DrainPeriod)
+
+	s.logger.Info("shutting down", "timeout", s.config.Shutdown.Timeout)
+	ctx := context.Background()
+	if s.config.Shutdown.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.Shutdown.Timeout)
+		defer cancel()
+	}
+	grpcStopped := make(chan error, 1)
+	go func() { grpcStopped <- stopGRPC(ctx, grpcServer) }()
+	serverErr := server.Shutdown(ctx)
+	return errors.Join(serverErr, <-grpcStopped, s.workerPool.Shutdown(ctx), persistence.Flush(ctx, s.repository))
+}
+
+// stopGRPC stops server, if any, once the calls in flight are finished, or
+// cancels them once ctx is done.
+func stopGRPC(ctx context.Context, server *grpc.Server) error {
+	if server == nil {
+		return nil
+	}
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		return ctx.Err()
+	}
+}
+
+// Drain is a middleware that rejects requests while the server drains before
+// shutting down. Their connections are closed so that callers reconnect, to
+// another instance once load balancers took this one out of rotation.
+func (s *Server) Drain(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if s.draining.Load() {
+			response.Header().Set("Connection", "close")
+			HandleError(response, request, utils.ErrShuttingDown)
+			return
+		}
+		next.ServeHTTP(response, request)
+	})
+}
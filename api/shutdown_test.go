@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/persistence"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	requires := require.New(t)
+	shutdownConfig := *authConfig
+	shutdownConfig.Shutdown = utils.ShutdownConfig{DrainPeriod: time.Second, Timeout: 5 * time.Second}
+	server := NewServer(&shutdownConfig)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	requires.NoError(err)
+	baseURL := "http://" + listener.Addr().String()
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Serve(context.Background(), listener, nil) }()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	post := func(url string, payload any) (*http.Response, error) {
+		body := &strings.Builder{}
+		requires.NoError(json.NewEncoder(body).Encode(payload))
+		request, err := http.NewRequest(http.MethodPost, baseURL+url, strings.NewReader(body.String()))
+		requires.NoError(err)
+		request.Header.Set(APIKeyHeader, "secret-a")
+		return client.Do(request)
+	}
+
+	// Every loader signs with a device of its own until it is turned away.
+	deviceIds := make([]string, 4)
+	signed := make([]int, len(deviceIds))
+	var total atomic.Int64
+	var loaders sync.WaitGroup
+	for i := range deviceIds {
+		deviceIds[i] = uuid.NewString()
+		response, err := post("/api/v0/signature-devices", &domain.SignatureDeviceRequest{ID: deviceIds[i], Algorithm: "ECC"})
+		requires.NoError(err)
+		response.Body.Close()
+		requires.Equal(http.StatusCreated, response.StatusCode)
+
+		loaders.Add(1)
+		go func() {
+			defer loaders.Done()
+			lastSignature := base64.StdEncoding.EncodeToString([]byte(deviceIds[i]))
+			for {
+				response, err := post("/api/v0/signature-devices/sign", &domain.SignTransactionRequest{
+					ID:   deviceIds[i],
+					Data: fmt.Sprintf("%d_data_%s", signed[i], lastSignature),
+				})
+				if err != nil {
+					t.Errorf("sign request failed: %v", err)
+					return
+				}
+				var result struct {
+					Data domain.SignTransactionResponse `json:"data"`
+				}
+				json.NewDecoder(response.Body).Decode(&result)
+				response.Body.Close()
+				if response.StatusCode == http.StatusServiceUnavailable {
+					return
+				}
+				if response.StatusCode != http.StatusOK {
+					t.Errorf("sign request answered %d", response.StatusCode)
+					return
+				}
+				lastSignature = result.Data.Signature
+				signed[i]++
+				total.Add(1)
+			}
+		}()
+	}
+	requires.Eventually(func() bool { return total.Load() >= 20 }, 5*time.Second, time.Millisecond)
+
+	requires.NoError(syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	loaders.Wait()
+
+	// While draining, requests other than signing are still served.
+	request, err := http.NewRequest(http.MethodGet, baseURL+"/api/v0/signature-devices/"+deviceIds[0], nil)
+	requires.NoError(err)
+	request.Header.Set(APIKeyHeader, "secret-a")
+	response, err := client.Do(request)
+	requires.NoError(err)
+	response.Body.Close()
+	requires.Equal(http.StatusOK, response.StatusCode)
+
+	select {
+	case err := <-stopped:
+		requires.NoError(err)
+	case <-time.After(5 * time.Second):
+		requires.FailNow("server did not shut down")
+	}
+	_, err = client.Get(baseURL + "/api/v0/health")
+	requires.Error(err)
+
+	// Every signature answered was persisted, and no other.
+	for i, id := range deviceIds {
+		device, err := server.signatureDeviceService.GetSignatureDevice(context.Background(), nil, utils.DefaultTenant, id)
+		requires.NoError(err)
+		requires.Equal(signed[i], device.SignatureCounter, id)
+	}
+}
+
+// flushRecordingRepository records whether it was flushed.
+type flushRecordingRepository struct {
+	persistence.SignatureDeviceRepository
+	flushed atomic.Bool
+}
+
+func (r *flushRecordingRepository) Flush(context.Context) error {
+	r.flushed.Store(true)
+	return nil
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	requires := require.New(t)
+	shutdownConfig := *config
+	shutdownConfig.Shutdown = utils.ShutdownConfig{Timeout: 50 * time.Millisecond}
+	server := NewServer(&shutdownConfig)
+	repository := &flushRecordingRepository{SignatureDeviceRepository: server.repository}
+	server.repository = repository
+
+	// A request still in flight when the timeout expires fails the shutdown,
+	// but the repository is flushed regardless.
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	httpServer := &http.Server{Handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		close(started)
+		<-release
+	})}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	requires.NoError(err)
+	go httpServer.Serve(listener)
+	go http.Get("http://" + listener.Addr().String())
+	<-started
+
+	requires.ErrorIs(server.shutdown(httpServer, nil), context.DeadlineExceeded)
+	requires.True(repository.flushed.Load())
+}
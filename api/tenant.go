@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/uwemakan/signing-service/utils"
+)
+
+var tenantIdPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+type tenantContextKey struct{}
+
+// tenantRoute holds the tenant of a request and the path prefix of the
+// route it was made on.
+type tenantRoute struct {
+	tenantID string
+	prefix   string
+}
+
+// requestTenant returns the tenant addressed by the request. Requests on
+// routes without a tenant address the default tenant.
+func requestTenant(request *http.Request) string {
+	if route, ok := request.Context().Value(tenantContextKey{}).(tenantRoute); ok {
+		return route.tenantID
+	}
+	return utils.DefaultTenant
+}
+
+// routePrefix returns the path prefix under which resources of the request's
+// tenant are served, e.g. for Location headers.
+func routePrefix(request *http.Request) string {
+	if route, ok := request.Context().Value(tenantContextKey{}).(tenantRoute); ok {
+		return route.prefix
+	}
+	return "/api/v0"
+}
+
+// Tenant is a middleware that attaches the tenant addressed by a route
+// mounted on prefix to the request. Prefixes with a {tenant} segment address
+// the tenant of the path, which must be a valid tenant ID; others address the
+// default tenant.
+func (s *Server) Tenant(prefix string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		route := tenantRoute{tenantID: utils.DefaultTenant, prefix: prefix}
+		if strings.Contains(prefix, "{tenant}") {
+			tenantID := request.PathValue("tenant")
+			if !validateTenantID(tenantID) {
+				HandleError(response, request, utils.ErrInvalidTenantId)
+				return
+			}
+			route = tenantRoute{tenantID: tenantID, prefix: strings.Replace(prefix, "{tenant}", tenantID, 1)}
+		}
+		next.ServeHTTP(response, request.WithContext(context.WithValue(request.Context(), tenantContextKey{}, route)))
+	})
+}
+
+func validateTenantID(tenantID string) bool {
+	return tenantIdPattern.MatchString(tenantID)
+}
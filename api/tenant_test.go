@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+var tenantConfig = &utils.Config{
+	ServerAddress: ":0",
+	AESKey:        []byte("1234567890123456"),
+	APIKeys: []utils.APIKeyConfig{
+		{ID: "key-a", Owner: "merchant", Tenant: "tenant-a", Secret: "secret-a"},
+		{ID: "key-b", Owner: "merchant", Tenant: "tenant-b", Secret: "secret-b"},
+		{ID: "key-global", Owner: "merchant", Secret: "secret-global"},
+	},
+	TenantDeviceLimits: map[string]int{"tenant-a": 1},
+}
+
+func TestTenantRoutes(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(tenantConfig).Routes()
+	id := uuid.NewString()
+	tenantA := "/api/v1/tenants/tenant-a"
+	tenantB := "/api/v1/tenants/tenant-b"
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, tenantA+"/signature-devices", "secret-a", &domain.SignatureDeviceRequest{
+		ID:        id,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+	var response Response
+	requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	b, err := json.Marshal(response.Data)
+	requires.NoError(err)
+	var device domain.SignatureDevice
+	requires.NoError(json.Unmarshal(b, &device))
+	requires.Equal("tenant-a", device.TenantID)
+
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, tenantA+"/signature-devices", "secret-a", &domain.SignatureDeviceRequest{
+		ID:        uuid.NewString(),
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusForbidden, recorder.Code)
+	requires.Equal([]string{utils.ErrTenantDeviceLimit.Error()}, problemMessages(t, recorder.Body.Bytes()))
+
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, tenantA+"/signature-devices/"+id, "secret-a", nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, tenantA+"/signature-devices/"+id, "secret-global", nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, tenantA+"/signature-devices/"+id, "secret-b", nil)
+	requires.Equal(http.StatusForbidden, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, tenantB+"/signature-devices/"+id, "secret-b", nil)
+	requires.Equal(http.StatusNotFound, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices/"+id, "secret-global", nil)
+	requires.Equal(http.StatusNotFound, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, "/api/v0/signature-devices", "secret-a", nil)
+	requires.Equal(http.StatusForbidden, recorder.Code)
+
+	sign := &domain.SignTransactionRequest{
+		ID:   id,
+		Data: "0_TESTDATA_" + base64.StdEncoding.EncodeToString([]byte(id)),
+	}
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, tenantB+"/signature-devices/"+id+"/signatures", "secret-global", sign)
+	requires.Equal(http.StatusNotFound, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, tenantA+"/signature-devices/"+id+"/signatures", "secret-b", sign)
+	requires.Equal(http.StatusForbidden, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodPost, tenantA+"/signature-devices/"+id+"/signatures", "secret-a", sign)
+	requires.Equal(http.StatusCreated, recorder.Code)
+
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, tenantB+"/signature-devices", "secret-b", nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	requires.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	requires.Empty(response.Data)
+}
+
+func TestTenantRoutesAsync(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(tenantConfig).Routes()
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v1/tenants/tenant-b/signature-devices?async=true", "secret-b", &domain.SignatureDeviceRequest{
+		ID:        uuid.NewString(),
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusAccepted, recorder.Code)
+	location := recorder.Header().Get("Location")
+	requires.Regexp(`^/api/v1/tenants/tenant-b/jobs/[0-9a-f-]{36}$`, location)
+
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, location, "secret-b", nil)
+	requires.Equal(http.StatusOK, recorder.Code)
+	recorder = serveWithAPIKey(t, handler, http.MethodGet, location, "secret-a", nil)
+	requires.Equal(http.StatusForbidden, recorder.Code)
+}
+
+func TestTenantRoutesInvalid(t *testing.T) {
+	requires := require.New(t)
+	handler := NewServer(tenantConfig).Routes()
+
+	testCases := []struct {
+		name string
+		url  string
+		code int
+	}{
+		{name: "Tenant_Invalid_Id", url: "/api/v1/tenants/Tenant_A/signature-devices", code: http.StatusBadRequest},
+		{name: "Tenant_Too_Long", url: "/api/v1/tenants/" + strings.Repeat("a", 64) + "/signature-devices", code: http.StatusBadRequest},
+		{name: "Tenant_Unknown_Resource", url: "/api/v1/tenants/tenant-a/health", code: http.StatusNotFound},
+		{name: "Tenant_Missing_Resource", url: "/api/v1/tenants/tenant-a", code: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := serveWithAPIKey(t, handler, http.MethodGet, tc.url, "secret-global", nil)
+			requires.Equal(tc.code, recorder.Code)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// newTLSConfig builds the server TLS configuration. Certificates are loaded by
+// http.Server.ListenAndServeTLS, so only the client verification and protocol
+// settings are set here.
+func newTLSConfig(config utils.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	switch config.MinVersion {
+	case "", "1.2":
+		tlsConfig.MinVersion = tls.VersionTLS12
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported TLS minimum version %q", config.MinVersion)
+	}
+
+	switch config.ClientAuth {
+	case "", "none":
+		tlsConfig.ClientAuth = tls.NoClientCert
+	case "request":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unsupported TLS client auth mode %q", config.ClientAuth)
+	}
+
+	if tlsConfig.ClientAuth != tls.NoClientCert {
+		if config.ClientCAFile == "" {
+			return nil, errors.New("client certificate verification requires a client CA bundle")
+		}
+		data, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// clientCertificateSubject returns the subject of the verified client
+// certificate of the request, or an empty string if none was presented.
+func clientCertificateSubject(request *http.Request) string {
+	if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 || len(request.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return request.TLS.VerifiedChains[0][0].Subject.String()
+}
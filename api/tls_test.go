@@ -0,0 +1,223 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+type testCertificateAuthority struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newTestCertificateAuthority(t *testing.T) *testCertificateAuthority {
+	requires := require.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	requires.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	requires.NoError(err)
+	certificate, err := x509.ParseCertificate(der)
+	requires.NoError(err)
+	return &testCertificateAuthority{certificate: certificate, key: key}
+}
+
+func (ca *testCertificateAuthority) issue(t *testing.T, subject pkix.Name, usage x509.ExtKeyUsage) tls.Certificate {
+	requires := require.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	requires.NoError(err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	requires.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	requires.NoError(err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startTLSServer serves the routes of a server configured for the given
+// client auth mode over TLS and returns its URL and the CA it trusts.
+func startTLSServer(t *testing.T, clientAuth string, apiKeys []utils.APIKeyConfig) (string, *testCertificateAuthority) {
+	requires := require.New(t)
+	ca := newTestCertificateAuthority(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	requires.NoError(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw}), 0600))
+
+	config := &utils.Config{
+		ServerAddress: ":0",
+		AESKey:        []byte("1234567890123456"),
+		APIKeys:       apiKeys,
+		TLS: utils.TLSConfig{
+			CertFile:     "server.pem",
+			KeyFile:      "server-key.pem",
+			ClientCAFile: caFile,
+			MinVersion:   "1.3",
+			ClientAuth:   clientAuth,
+		},
+	}
+	tlsConfig, err := newTLSConfig(config.TLS)
+	requires.NoError(err)
+	tlsConfig.Certificates = []tls.Certificate{ca.issue(t, pkix.Name{CommonName: "localhost"}, x509.ExtKeyUsageServerAuth)}
+
+	httpServer := httptest.NewUnstartedServer(NewServer(config).Routes())
+	httpServer.TLS = tlsConfig
+	httpServer.Config.ErrorLog = log.New(io.Discard, "", 0)
+	httpServer.StartTLS()
+	t.Cleanup(httpServer.Close)
+	return httpServer.URL, ca
+}
+
+func newTLSClient(ca *testCertificateAuthority, certificates ...tls.Certificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certificates},
+		},
+	}
+}
+
+func doTLSRequest(t *testing.T, client *http.Client, method, url, apiKey string, payload any) *http.Response {
+	requires := require.New(t)
+	body := &strings.Builder{}
+	if payload != nil {
+		requires.NoError(json.NewEncoder(body).Encode(payload))
+	}
+	request, err := http.NewRequest(method, url, strings.NewReader(body.String()))
+	requires.NoError(err)
+	if apiKey != "" {
+		request.Header.Set(APIKeyHeader, apiKey)
+	}
+	response, err := client.Do(request)
+	requires.NoError(err)
+	t.Cleanup(func() { response.Body.Close() })
+	return response
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	requires := require.New(t)
+
+	tlsConfig, err := newTLSConfig(utils.TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem"})
+	requires.NoError(err)
+	requires.Equal(uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	requires.Equal(tls.NoClientCert, tlsConfig.ClientAuth)
+
+	_, err = newTLSConfig(utils.TLSConfig{MinVersion: "1.0"})
+	requires.Error(err)
+	_, err = newTLSConfig(utils.TLSConfig{ClientAuth: "optional"})
+	requires.Error(err)
+	_, err = newTLSConfig(utils.TLSConfig{ClientAuth: "require"})
+	requires.Error(err)
+}
+
+func TestMutualTLSRequired(t *testing.T) {
+	requires := require.New(t)
+	url, ca := startTLSServer(t, "require", nil)
+
+	_, err := newTLSClient(ca).Get(url + "/api/v0/signature-devices")
+	requires.Error(err)
+
+	untrusted := newTestCertificateAuthority(t)
+	client := newTLSClient(ca, untrusted.issue(t, pkix.Name{CommonName: "rogue"}, x509.ExtKeyUsageClientAuth))
+	_, err = client.Get(url + "/api/v0/signature-devices")
+	requires.Error(err)
+
+	terminal := ca.issue(t, pkix.Name{CommonName: "terminal-1", Organization: []string{"Merchant"}}, x509.ExtKeyUsageClientAuth)
+	client = newTLSClient(ca, terminal)
+	id := uuid.NewString()
+	response := doTLSRequest(t, client, http.MethodPost, url+"/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{
+		ID:        id,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusCreated, response.StatusCode)
+	var created Response
+	requires.NoError(json.NewDecoder(response.Body).Decode(&created))
+	b, err := json.Marshal(created.Data)
+	requires.NoError(err)
+	var device domain.SignatureDevice
+	requires.NoError(json.Unmarshal(b, &device))
+	requires.Equal("CN=terminal-1,O=Merchant", device.Terminal)
+	requires.Equal("cert:CN=terminal-1,O=Merchant", device.Owner)
+
+	other := newTLSClient(ca, ca.issue(t, pkix.Name{CommonName: "terminal-2", Organization: []string{"Merchant"}}, x509.ExtKeyUsageClientAuth))
+	response = doTLSRequest(t, other, http.MethodGet, url+"/api/v0/signature-devices/"+id, "", nil)
+	requires.Equal(http.StatusNotFound, response.StatusCode)
+	response = doTLSRequest(t, client, http.MethodGet, url+"/api/v0/signature-devices/"+id, "", nil)
+	requires.Equal(http.StatusOK, response.StatusCode)
+
+	// The certificate alone doesn't reach other tenants or backups.
+	response = doTLSRequest(t, client, http.MethodGet, url+"/api/v1/tenants/other/signature-devices", "", nil)
+	requires.Equal(http.StatusForbidden, response.StatusCode)
+	response = doTLSRequest(t, client, http.MethodPost, url+"/api/v0/backups", "", &domain.BackupSecret{Passphrase: "correct horse battery staple"})
+	requires.Equal(http.StatusForbidden, response.StatusCode)
+}
+
+func TestMutualTLSRequested(t *testing.T) {
+	requires := require.New(t)
+	url, ca := startTLSServer(t, "request", []utils.APIKeyConfig{{ID: "key-a", Owner: "merchant-a", Secret: "secret-a"}})
+
+	response := doTLSRequest(t, newTLSClient(ca), http.MethodGet, url+"/api/v0/signature-devices", "", nil)
+	requires.Equal(http.StatusUnauthorized, response.StatusCode)
+	response = doTLSRequest(t, newTLSClient(ca), http.MethodGet, url+"/api/v0/signature-devices", "secret-a", nil)
+	requires.Equal(http.StatusOK, response.StatusCode)
+
+	terminal1 := newTLSClient(ca, ca.issue(t, pkix.Name{CommonName: "terminal-1"}, x509.ExtKeyUsageClientAuth))
+	terminal2 := newTLSClient(ca, ca.issue(t, pkix.Name{CommonName: "terminal-2"}, x509.ExtKeyUsageClientAuth))
+	id := uuid.NewString()
+	response = doTLSRequest(t, terminal1, http.MethodPost, url+"/api/v0/signature-devices", "secret-a", &domain.SignatureDeviceRequest{
+		ID:        id,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.Equal(http.StatusCreated, response.StatusCode)
+
+	sign := &domain.SignTransactionRequest{
+		ID:   id,
+		Data: "0_TESTDATA_" + base64.StdEncoding.EncodeToString([]byte(id)),
+	}
+	response = doTLSRequest(t, terminal2, http.MethodPost, url+"/api/v0/signature-devices/sign", "secret-a", sign)
+	requires.Equal(http.StatusForbidden, response.StatusCode)
+	body, err := io.ReadAll(response.Body)
+	requires.NoError(err)
+	requires.Equal([]string{utils.ErrDeviceBoundToTerminal.Error()}, problemMessages(t, body))
+
+	response = doTLSRequest(t, terminal1, http.MethodPost, url+"/api/v0/signature-devices/sign", "secret-a", sign)
+	requires.Equal(http.StatusOK, response.StatusCode)
+}
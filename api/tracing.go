@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/uwemakan/signing-service/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceRequests is a middleware that serves every request in a server span.
+// Trace context sent by callers in the W3C traceparent header is continued.
+func (s *Server) TraceRequests(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "",
+		otelhttp.WithTracerProvider(s.tracerProvider),
+		otelhttp.WithPropagators(tracing.Propagator),
+		otelhttp.WithSpanNameFormatter(func(_ string, request *http.Request) string {
+			return request.Method
+		}),
+	)
+}
+
+// TraceRoute is a middleware that names the server span of a request after
+// the route it is served by, rather than its path, to keep span names few.
+func (s *Server) TraceRoute(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		span := trace.SpanFromContext(request.Context())
+		span.SetName(request.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+		next.ServeHTTP(response, request)
+	})
+}
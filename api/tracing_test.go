@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTracedServer returns the routes of a server exporting its spans to the
+// returned in-memory exporter.
+func newTracedServer(t *testing.T) (http.Handler, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return NewServer(config).Routes(), exporter
+}
+
+func TestTracing(t *testing.T) {
+	requires := require.New(t)
+	handler, exporter := newTracedServer(t)
+	id := uuid.NewString()
+
+	recorder := serveWithAPIKey(t, handler, http.MethodPost, "/api/v0/signature-devices", "", &domain.SignatureDeviceRequest{
+		ID:        id,
+		Algorithm: "RSA",
+	})
+	requires.Equal(http.StatusCreated, recorder.Code)
+	spans := exporter.GetSpans().Snapshots()
+	server := spans[len(spans)-1]
+	requires.Equal("POST /api/v0/signature-devices", server.Name())
+	requires.Equal(trace.SpanKindServer, server.SpanKind())
+	var children []string
+	for _, span := range spans {
+		if span.Parent().SpanID() == server.SpanContext().SpanID() {
+			children = append(children, span.Name())
+		}
+	}
+	requires.Equal([]string{"api.DecodeRequest", "SignatureService.CreateSignatureDevice"}, children)
+
+	// Callers' trace context is continued.
+	exporter.Reset()
+	traceId := "4bf92f3577b34da6a3ce929d0e0e4736"
+	body, err := json.Marshal(&domain.SignTransactionRequest{
+		ID:   id,
+		Data: "0_TESTDATA_" + base64.StdEncoding.EncodeToString([]byte(id)),
+	})
+	requires.NoError(err)
+	request := httptest.NewRequest(http.MethodPost, "/api/v0/signature-devices/sign", bytes.NewReader(body))
+	request.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	requires.Equal(http.StatusOK, recorder.Code)
+	spans = exporter.GetSpans().Snapshots()
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		requires.Equal(traceId, span.SpanContext().TraceID().String())
+		names = append(names, span.Name())
+	}
+	requires.Subset(names, []string{
+		"POST /api/v0/signature-devices/sign",
+		"api.DecodeRequest",
+		"SignatureService.SignTransaction",
+		"crypto.DecryptAES",
+		"crypto.ParsePrivateKey",
+		"crypto.Sign",
+		"repository.GetDevice",
+		"repository.UpdateDevice",
+	})
+	server = spans[len(spans)-1]
+	requires.Equal("00f067aa0ba902b7", server.Parent().SpanID().String())
+	requires.True(server.Parent().IsRemote())
+}
@@ -2,14 +2,25 @@ package api
 
 import (
 	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/uwemakan/signing-service/domain"
 	"github.com/uwemakan/signing-service/utils"
 )
 
+// invalidParam reports the named field or query parameter as invalid, with
+// the reason formatted like fmt.Sprintf.
+func invalidParam(name, format string, args ...any) InvalidParam {
+	return InvalidParam{Name: name, Reason: fmt.Sprintf(format, args...)}
+}
+
 func validateUUID(id string) bool {
 	_, err := uuid.Parse(id)
 	return err == nil
@@ -40,30 +51,184 @@ func validateAlgorithm(algorithm string) bool {
 }
 
 func validateLabel(label string) bool {
-	return label != ""
+	return label != "" && len(label) <= utils.MaxLabelLength
+}
+
+var metadataKeyPattern = regexp.MustCompile(fmt.Sprintf(`^[A-Za-z0-9_.-]{1,%d}$`, utils.MaxMetadataKeyLength))
+
+// validateMetadataEntry checks a single metadata key and value.
+func validateMetadataEntry(key, value string) (errs []InvalidParam) {
+	if !metadataKeyPattern.MatchString(key) {
+		errs = append(errs, invalidParam(metadataQueryPrefix+key, "invalid metadata key %q: keys must be 1-%d letters, digits, dots, dashes or underscores", key, utils.MaxMetadataKeyLength))
+	}
+	if len(value) > utils.MaxMetadataValueLength {
+		errs = append(errs, invalidParam(metadataQueryPrefix+key, "invalid metadata value for %q: values are limited to %d bytes", key, utils.MaxMetadataValueLength))
+	}
+	return
+}
+
+func validateMetadata(metadata map[string]string) (errs []InvalidParam) {
+	if len(metadata) > utils.MaxMetadataEntries {
+		errs = append(errs, invalidParam("metadata", utils.ErrMetadataLimit.Error()))
+	}
+	for _, key := range slices.Sorted(maps.Keys(metadata)) {
+		errs = append(errs, validateMetadataEntry(key, metadata[key])...)
+	}
+	return
+}
+
+// validateMetadataPatch checks a metadata update, nil values remove keys.
+func validateMetadataPatch(patch map[string]*string) (errs []InvalidParam) {
+	if len(patch) > utils.MaxMetadataEntries {
+		errs = append(errs, invalidParam("metadata", utils.ErrMetadataLimit.Error()))
+	}
+	for _, key := range slices.Sorted(maps.Keys(patch)) {
+		value := ""
+		if patch[key] != nil {
+			value = *patch[key]
+		}
+		errs = append(errs, validateMetadataEntry(key, value)...)
+	}
+	return
 }
 
-func validateSignatureDeviceRequest(request *domain.SignatureDeviceRequest) (errs []string) {
+func validateSignatureDeviceRequest(request *domain.SignatureDeviceRequest) (errs []InvalidParam) {
 	if !validateUUID(request.ID) {
-		errs = append(errs, fmt.Sprintf("invalid device id: %s is not a valid UUID", request.ID))
+		errs = append(errs, invalidParam("id", "invalid device id: %s is not a valid UUID", request.ID))
 	}
 	if !validateAlgorithm(request.Algorithm) {
-		errs = append(errs, fmt.Sprintf("algorithm must be one of %s", utils.Algorithms))
+		errs = append(errs, invalidParam("algorithm", "algorithm must be one of %s", utils.Algorithms))
 	}
 	if request.Label != nil {
 		if !validateLabel(*request.Label) {
-			errs = append(errs, "invalid label")
+			errs = append(errs, invalidParam("label", "invalid label"))
 		}
 	}
+	errs = append(errs, validateMetadata(request.Metadata)...)
+	if request.PrivateKey != nil && request.WrappedPrivateKey != nil {
+		errs = append(errs, invalidParam("wrappedPrivateKey", "only one of privateKey and wrappedPrivateKey may be set"))
+	}
+	if request.PrivateKey != nil && *request.PrivateKey == "" {
+		errs = append(errs, invalidParam("privateKey", "invalid private key: key must not be empty"))
+	}
+	if request.WrappedPrivateKey != nil && *request.WrappedPrivateKey == "" {
+		errs = append(errs, invalidParam("wrappedPrivateKey", "invalid private key: key must not be empty"))
+	}
+	if request.MaxSignatures != nil && *request.MaxSignatures < 1 {
+		errs = append(errs, invalidParam("maxSignatures", "maxSignatures must be at least 1"))
+	}
 	return
 }
 
-func validateTransactionSignatureRequest(request *domain.SignTransactionRequest) (errs []string) {
+func validateUpdateSignatureDeviceRequest(request *domain.UpdateSignatureDeviceRequest) (errs []InvalidParam) {
+	if request.Status == nil && request.Label == nil && request.Metadata == nil {
+		errs = append(errs, invalidParam("", "at least one of status, label or metadata is required"))
+	}
+	if request.Status != nil && !slices.Contains(utils.DeviceStatuses, *request.Status) {
+		errs = append(errs, invalidParam("status", "status must be one of %s", utils.DeviceStatuses))
+	}
+	if request.Label != nil && !validateLabel(*request.Label) {
+		errs = append(errs, invalidParam("label", "invalid label"))
+	}
+	errs = append(errs, validateMetadataPatch(request.Metadata)...)
+	return
+}
+
+func validateRestoreRequest(request *domain.RestoreRequest) (errs []InvalidParam) {
+	if request.Archive == nil {
+		errs = append(errs, invalidParam("archive", "archive is required"))
+	}
+	return
+}
+
+// metadataQueryPrefix prefixes query parameters that filter devices by a
+// metadata entry, e.g. metadata.site=berlin.
+const metadataQueryPrefix = "metadata."
+
+// parseDeviceQuery reads the filters, sort order and page of a device listing
+// from the query parameters algorithm, status, labelPrefix, metadata.<key>,
+// createdAfter, createdBefore, lastSignedAfter, lastSignedBefore, sort, order,
+// limit and cursor. Times are given in RFC 3339 format.
+func parseDeviceQuery(values url.Values) (query domain.DeviceQuery, errs []InvalidParam) {
+	query = domain.DeviceQuery{
+		Algorithm:   values.Get("algorithm"),
+		Status:      values.Get("status"),
+		LabelPrefix: values.Get("labelPrefix"),
+		SortBy:      values.Get("sort"),
+		Cursor:      values.Get("cursor"),
+	}
+	if query.Algorithm != "" && !validateAlgorithm(query.Algorithm) {
+		errs = append(errs, invalidParam("algorithm", "algorithm must be one of %s", utils.Algorithms))
+	}
+	if query.Status != "" && !slices.Contains(utils.DeviceStatuses, query.Status) {
+		errs = append(errs, invalidParam("status", "status must be one of %s", utils.DeviceStatuses))
+	}
+	if query.SortBy != "" && !slices.Contains(utils.DeviceSortKeys, query.SortBy) {
+		errs = append(errs, invalidParam("sort", "sort must be one of %s", utils.DeviceSortKeys))
+	}
+	for _, filter := range []struct {
+		name string
+		time *time.Time
+	}{
+		{"createdAfter", &query.CreatedAfter},
+		{"createdBefore", &query.CreatedBefore},
+		{"lastSignedAfter", &query.LastSignedAfter},
+		{"lastSignedBefore", &query.LastSignedBefore},
+	} {
+		value := values.Get(filter.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errs = append(errs, invalidParam(filter.name, "%s must be an RFC 3339 time", filter.name))
+		}
+		*filter.time = parsed
+	}
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		errs = append(errs, invalidParam("order", "order must be one of [asc desc]"))
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > utils.MaxPageSize {
+			errs = append(errs, invalidParam("limit", "limit must be between 1 and %d", utils.MaxPageSize))
+		}
+		query.Limit = n
+	}
+	for name := range values {
+		key, found := strings.CutPrefix(name, metadataQueryPrefix)
+		if !found {
+			continue
+		}
+		if query.Metadata == nil {
+			query.Metadata = make(map[string]string)
+		}
+		query.Metadata[key] = values.Get(name)
+	}
+	errs = append(errs, validateMetadata(query.Metadata)...)
+	return
+}
+
+func validateTransactionSignatureRequest(request *domain.SignTransactionRequest) (errs []InvalidParam) {
 	if !validateUUID(request.ID) {
-		errs = append(errs, fmt.Sprintf("invalid device id: %s is not a valid UUID", request.ID))
+		errs = append(errs, invalidParam("id", "invalid device id: %s is not a valid UUID", request.ID))
 	}
 	if !validateData(request.Data) {
-		errs = append(errs, "invalid data: data must be in the format signatureCounter_data_lastSignature")
+		errs = append(errs, invalidParam("data", "invalid data: data must be in the format signatureCounter_data_lastSignature"))
+	}
+	return
+}
+
+func validateVerifySignatureRequest(request *domain.VerifySignatureRequest) (errs []InvalidParam) {
+	if !validateData(request.SignedData) {
+		errs = append(errs, invalidParam("signed_data", "invalid signed data: signed data must be in the format signatureCounter_data_lastSignature"))
+	}
+	if request.Signature == "" {
+		errs = append(errs, invalidParam("signature", "signature is required"))
 	}
 	return
 }
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
@@ -36,6 +38,45 @@ func TestValidateLabel(t *testing.T) {
 	requires := require.New(t)
 	requires.True(validateLabel(utils.RandomString(6)))
 	requires.False(validateLabel(""))
+	requires.False(validateLabel(strings.Repeat("a", utils.MaxLabelLength+1)))
+}
+
+func TestValidateMetadata(t *testing.T) {
+	requires := require.New(t)
+	tooMany := make(map[string]string)
+	for i := 0; i <= utils.MaxMetadataEntries; i++ {
+		tooMany[fmt.Sprintf("key-%d", i)] = "value"
+	}
+	requires.Empty(validateMetadata(nil))
+	requires.Empty(validateMetadata(map[string]string{"store_id": "berlin-1", "terminal.serial": "SN-1"}))
+	requires.Equal([]InvalidParam{{Name: "metadata", Reason: utils.ErrMetadataLimit.Error()}}, validateMetadata(tooMany))
+	requires.Len(validateMetadata(map[string]string{"store id": "berlin-1"}), 1)
+	requires.Len(validateMetadata(map[string]string{"": "berlin-1"}), 1)
+	requires.Len(validateMetadata(map[string]string{strings.Repeat("k", utils.MaxMetadataKeyLength+1): "v"}), 1)
+	requires.Len(validateMetadata(map[string]string{"store": strings.Repeat("v", utils.MaxMetadataValueLength+1)}), 1)
+}
+
+func TestValidateUpdateSignatureDeviceRequest(t *testing.T) {
+	requires := require.New(t)
+	value := func(v string) *string { return &v }
+	testCases := []struct {
+		name    string
+		request *domain.UpdateSignatureDeviceRequest
+		errs    int
+	}{
+		{name: "validateUpdateSignatureDeviceRequest_Status", request: &domain.UpdateSignatureDeviceRequest{Status: value(utils.DeviceStatusSuspended)}},
+		{name: "validateUpdateSignatureDeviceRequest_Label", request: &domain.UpdateSignatureDeviceRequest{Label: value("till 1")}},
+		{name: "validateUpdateSignatureDeviceRequest_Metadata", request: &domain.UpdateSignatureDeviceRequest{Metadata: map[string]*string{"store": value("berlin-1"), "serial": nil}}},
+		{name: "validateUpdateSignatureDeviceRequest_Empty", request: &domain.UpdateSignatureDeviceRequest{}, errs: 1},
+		{name: "validateUpdateSignatureDeviceRequest_Invalid_Status", request: &domain.UpdateSignatureDeviceRequest{Status: value("retired")}, errs: 1},
+		{name: "validateUpdateSignatureDeviceRequest_Invalid_Label", request: &domain.UpdateSignatureDeviceRequest{Label: value("")}, errs: 1},
+		{name: "validateUpdateSignatureDeviceRequest_Invalid_Metadata_Key", request: &domain.UpdateSignatureDeviceRequest{Metadata: map[string]*string{"store id": nil}}, errs: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requires.Len(validateUpdateSignatureDeviceRequest(tc.request), tc.errs)
+		})
+	}
 }
 
 func TestValidateSignatureDeviceRequest(t *testing.T) {
@@ -52,12 +93,12 @@ func TestValidateSignatureDeviceRequest(t *testing.T) {
 	testCases := []struct {
 		name          string
 		request       *domain.SignatureDeviceRequest
-		checkResponse func([]string)
+		checkResponse func([]InvalidParam)
 	}{
 		{
 			name:    "validateSignatureDeviceRequest_OK",
 			request: request,
-			checkResponse: func(s []string) {
+			checkResponse: func(s []InvalidParam) {
 				requires.Empty(s)
 			},
 		},
@@ -66,7 +107,7 @@ func TestValidateSignatureDeviceRequest(t *testing.T) {
 			request: &domain.SignatureDeviceRequest{
 				Label: &empty,
 			},
-			checkResponse: func(s []string) {
+			checkResponse: func(s []InvalidParam) {
 				requires.NotEmpty(s)
 			},
 		},
@@ -85,7 +126,7 @@ func TestValidateTransactionSignatureRequest(t *testing.T) {
 	testCases := []struct {
 		name          string
 		request       *domain.SignTransactionRequest
-		checkResponse func([]string)
+		checkResponse func([]InvalidParam)
 	}{
 		{
 			name: "validateTransactionSignatureRequest_OK",
@@ -93,14 +134,14 @@ func TestValidateTransactionSignatureRequest(t *testing.T) {
 				ID:   deviceId.String(),
 				Data: data,
 			},
-			checkResponse: func(s []string) {
+			checkResponse: func(s []InvalidParam) {
 				requires.Empty(s)
 			},
 		},
 		{
 			name:    "validateTransactionSignatureRequest_OK",
 			request: &domain.SignTransactionRequest{},
-			checkResponse: func(s []string) {
+			checkResponse: func(s []InvalidParam) {
 				requires.NotEmpty(s)
 			},
 		},
@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+
+	"github.com/uwemakan/signing-service/utils"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Key derivation functions of backup wrapping keys.
+const (
+	KDFPBKDF2 = "pbkdf2-sha256"
+	KDFHKDF   = "hkdf-sha256"
+)
+
+// WrappingKeySize is the size in bytes of backup wrapping keys and of the
+// keys they can be derived from.
+const WrappingKeySize = 32
+
+// wrappingKeyInfo binds keys derived with HKDF to their use.
+var wrappingKeyInfo = []byte("signature-device-backup")
+
+// DerivePassphraseKey derives a wrapping key from a passphrase with PBKDF2-SHA256.
+func DerivePassphraseKey(passphrase string, salt []byte, iterations int) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, iterations, WrappingKeySize, sha256.New)
+}
+
+// DeriveKey derives a wrapping key from a 256-bit key with HKDF-SHA256.
+func DeriveKey(key, salt []byte) ([]byte, error) {
+	wrappingKey := make([]byte, WrappingKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, wrappingKeyInfo), wrappingKey); err != nil {
+		return nil, err
+	}
+	return wrappingKey, nil
+}
+
+// EncryptGCM encrypts and authenticates plaintext with AES-GCM. The result is
+// the base64 encoded nonce followed by the ciphertext.
+func EncryptGCM(plaintext, key []byte) (string, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// DecryptGCM reverses EncryptGCM, failing with utils.ErrInvalidCiphertext if
+// the ciphertext was tampered with or encrypted under another key.
+func DecryptGCM(encodedCiphertext string, key []byte) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encodedCiphertext)
+	if err != nil {
+		return nil, utils.ErrInvalidCiphertext
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, utils.ErrInvalidCiphertext
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, utils.ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
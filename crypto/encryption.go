@@ -1,6 +1,5 @@
 package crypto
 
-
 import (
 	"bytes"
 	"crypto/aes"
@@ -8,6 +7,8 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"io"
+
+	"github.com/uwemakan/signing-service/utils"
 )
 
 // pkcs7Padding applies padding to ensure the plaintext fits AES's block size
@@ -46,10 +47,16 @@ func EncryptAES(plaintext, key []byte) (string, error) {
 }
 
 // pkcs7Unpadding removes padding from decrypted data
-func pkcs7Unpadding(data []byte) []byte {
+func pkcs7Unpadding(data []byte) ([]byte, error) {
 	length := len(data)
+	if length == 0 {
+		return nil, utils.ErrInvalidCiphertext
+	}
 	unpadding := int(data[length-1])
-	return data[:(length - unpadding)]
+	if unpadding == 0 || unpadding > aes.BlockSize || unpadding > length {
+		return nil, utils.ErrInvalidCiphertext
+	}
+	return data[:(length - unpadding)], nil
 }
 
 // Decryption function
@@ -64,6 +71,11 @@ func DecryptAES(encodedCiphertext string, key []byte) (string, error) {
 		return "", err
 	}
 
+	// The IV is followed by at least one block
+	if len(ciphertext) < 2*aes.BlockSize || len(ciphertext)%aes.BlockSize != 0 {
+		return "", utils.ErrInvalidCiphertext
+	}
+
 	// Extract the IV from the ciphertext
 	iv := ciphertext[:aes.BlockSize]
 	ciphertext = ciphertext[aes.BlockSize:]
@@ -74,8 +86,10 @@ func DecryptAES(encodedCiphertext string, key []byte) (string, error) {
 	mode.CryptBlocks(plaintext, ciphertext)
 
 	// Remove padding
-	plaintext = pkcs7Unpadding(plaintext)
+	plaintext, err = pkcs7Unpadding(plaintext)
+	if err != nil {
+		return "", err
+	}
 
 	return string(plaintext), nil
 }
-
@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -10,8 +11,8 @@ import (
 )
 
 type KeyPairFactory struct {
-	rsaGenerator  *RSAGenerator
-	eccGenerator  *ECCGenerator
+	rsaGenerator *RSAGenerator
+	eccGenerator *ECCGenerator
 }
 
 type KeyPair struct {
@@ -22,29 +23,38 @@ type KeyPair struct {
 // NewKeyPairFactory returns a new KeyPairFactory.
 func NewKeyPairFactory() *KeyPairFactory {
 	return &KeyPairFactory{
-		rsaGenerator:  &RSAGenerator{
-			rsaMarshaler:  &RSAMarshaler{},
+		rsaGenerator: &RSAGenerator{
+			rsaMarshaler: &RSAMarshaler{},
 		},
-		eccGenerator:  &ECCGenerator{
-			eccMarshaler:  &ECCMarshaler{},
+		eccGenerator: &ECCGenerator{
+			eccMarshaler: &ECCMarshaler{},
 		},
 	}
 }
 
-func (f *KeyPairFactory) GenerateKeyPair(algorithm string) ([]byte, []byte, error) {
+// GenerateKeyPair generates a key pair for the algorithm and returns its
+// marshaled public and private key. Key generation cannot be interrupted: ctx
+// is only checked before it starts, so that every generation is bounded by
+// the request that waits for it.
+func (f *KeyPairFactory) GenerateKeyPair(ctx context.Context, algorithm string) ([]byte, []byte, error) {
+	var generate func() ([]byte, []byte, error)
 	switch algorithm {
 	case "RSA":
-		return f.rsaGenerator.GenerateMarshaled()
+		generate = f.rsaGenerator.GenerateMarshaled
 	case "ECC":
-		return f.eccGenerator.GenerateMarshaled()
+		generate = f.eccGenerator.GenerateMarshaled
 	default:
 		return nil, nil, utils.ErrUnsupportedAlgorithm
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	return generate()
 }
 
 // RSAGenerator generates a RSA key pair.
-type RSAGenerator struct{
-	rsaMarshaler  *RSAMarshaler
+type RSAGenerator struct {
+	rsaMarshaler *RSAMarshaler
 }
 
 // Generate generates a new RSAKeyPair.
@@ -72,8 +82,8 @@ func (g *RSAGenerator) GenerateMarshaled() ([]byte, []byte, error) {
 }
 
 // ECCGenerator generates an ECC key pair.
-type ECCGenerator struct{
-	eccMarshaler  *ECCMarshaler
+type ECCGenerator struct {
+	eccMarshaler *ECCMarshaler
 }
 
 // Generate generates a new ECCKeyPair.
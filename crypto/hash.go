@@ -0,0 +1,18 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashAPIKey returns the hex encoded SHA-256 hash under which an API key is stored.
+func HashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// PublicKeyFingerprint returns the hex encoded SHA-256 hash of a PEM encoded public key.
+func PublicKeyFingerprint(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,65 @@
+package crypto
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// minRSAKeySize is the smallest RSA modulus in bits accepted for import,
+// matching the size of generated keys.
+const minRSAKeySize = 2048
+
+// ImportKeyPair parses a PEM encoded PKCS#1, PKCS#8 or SEC1 private key and
+// returns the public and private key marshaled like a generated key pair.
+// The key type must match the algorithm.
+func (f *KeyPairFactory) ImportKeyPair(ctx context.Context, algorithm string, privateKeyPEM []byte) ([]byte, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, nil, utils.ErrInvalidPrivateKey
+	}
+	key, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch algorithm {
+	case "RSA":
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, utils.ErrKeyAlgorithmMismatch
+		}
+		if rsaKey.N.BitLen() < minRSAKeySize {
+			return nil, nil, utils.ErrInvalidPrivateKey
+		}
+		return f.rsaGenerator.rsaMarshaler.Marshal(RSAKeyPair{Public: &rsaKey.PublicKey, Private: rsaKey})
+	case "ECC":
+		eccKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, utils.ErrKeyAlgorithmMismatch
+		}
+		return f.eccGenerator.eccMarshaler.Encode(ECCKeyPair{Public: &eccKey.PublicKey, Private: eccKey})
+	default:
+		return nil, nil, utils.ErrUnsupportedAlgorithm
+	}
+}
+
+// parsePrivateKey parses a DER encoded private key in any of the supported forms.
+func parsePrivateKey(der []byte) (any, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, utils.ErrInvalidPrivateKey
+}
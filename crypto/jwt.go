@@ -0,0 +1,279 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// jwtLeeway is the clock skew tolerated when checking exp and nbf.
+const jwtLeeway = 30 * time.Second
+
+// JWTClaims holds the registered claims the service relies on and the
+// private tenant claim binding a token to a tenant.
+type JWTClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt int64       `json:"exp"`
+	NotBefore int64       `json:"nbf"`
+	Scope     string      `json:"scope"`
+	Tenant    string      `json:"tenant"`
+}
+
+// Scopes returns the space separated scope claim as a slice.
+func (c *JWTClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// jwtAudience accepts the aud claim both as a single string and as an array.
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// JWTVerifier validates RS256, ES256 and EdDSA signed JSON Web Tokens
+// against a fixed set of public keys indexed by key ID.
+type JWTVerifier struct {
+	keys     map[string]crypto.PublicKey
+	issuer   string
+	audience string
+}
+
+// NewJWTVerifier returns a verifier for the given keys. Empty issuer or
+// audience values disable the corresponding claim check.
+func NewJWTVerifier(keys map[string]crypto.PublicKey, issuer, audience string) *JWTVerifier {
+	return &JWTVerifier{keys: keys, issuer: issuer, audience: audience}
+}
+
+// Verify checks the signature and the time, issuer and audience claims of
+// a compact serialized token and returns its claims.
+func (v *JWTVerifier) Verify(token string) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, utils.ErrInvalidToken
+	}
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, utils.ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, utils.ErrInvalidToken
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+	if !v.verifySignature(header, signingInput, signature) {
+		return nil, utils.ErrInvalidToken
+	}
+
+	var claims JWTClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, utils.ErrInvalidToken
+	}
+	now := time.Now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return nil, utils.ErrInvalidToken
+	}
+	if claims.NotBefore != 0 && now.Add(jwtLeeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, utils.ErrInvalidToken
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, utils.ErrInvalidToken
+	}
+	if v.audience != "" && !slices.Contains(claims.Audience, v.audience) {
+		return nil, utils.ErrInvalidToken
+	}
+	if claims.Subject == "" {
+		return nil, utils.ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// verifySignature checks the signature with the key named by the token's kid,
+// or with every configured key when the token doesn't name one.
+func (v *JWTVerifier) verifySignature(header jwtHeader, signingInput, signature []byte) bool {
+	if header.KeyID != "" {
+		key, exists := v.keys[header.KeyID]
+		return exists && verifyJWTSignature(header.Algorithm, key, signingInput, signature)
+	}
+	for _, key := range v.keys {
+		if verifyJWTSignature(header.Algorithm, key, signingInput, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyJWTSignature(algorithm string, key crypto.PublicKey, signingInput, signature []byte) bool {
+	switch algorithm {
+	case "RS256":
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		hashed := sha256.Sum256(signingInput)
+		return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signature) == nil
+	case "ES256":
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || publicKey.Curve != elliptic.P256() || len(signature) != 64 {
+			return false
+		}
+		hashed := sha256.Sum256(signingInput)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(publicKey, hashed[:], r, s)
+	case "EdDSA":
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return false
+		}
+		return ed25519.Verify(publicKey, signingInput, signature)
+	default:
+		return false
+	}
+}
+
+func decodeJWTSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ParsePublicKeyPEM parses a PEM encoded PKIX public key.
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// ParseJWKS parses the RSA, EC (P-256) and OKP (Ed25519) signing keys of a
+// JSON Web Key Set and indexes them by key ID.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(jwk)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		kid := jwk.KeyID
+		if kid == "" {
+			kid = fmt.Sprint(i)
+		}
+		keys[kid] = key
+	}
+	return keys, nil
+}
+
+func parseJWK(jwk jsonWebKey) (crypto.PublicKey, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if jwk.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid EC key")
+		}
+		// Let crypto/ecdh validate that the point is on the curve.
+		point := append([]byte{4}, append(x, y...)...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+	}
+}
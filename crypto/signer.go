@@ -1,6 +1,8 @@
 package crypto
 
 import (
+	"context"
+
 	"github.com/uwemakan/signing-service/utils"
 )
 
@@ -9,7 +11,7 @@ type Signer interface {
 	Sign(dataToBeSigned []byte) ([]byte, error)
 }
 
-type SignerFactory struct{
+type SignerFactory struct {
 	eccMarshaler *ECCMarshaler
 	rsaMarshaler *RSAMarshaler
 }
@@ -23,13 +25,16 @@ func NewSignerFactory() *SignerFactory {
 }
 
 // GetSigner returns a Signer implementation for a given algorithm and private key.
-func (f *SignerFactory) GetSigner(algorithm string, privateKey []byte) (Signer, error) {
-    switch algorithm {
-    case "RSA":
+func (f *SignerFactory) GetSigner(ctx context.Context, algorithm string, privateKey []byte) (Signer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	switch algorithm {
+	case "RSA":
 		return f.rsaMarshaler.Unmarshal(privateKey)
-    case "ECC":
-        return f.eccMarshaler.Decode(privateKey)
-    default:
-        return nil, utils.ErrUnsupportedAlgorithm
-    }
+	case "ECC":
+		return f.eccMarshaler.Decode(privateKey)
+	default:
+		return nil, utils.ErrUnsupportedAlgorithm
+	}
 }
@@ -0,0 +1,74 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// errInvalidPublicKey is returned for public keys that are not PEM encoded
+// keys of the algorithm.
+var errInvalidPublicKey = errors.New("invalid public key")
+
+// ParsePublicKey parses a PEM encoded public key of the algorithm in the
+// format the key pairs of the algorithm are marshaled in.
+func ParsePublicKey(algorithm string, publicKey []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return nil, errInvalidPublicKey
+	}
+	switch algorithm {
+	case "RSA":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "ECC":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := parsed.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, errInvalidPublicKey
+		}
+		return key, nil
+	default:
+		return nil, utils.ErrUnsupportedAlgorithm
+	}
+}
+
+// Verify reports whether signature is a signature of data made with the
+// private key of the PEM encoded public key, in the format the signers of the
+// algorithm produce.
+func Verify(algorithm string, publicKey, data, signature []byte) (bool, error) {
+	parsed, err := ParsePublicKey(algorithm, publicKey)
+	if err != nil {
+		return false, err
+	}
+	switch key := parsed.(type) {
+	case *rsa.PublicKey:
+		hashed := sha512.Sum512(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA512, hashed[:], signature) == nil, nil
+	case *ecdsa.PublicKey:
+		// ECC signatures are the hex encoded r and s joined by an underscore.
+		rText, sText, found := strings.Cut(string(signature), "_")
+		if !found {
+			return false, nil
+		}
+		r, rOK := new(big.Int).SetString(rText, 16)
+		s, sOK := new(big.Int).SetString(sText, 16)
+		if !rOK || !sOK {
+			return false, nil
+		}
+		hashed := sha512.Sum384(data)
+		return ecdsa.Verify(key, hashed[:], r, s), nil
+	default:
+		return false, errInvalidPublicKey
+	}
+}
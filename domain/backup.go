@@ -0,0 +1,61 @@
+package domain
+
+import "time"
+
+// BackupSecret is the passphrase or base64 encoded 256-bit key a backup
+// archive is encrypted with. Exactly one of them is set.
+type BackupSecret struct {
+	Passphrase string `json:"passphrase,omitempty"`
+	Key        string `json:"key,omitempty"`
+}
+
+// BackupArchive is an encrypted export of signature devices. Ciphertext
+// holds the BackupPayload encrypted with a wrapping key derived from the
+// BackupSecret with KDF and Salt.
+type BackupArchive struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       string `json:"salt"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// BackupPayload is the decrypted content of a BackupArchive.
+type BackupPayload struct {
+	Devices []DeviceBackup `json:"devices"`
+}
+
+// DeviceBackup is the exported state of a device. WrappedPrivateKey is the
+// private key encrypted with the wrapping key of the archive and is empty
+// for decommissioned devices.
+type DeviceBackup struct {
+	ID                string            `json:"id"`
+	Algorithm         string            `json:"algorithm"`
+	Label             string            `json:"label"`
+	Owner             string            `json:"owner,omitempty"`
+	Terminal          string            `json:"terminal,omitempty"`
+	Status            string            `json:"status"`
+	SignatureCounter  int               `json:"signatureCounter"`
+	LastSignature     string            `json:"lastSignature"`
+	KeyVersion        int               `json:"keyVersion"`
+	KeyHistory        []DeviceKey       `json:"keyHistory,omitempty"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+	CreatedAt         time.Time         `json:"createdAt"`
+	UpdatedAt         time.Time         `json:"updatedAt"`
+	LastSignedAt      *time.Time        `json:"lastSignedAt,omitempty"`
+	MaxSignatures     *int              `json:"maxSignatures,omitempty"`
+	NotAfter          *time.Time        `json:"notAfter,omitempty"`
+	PublicKey         string            `json:"publicKey"`
+	WrappedPrivateKey string            `json:"wrappedPrivateKey,omitempty"`
+}
+
+// RestoreRequest restores the devices of an archive.
+type RestoreRequest struct {
+	BackupSecret
+	Archive *BackupArchive `json:"archive"`
+}
+
+// RestoreResponse reports the number of restored devices.
+type RestoreResponse struct {
+	Restored int `json:"restored"`
+}
@@ -1,19 +1,112 @@
 package domain
 
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// SignatureDevice is a device that signs transactions. Devices created for a
+// limited time or number of signatures stop signing once their signature
+// counter reaches MaxSignatures or NotAfter has passed.
 type SignatureDevice struct {
-	ID               string `json:"id"`
-	Algorithm        string `json:"algorithm"`
-	Label            string `json:"label"`
-	SignatureCounter int    `json:"signatureCounter"`
-	LastSignature    string `json:"lastSignature"`
-	PublicKey        string `json:"-"`
-	PrivateKey       string `json:"-"`
+	ID               string            `json:"id"`
+	TenantID         string            `json:"tenantId"`
+	Algorithm        string            `json:"algorithm"`
+	Label            string            `json:"label"`
+	Owner            string            `json:"owner,omitempty"`
+	Terminal         string            `json:"terminal,omitempty"`
+	Status           string            `json:"status"`
+	SignatureCounter int               `json:"signatureCounter"`
+	LastSignature    string            `json:"lastSignature"`
+	KeyVersion       int               `json:"keyVersion"`
+	KeyHistory       []DeviceKey       `json:"keyHistory,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	UpdatedAt        time.Time         `json:"updatedAt"`
+	LastSignedAt     *time.Time        `json:"lastSignedAt,omitempty"`
+	MaxSignatures    *int              `json:"maxSignatures,omitempty"`
+	NotAfter         *time.Time        `json:"notAfter,omitempty"`
+	PublicKey        string            `json:"-"`
+	PrivateKey       string            `json:"-"`
+}
+
+// RemainingSignatures returns the number of signatures left in the quota of
+// the device, or nil when the device has no quota.
+func (d *SignatureDevice) RemainingSignatures() *int {
+	if d.MaxSignatures == nil {
+		return nil
+	}
+	remaining := max(*d.MaxSignatures-d.SignatureCounter, 0)
+	return &remaining
+}
+
+// RollsBack reports whether replacing current with the device would roll back
+// its signature chain, its key or its status: a lower signature counter or
+// key version, another signature at the same counter or a less restrictive
+// status.
+func (d *SignatureDevice) RollsBack(current *SignatureDevice) bool {
+	switch {
+	case d.SignatureCounter < current.SignatureCounter, d.KeyVersion < current.KeyVersion:
+		return true
+	case d.SignatureCounter == current.SignatureCounter && d.LastSignature != current.LastSignature:
+		return true
+	}
+	return slices.Index(utils.DeviceStatuses, d.Status) < slices.Index(utils.DeviceStatuses, current.Status)
+}
+
+// MarshalJSON adds the remaining signature quota to devices with a quota.
+func (d SignatureDevice) MarshalJSON() ([]byte, error) {
+	type device SignatureDevice
+	return json.Marshal(struct {
+		device
+		RemainingSignatures *int `json:"remainingSignatures,omitempty"`
+	}{device(d), d.RemainingSignatures()})
+}
+
+// DeviceKey is a retired public key of a device, kept to verify the
+// signatures made while it was in use.
+type DeviceKey struct {
+	Version   int    `json:"version"`
+	PublicKey string `json:"publicKey"`
 }
 
+// KeyRotation is the record of a key rotation. SignedData links the
+// fingerprints of the previous and the new public key into the signature
+// chain and is signed with the previous key.
+type KeyRotation struct {
+	DeviceID          string `json:"deviceId"`
+	KeyVersion        int    `json:"keyVersion"`
+	PreviousPublicKey string `json:"previousPublicKey"`
+	PublicKey         string `json:"publicKey"`
+	Signature         string `json:"signature"`
+	SignedData        string `json:"signed_data"`
+}
+
+// SignatureDeviceRequest creates a device. Keys are generated unless a PEM
+// encoded PrivateKey or a WrappedPrivateKey, encrypted with the service's key
+// encryption key, is imported. MaxSignatures and NotAfter optionally limit
+// how many signatures the device makes and until when.
 type SignatureDeviceRequest struct {
-	ID        string  `json:"id"`
-	Algorithm string  `json:"algorithm"`
-	Label     *string `json:"label"`
+	ID                string            `json:"id"`
+	Algorithm         string            `json:"algorithm"`
+	Label             *string           `json:"label"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+	PrivateKey        *string           `json:"privateKey,omitempty"`
+	WrappedPrivateKey *string           `json:"wrappedPrivateKey,omitempty"`
+	MaxSignatures     *int              `json:"maxSignatures,omitempty"`
+	NotAfter          *time.Time        `json:"notAfter,omitempty"`
+}
+
+// UpdateSignatureDeviceRequest partially updates a device. Fields left out
+// are unchanged. Metadata is merged into the metadata of the device and keys
+// set to null are removed.
+type UpdateSignatureDeviceRequest struct {
+	Status   *string            `json:"status,omitempty"`
+	Label    *string            `json:"label,omitempty"`
+	Metadata map[string]*string `json:"metadata,omitempty"`
 }
 
 type SignTransactionResponse struct {
@@ -21,6 +114,21 @@ type SignTransactionResponse struct {
 	SignedData string `json:"signed_data"`
 }
 
+// SignatureVerification is the result of verifying a signature of a device.
+// KeyVersion is the version of the key that made a valid signature, which is
+// a retired key for signatures made before a key rotation.
+type SignatureVerification struct {
+	Valid      bool `json:"valid"`
+	KeyVersion int  `json:"keyVersion,omitempty"`
+}
+
+// VerifySignatureRequest is a signature and the data it was returned with by
+// signing a transaction or rotating the key of a device.
+type VerifySignatureRequest struct {
+	SignedData string `json:"signed_data"`
+	Signature  string `json:"signature"`
+}
+
 type SignTransactionRequest struct {
 	ID   string `json:"id"`
 	Data string `json:"data"`
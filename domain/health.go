@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// HealthCheck is one measurement of a component the service depends on, in
+// the format of the health check response draft
+// (draft-inadarei-api-health-check).
+type HealthCheck struct {
+	ComponentType string    `json:"componentType,omitempty"`
+	ObservedValue any       `json:"observedValue,omitempty"`
+	ObservedUnit  string    `json:"observedUnit,omitempty"`
+	Status        string    `json:"status"`
+	Time          time.Time `json:"time"`
+	Output        string    `json:"output,omitempty"`
+}
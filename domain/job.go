@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// Job tracks the progress of an asynchronous signature device creation.
+type Job struct {
+	ID       string           `json:"id"`
+	TenantID string           `json:"tenantId"`
+	Status   string           `json:"status"`
+	Device   *SignatureDevice `json:"device,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Owner    string           `json:"-"`
+	// FinishedAt is when the job succeeded or failed, zero while pending.
+	FinishedAt time.Time `json:"-"`
+}
@@ -0,0 +1,41 @@
+package domain
+
+import "log/slog"
+
+// The types below implement slog.LogValuer so that logging them never
+// includes key material, secrets or the data being signed.
+
+func (d *SignatureDevice) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", d.ID),
+		slog.String("tenantId", d.TenantID),
+		slog.String("algorithm", d.Algorithm),
+		slog.String("status", d.Status),
+		slog.Int("signatureCounter", d.SignatureCounter),
+		slog.Int("keyVersion", d.KeyVersion),
+	)
+}
+
+func (r *SignatureDeviceRequest) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", r.ID),
+		slog.String("algorithm", r.Algorithm),
+		slog.Bool("importedKey", r.PrivateKey != nil || r.WrappedPrivateKey != nil),
+	)
+}
+
+func (r *SignTransactionRequest) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("id", r.ID))
+}
+
+func (s BackupSecret) LogValue() slog.Value {
+	return slog.StringValue("[REDACTED]")
+}
+
+func (p *Principal) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", p.ID),
+		slog.String("owner", p.Owner),
+		slog.String("tenant", p.Tenant),
+	)
+}
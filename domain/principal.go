@@ -0,0 +1,47 @@
+package domain
+
+import "slices"
+
+// Principal identifies the authenticated caller of a request. Terminal holds
+// the subject of the client certificate the request was made with, if any.
+// A principal with a Tenant may only act within that tenant. Credential is
+// the utils.Credentials type the principal authenticated with; IDs are only
+// unique per credential type, so Owner is qualified with it too.
+type Principal struct {
+	ID         string   `json:"id"`
+	Credential string   `json:"credential"`
+	Owner      string   `json:"owner"`
+	Tenant     string   `json:"tenant,omitempty"`
+	Scopes     []string `json:"scopes"`
+	Terminal   string   `json:"terminal,omitempty"`
+	// AnyOwner is set once a role based access control policy has granted
+	// the principal a permission, which it may then exercise on the devices
+	// and jobs of every owner of its tenant, not only its own.
+	AnyOwner bool `json:"-"`
+}
+
+// HasScope reports whether the principal has been granted the scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// QualifiedID returns the ID of the principal prefixed with its credential
+// type, e.g. jwt:<subject>, so that an API key and a token subject with the
+// same ID can't be mistaken for one another.
+func (p *Principal) QualifiedID() string {
+	return Qualify(p.Credential, p.ID)
+}
+
+// Qualify prefixes the ID of a principal or owner with the credential type it
+// was authenticated with.
+func Qualify(credential, id string) string {
+	return credential + ":" + id
+}
+
+// APIKey is a stored API key. Only the SHA-256 hash of the secret is kept.
+type APIKey struct {
+	ID     string `json:"id"`
+	Owner  string `json:"owner"`
+	Tenant string `json:"tenant,omitempty"`
+	Hash   string `json:"-"`
+}
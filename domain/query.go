@@ -0,0 +1,30 @@
+package domain
+
+import "time"
+
+// DeviceQuery selects a page of devices. Empty filters match every device
+// and metadata filters match devices that have all of the given entries.
+// A nil Owner matches devices of every owner. The time filters are exclusive
+// and devices that have never signed count as signed before any time.
+type DeviceQuery struct {
+	Owner            *string
+	Algorithm        string
+	Status           string
+	LabelPrefix      string
+	Metadata         map[string]string
+	CreatedAfter     time.Time
+	CreatedBefore    time.Time
+	LastSignedAfter  time.Time
+	LastSignedBefore time.Time
+	SortBy           string
+	Descending       bool
+	Limit            int
+	Cursor           string
+}
+
+// DevicePage is a page of devices. NextCursor continues the query after the
+// last device of the page and is empty on the last page.
+type DevicePage struct {
+	Devices    []*SignatureDevice
+	NextCursor string
+}
@@ -1,22 +1,43 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"log/slog"
+	"os"
 
 	"github.com/uwemakan/signing-service/api"
+	"github.com/uwemakan/signing-service/tracing"
 	"github.com/uwemakan/signing-service/utils"
-)
-
-const (
-	ListenAddress = ":8080"
+	"go.opentelemetry.io/otel"
 )
 
 func main() {
-	server := api.NewServer(utils.NewConfig())
-	log.Default().Println("Starting server on ", ListenAddress)
+	insecureNoAuth := flag.Bool("insecure-no-auth", false, "serve every request unauthenticated when no authentication is configured")
+	flag.Parse()
+	config := utils.NewConfig()
+	config.InsecureNoAuth = *insecureNoAuth
+	slog.SetDefault(utils.NewLogger(os.Stderr, config.LogLevel, config.LogFormat))
+	otel.SetTextMapPropagator(tracing.Propagator)
+	// Spans still buffered are flushed before exiting.
+	shutdownTracing := func(context.Context) error { return nil }
+	if config.Tracing.Enabled() {
+		tracerProvider, err := tracing.NewTracerProvider(context.Background(), config.Tracing)
+		if err != nil {
+			slog.Error("could not set up tracing", "endpoint", config.Tracing.Endpoint, "error", err)
+			os.Exit(1)
+		}
+		otel.SetTracerProvider(tracerProvider)
+		shutdownTracing = tracerProvider.Shutdown
+	}
+	server := api.NewServer(config)
+	slog.Info("starting server", "address", config.ServerAddress, "grpc_address", config.GRPCAddress, "tls", config.TLS.Enabled(), "tracing", config.Tracing.Enabled())
 
-	if err := server.Run(); err != nil {
-		log.Fatal("Could not start server on ", ListenAddress)
+	err := server.Run()
+	shutdownTracing(context.Background())
+	if err != nil {
+		slog.Error("server stopped", "address", config.ServerAddress, "error", err)
+		os.Exit(1)
 	}
-	log.Default().Println("Starting server on ", ListenAddress)
+	slog.Info("server stopped", "address", config.ServerAddress)
 }
@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+const namespace = "signing_service"
+
+// OutcomeSuccess labels operations that succeeded. Failed operations are
+// labelled with the utils.ErrorCode of their error.
+const OutcomeSuccess = "success"
+
+// AlgorithmUnknown labels signatures that failed before the device, and so
+// its algorithm, was found.
+const AlgorithmUnknown = "unknown"
+
+// Metrics are the Prometheus metrics of the service. A nil *Metrics is valid
+// and records nothing, so that components can be used without metrics.
+type Metrics struct {
+	DevicesCreated      *prometheus.CounterVec
+	Signatures          *prometheus.CounterVec
+	KeyGeneration       *prometheus.HistogramVec
+	Decryption          prometheus.Histogram
+	Signing             *prometheus.HistogramVec
+	RequestsInFlight    *prometheus.GaugeVec
+	RepositoryOperation *prometheus.HistogramVec
+	RateLimitRequests   *prometheus.CounterVec
+	RateLimitBuckets    *prometheus.GaugeVec
+}
+
+// New creates the metrics of the service and registers them, along with the
+// Go runtime and process collectors, with registerer.
+func New(registerer prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		DevicesCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "devices_created_total",
+			Help:      "Number of signature devices created by algorithm.",
+		}, []string{"algorithm"}),
+		Signatures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signatures_total",
+			Help:      "Number of transaction signatures by algorithm and outcome.",
+		}, []string{"algorithm", "outcome"}),
+		KeyGeneration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "key_generation_seconds",
+			Help:      "Time taken to generate device key pairs by algorithm.",
+			Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"algorithm"}),
+		Decryption: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "private_key_decryption_seconds",
+			Help:      "Time taken to decrypt device private keys.",
+			Buckets:   prometheus.ExponentialBuckets(.00001, 4, 8),
+		}),
+		Signing: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "signing_seconds",
+			Help:      "Time taken to sign data by algorithm.",
+			Buckets:   prometheus.ExponentialBuckets(.00005, 4, 8),
+		}, []string{"algorithm"}),
+		RequestsInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of HTTP requests being served by route.",
+		}, []string{"route"}),
+		RepositoryOperation: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_operation_seconds",
+			Help:      "Time taken by device repository operations.",
+			Buckets:   prometheus.ExponentialBuckets(.000001, 4, 10),
+		}, []string{"operation"}),
+		RateLimitRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_requests_total",
+			Help:      "Number of requests checked by rate limiters by limiter and result.",
+		}, []string{"limiter", "result"}),
+		RateLimitBuckets: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_buckets",
+			Help:      "Number of token buckets held by rate limiters.",
+		}, []string{"limiter"}),
+	}
+	registerer.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.DevicesCreated,
+		m.Signatures,
+		m.KeyGeneration,
+		m.Decryption,
+		m.Signing,
+		m.RequestsInFlight,
+		m.RepositoryOperation,
+		m.RateLimitRequests,
+		m.RateLimitBuckets,
+	)
+	// Export every outcome from the start, so that rates of rare errors are
+	// not missing until they first happen.
+	for _, algorithm := range utils.Algorithms {
+		m.DevicesCreated.WithLabelValues(algorithm)
+		m.Signatures.WithLabelValues(algorithm, OutcomeSuccess)
+		for _, code := range utils.ErrorCodes() {
+			m.Signatures.WithLabelValues(algorithm, code)
+		}
+	}
+	return m
+}
+
+// Outcome labels the result of an operation that returned err.
+func Outcome(err error) string {
+	if err == nil {
+		return OutcomeSuccess
+	}
+	return utils.ErrorCode(err)
+}
+
+func (m *Metrics) DeviceCreated(algorithm string) {
+	if m == nil {
+		return
+	}
+	m.DevicesCreated.WithLabelValues(algorithm).Inc()
+}
+
+func (m *Metrics) Signature(algorithm string, err error) {
+	if m == nil {
+		return
+	}
+	m.Signatures.WithLabelValues(algorithm, Outcome(err)).Inc()
+}
+
+func (m *Metrics) ObserveKeyGeneration(algorithm string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.KeyGeneration.WithLabelValues(algorithm).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) ObserveDecryption(start time.Time) {
+	if m == nil {
+		return
+	}
+	m.Decryption.Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) ObserveSigning(algorithm string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.Signing.WithLabelValues(algorithm).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) ObserveRepositoryOperation(operation string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.RepositoryOperation.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// RequestStarted counts a request of the route as in flight until the
+// returned function is called.
+func (m *Metrics) RequestStarted(route string) func() {
+	if m == nil {
+		return func() {}
+	}
+	gauge := m.RequestsInFlight.WithLabelValues(route)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+func (m *Metrics) RateLimitChecked(limiter string, allowed bool) {
+	if m == nil {
+		return
+	}
+	result := "allowed"
+	if !allowed {
+		result = "limited"
+	}
+	m.RateLimitRequests.WithLabelValues(limiter, result).Inc()
+}
+
+func (m *Metrics) RateLimitBucketsChanged(limiter string, delta int) {
+	if m == nil {
+		return
+	}
+	m.RateLimitBuckets.WithLabelValues(limiter).Add(float64(delta))
+}
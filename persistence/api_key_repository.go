@@ -0,0 +1,10 @@
+package persistence
+
+import (
+	"github.com/uwemakan/signing-service/domain"
+)
+
+type APIKeyRepository interface {
+	CreateAPIKey(key *domain.APIKey) error
+	GetAPIKeyByHash(hash string) (*domain.APIKey, error)
+}
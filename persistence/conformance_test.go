@@ -0,0 +1,522 @@
+package persistence
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// testSignatureDeviceRepositoryConformance checks the behaviour every
+// SignatureDeviceRepository implementation must provide. newRepository must
+// return an empty repository timestamping devices with the given clock on
+// every call.
+func testSignatureDeviceRepositoryConformance(t *testing.T, newRepository func(clock utils.Clock) SignatureDeviceRepository) {
+	epoch := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	newDevice := func(tenantID, id string) *domain.SignatureDevice {
+		return &domain.SignatureDevice{
+			ID:         id,
+			TenantID:   tenantID,
+			Algorithm:  utils.Algorithms[0],
+			Label:      utils.RandomString(6),
+			PublicKey:  utils.RandomString(16),
+			PrivateKey: utils.RandomString(16),
+		}
+	}
+
+	t.Run("CreateDevice", func(t *testing.T) {
+		requires := require.New(t)
+		repo := newRepository(utils.NewFakeClock(epoch))
+		device := newDevice(utils.DefaultTenant, utils.RandomString(16))
+		device.SignatureCounter = 10
+		device.LastSignature = utils.RandomString(16)
+
+		created, err := repo.CreateDevice(context.Background(), device)
+		requires.NoError(err)
+		requires.Equal(device.ID, created.ID)
+		requires.Equal(device.TenantID, created.TenantID)
+		requires.Equal(device.PublicKey, created.PublicKey)
+		requires.Equal(device.PrivateKey, created.PrivateKey)
+		requires.Equal(0, created.SignatureCounter)
+		requires.Equal(base64.StdEncoding.EncodeToString([]byte(device.ID)), created.LastSignature)
+		requires.Equal(utils.DeviceStatusActive, created.Status)
+		requires.Equal(1, created.KeyVersion)
+
+		created, err = repo.CreateDevice(context.Background(), device)
+		requires.ErrorIs(err, utils.ErrDeviceAlreadyExists)
+		requires.Nil(created)
+	})
+
+	t.Run("GetDevice", func(t *testing.T) {
+		requires := require.New(t)
+		repo := newRepository(utils.NewFakeClock(epoch))
+		device, err := repo.CreateDevice(context.Background(), newDevice(utils.DefaultTenant, utils.RandomString(16)))
+		requires.NoError(err)
+
+		found, err := repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+		requires.NoError(err)
+		requires.Equal(device, found)
+
+		found, err = repo.GetDevice(context.Background(), utils.DefaultTenant, utils.RandomString(16))
+		requires.ErrorIs(err, utils.ErrDeviceNotFound)
+		requires.Nil(found)
+	})
+
+	t.Run("UpdateDevice", func(t *testing.T) {
+		requires := require.New(t)
+		repo := newRepository(utils.NewFakeClock(epoch))
+		device, err := repo.CreateDevice(context.Background(), newDevice(utils.DefaultTenant, utils.RandomString(16)))
+		requires.NoError(err)
+		signature := utils.RandomString(24)
+
+		requires.NoError(repo.UpdateDevice(context.Background(), utils.DefaultTenant, device.ID, 0, signature))
+		found, err := repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+		requires.NoError(err)
+		requires.Equal(1, found.SignatureCounter)
+		requires.Equal(signature, found.LastSignature)
+
+		// A signature made at an outdated counter is not stored.
+		err = repo.UpdateDevice(context.Background(), utils.DefaultTenant, device.ID, 0, utils.RandomString(24))
+		requires.ErrorIs(err, utils.ErrSignatureConflict)
+		found, err = repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+		requires.NoError(err)
+		requires.Equal(1, found.SignatureCounter)
+		requires.Equal(signature, found.LastSignature)
+
+		err = repo.UpdateDevice(context.Background(), utils.DefaultTenant, utils.RandomString(16), 0, signature)
+		requires.ErrorIs(err, utils.ErrDeviceNotFound)
+	})
+
+	t.Run("UpdateDeviceChecksSigning", func(t *testing.T) {
+		requires := require.New(t)
+		clock := utils.NewFakeClock(epoch)
+		repo := newRepository(clock)
+
+		suspended, err := repo.CreateDevice(context.Background(), newDevice(utils.DefaultTenant, utils.RandomString(16)))
+		requires.NoError(err)
+		requires.NoError(repo.UpdateDeviceStatus(context.Background(), utils.DefaultTenant, suspended.ID, utils.DeviceStatusSuspended))
+		err = repo.UpdateDevice(context.Background(), utils.DefaultTenant, suspended.ID, 0, utils.RandomString(24))
+		requires.ErrorIs(err, utils.ErrDeviceNotActive)
+
+		limited := newDevice(utils.DefaultTenant, utils.RandomString(16))
+		maxSignatures := 1
+		limited.MaxSignatures = &maxSignatures
+		_, err = repo.CreateDevice(context.Background(), limited)
+		requires.NoError(err)
+		requires.NoError(repo.UpdateDevice(context.Background(), utils.DefaultTenant, limited.ID, 0, utils.RandomString(24)))
+		err = repo.UpdateDevice(context.Background(), utils.DefaultTenant, limited.ID, 1, utils.RandomString(24))
+		requires.ErrorIs(err, utils.ErrSignatureQuotaExhausted)
+
+		expiring := newDevice(utils.DefaultTenant, utils.RandomString(16))
+		notAfter := epoch.Add(time.Hour)
+		expiring.NotAfter = &notAfter
+		_, err = repo.CreateDevice(context.Background(), expiring)
+		requires.NoError(err)
+		clock.Advance(time.Hour)
+		err = repo.UpdateDevice(context.Background(), utils.DefaultTenant, expiring.ID, 0, utils.RandomString(24))
+		requires.ErrorIs(err, utils.ErrDeviceExpired)
+
+		// Key rotations take a position in the chain and are refused alike.
+		err = repo.RotateDeviceKey(context.Background(), utils.DefaultTenant, limited.ID, 1, utils.RandomString(16), utils.RandomString(16), utils.RandomString(24))
+		requires.ErrorIs(err, utils.ErrSignatureQuotaExhausted)
+		err = repo.RotateDeviceKey(context.Background(), utils.DefaultTenant, expiring.ID, 0, utils.RandomString(16), utils.RandomString(16), utils.RandomString(24))
+		requires.ErrorIs(err, utils.ErrDeviceExpired)
+
+		for _, id := range []string{suspended.ID, limited.ID, expiring.ID} {
+			found, err := repo.GetDevice(context.Background(), utils.DefaultTenant, id)
+			requires.NoError(err)
+			requires.Equal(map[string]int{limited.ID: 1}[id], found.SignatureCounter)
+		}
+	})
+
+	t.Run("UpdateDeviceStatus", func(t *testing.T) {
+		requires := require.New(t)
+		repo := newRepository(utils.NewFakeClock(epoch))
+		device, err := repo.CreateDevice(context.Background(), newDevice(utils.DefaultTenant, utils.RandomString(16)))
+		requires.NoError(err)
+		privateKey := device.PrivateKey
+
+		requires.NoError(repo.UpdateDeviceStatus(context.Background(), utils.DefaultTenant, device.ID, utils.DeviceStatusSuspended))
+		found, err := repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+		requires.NoError(err)
+		requires.Equal(utils.DeviceStatusSuspended, found.Status)
+		requires.Equal(privateKey, found.PrivateKey)
+
+		// Decommissioning destroys the private key but keeps the public key.
+		requires.NoError(repo.UpdateDeviceStatus(context.Background(), utils.DefaultTenant, device.ID, utils.DeviceStatusDecommissioned))
+		found, err = repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+		requires.NoError(err)
+		requires.Equal(utils.DeviceStatusDecommissioned, found.Status)
+		requires.Empty(found.PrivateKey)
+		requires.Equal(device.PublicKey, found.PublicKey)
+
+		err = repo.UpdateDeviceStatus(context.Background(), utils.DefaultTenant, utils.RandomString(16), utils.DeviceStatusActive)
+		requires.ErrorIs(err, utils.ErrDeviceNotFound)
+	})
+
+	t.Run("UpdateDeviceDetails", func(t *testing.T) {
+		requires := require.New(t)
+		repo := newRepository(utils.NewFakeClock(epoch))
+		device := newDevice(utils.DefaultTenant, utils.RandomString(16))
+		device.Metadata = map[string]string{"store": "berlin-1"}
+		created, err := repo.CreateDevice(context.Background(), device)
+		requires.NoError(err)
+		requires.Equal(device.Metadata, created.Metadata)
+
+		metadata := map[string]string{"store": "berlin-2", "serial": "SN-1"}
+		requires.NoError(repo.UpdateDeviceDetails(context.Background(), utils.DefaultTenant, device.ID, utils.DeviceStatusActive, "till 2", metadata))
+		metadata["serial"] = "SN-2"
+		found, err := repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+		requires.NoError(err)
+		requires.Equal("till 2", found.Label)
+		requires.Equal(map[string]string{"store": "berlin-2", "serial": "SN-1"}, found.Metadata)
+		requires.NotEmpty(found.PrivateKey)
+
+		// Status, label and metadata change together.
+		requires.NoError(repo.UpdateDeviceDetails(context.Background(), utils.DefaultTenant, device.ID, utils.DeviceStatusDecommissioned, "retired", nil))
+		found, err = repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+		requires.NoError(err)
+		requires.Equal(utils.DeviceStatusDecommissioned, found.Status)
+		requires.Equal("retired", found.Label)
+		requires.Empty(found.Metadata)
+		requires.Empty(found.PrivateKey)
+
+		err = repo.UpdateDeviceDetails(context.Background(), utils.DefaultTenant, utils.RandomString(16), utils.DeviceStatusActive, "", nil)
+		requires.ErrorIs(err, utils.ErrDeviceNotFound)
+	})
+
+	t.Run("RotateDeviceKey", func(t *testing.T) {
+		requires := require.New(t)
+		repo := newRepository(utils.NewFakeClock(epoch))
+		device, err := repo.CreateDevice(context.Background(), newDevice(utils.DefaultTenant, utils.RandomString(16)))
+		requires.NoError(err)
+		previousPublicKey := device.PublicKey
+
+		for version := 2; version <= 3; version++ {
+			publicKey, privateKey, signature := utils.RandomString(16), utils.RandomString(16), utils.RandomString(24)
+			requires.NoError(repo.RotateDeviceKey(context.Background(), utils.DefaultTenant, device.ID, version-2, publicKey, privateKey, signature))
+			found, err := repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+			requires.NoError(err)
+			requires.Equal(version, found.KeyVersion)
+			requires.Equal(publicKey, found.PublicKey)
+			requires.Equal(privateKey, found.PrivateKey)
+			requires.Equal(version-1, found.SignatureCounter)
+			requires.Equal(signature, found.LastSignature)
+			requires.Len(found.KeyHistory, version-1)
+			requires.Equal(domain.DeviceKey{Version: version - 1, PublicKey: previousPublicKey}, found.KeyHistory[version-2])
+			previousPublicKey = publicKey
+		}
+
+		// A rotation signed at an outdated counter or of an inactive device
+		// is not stored.
+		err = repo.RotateDeviceKey(context.Background(), utils.DefaultTenant, device.ID, 1, utils.RandomString(16), utils.RandomString(16), utils.RandomString(24))
+		requires.ErrorIs(err, utils.ErrSignatureConflict)
+		requires.NoError(repo.UpdateDeviceStatus(context.Background(), utils.DefaultTenant, device.ID, utils.DeviceStatusSuspended))
+		err = repo.RotateDeviceKey(context.Background(), utils.DefaultTenant, device.ID, 2, utils.RandomString(16), utils.RandomString(16), utils.RandomString(24))
+		requires.ErrorIs(err, utils.ErrDeviceNotActive)
+		found, err := repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+		requires.NoError(err)
+		requires.Equal(3, found.KeyVersion)
+		requires.Equal(previousPublicKey, found.PublicKey)
+
+		err = repo.RotateDeviceKey(context.Background(), utils.DefaultTenant, utils.RandomString(16), 0, "", "", "")
+		requires.ErrorIs(err, utils.ErrDeviceNotFound)
+	})
+
+	t.Run("RestoreDevices", func(t *testing.T) {
+		requires := require.New(t)
+		repo := newRepository(utils.NewFakeClock(epoch))
+		device := newDevice(utils.DefaultTenant, utils.RandomString(16))
+		device.Status = utils.DeviceStatusSuspended
+		device.SignatureCounter = 42
+		device.LastSignature = utils.RandomString(24)
+		device.KeyVersion = 2
+		device.KeyHistory = []domain.DeviceKey{{Version: 1, PublicKey: utils.RandomString(16)}}
+		lastSignedAt := epoch.Add(-time.Hour)
+		device.CreatedAt = epoch.Add(-48 * time.Hour)
+		device.UpdatedAt = epoch.Add(-time.Minute)
+		device.LastSignedAt = &lastSignedAt
+
+		requires.NoError(repo.RestoreDevices(context.Background(), []*domain.SignatureDevice{device}))
+		found, err := repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+		requires.NoError(err)
+		requires.Equal(device, found)
+
+		// An existing device is replaced by a newer backup but never rolled
+		// back.
+		rolledBack := *device
+		rolledBack.SignatureCounter--
+		requires.ErrorIs(repo.RestoreDevices(context.Background(), []*domain.SignatureDevice{&rolledBack}), utils.ErrBackupRollback)
+		rolledBack = *device
+		rolledBack.LastSignature = utils.RandomString(24)
+		requires.ErrorIs(repo.RestoreDevices(context.Background(), []*domain.SignatureDevice{&rolledBack}), utils.ErrBackupRollback)
+		rolledBack = *device
+		rolledBack.Status = utils.DeviceStatusActive
+		requires.ErrorIs(repo.RestoreDevices(context.Background(), []*domain.SignatureDevice{&rolledBack}), utils.ErrBackupRollback)
+		newer := *device
+		newer.SignatureCounter++
+		newer.Status = utils.DeviceStatusDecommissioned
+		requires.NoError(repo.RestoreDevices(context.Background(), []*domain.SignatureDevice{&newer}))
+		found, err = repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+		requires.NoError(err)
+		requires.Equal(&newer, found)
+		count, err := repo.CountDevices(context.Background(), utils.DefaultTenant)
+		requires.NoError(err)
+		requires.Equal(1, count)
+
+		// Devices backed up without timestamps are stamped on restore.
+		device = newDevice(utils.DefaultTenant, utils.RandomString(16))
+		requires.NoError(repo.RestoreDevices(context.Background(), []*domain.SignatureDevice{device}))
+		found, err = repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+		requires.NoError(err)
+		requires.Equal(epoch, found.CreatedAt)
+		requires.Equal(epoch, found.UpdatedAt)
+		requires.Nil(found.LastSignedAt)
+
+		// Nothing is restored if any device would be rolled back.
+		added := newDevice(utils.DefaultTenant, utils.RandomString(16))
+		rolledBack = newer
+		rolledBack.SignatureCounter--
+		err = repo.RestoreDevices(context.Background(), []*domain.SignatureDevice{added, &rolledBack})
+		requires.ErrorIs(err, utils.ErrBackupRollback)
+		_, err = repo.GetDevice(context.Background(), utils.DefaultTenant, added.ID)
+		requires.ErrorIs(err, utils.ErrDeviceNotFound)
+		found, err = repo.GetDevice(context.Background(), utils.DefaultTenant, newer.ID)
+		requires.NoError(err)
+		requires.Equal(&newer, found)
+	})
+
+	t.Run("Timestamps", func(t *testing.T) {
+		requires := require.New(t)
+		clock := utils.NewFakeClock(epoch)
+		repo := newRepository(clock)
+		get := func(id string) *domain.SignatureDevice {
+			device, err := repo.GetDevice(context.Background(), utils.DefaultTenant, id)
+			requires.NoError(err)
+			return device
+		}
+
+		first, err := repo.CreateDevice(context.Background(), newDevice(utils.DefaultTenant, utils.RandomString(16)))
+		requires.NoError(err)
+		requires.Equal(epoch, first.CreatedAt)
+		requires.Equal(epoch, first.UpdatedAt)
+		requires.Nil(first.LastSignedAt)
+
+		clock.Advance(time.Minute)
+		second, err := repo.CreateDevice(context.Background(), newDevice(utils.DefaultTenant, utils.RandomString(16)))
+		requires.NoError(err)
+		clock.Advance(time.Minute)
+		requires.NoError(repo.UpdateDevice(context.Background(), utils.DefaultTenant, first.ID, 0, utils.RandomString(24)))
+		signedAt := epoch.Add(2 * time.Minute)
+		requires.Equal(epoch, get(first.ID).CreatedAt)
+		requires.Equal(signedAt, get(first.ID).UpdatedAt)
+		requires.Equal(&signedAt, get(first.ID).LastSignedAt)
+
+		clock.Advance(time.Minute)
+		requires.NoError(repo.UpdateDeviceDetails(context.Background(), utils.DefaultTenant, first.ID, utils.DeviceStatusActive, "till", nil))
+		requires.Equal(epoch.Add(3*time.Minute), get(first.ID).UpdatedAt)
+		requires.Equal(&signedAt, get(first.ID).LastSignedAt)
+		clock.Advance(time.Minute)
+		requires.NoError(repo.RotateDeviceKey(context.Background(), utils.DefaultTenant, second.ID, 0, utils.RandomString(16), utils.RandomString(16), utils.RandomString(24)))
+		rotatedAt := epoch.Add(4 * time.Minute)
+		requires.Equal(rotatedAt, get(second.ID).UpdatedAt)
+		requires.Equal(&rotatedAt, get(second.ID).LastSignedAt)
+		clock.Advance(time.Minute)
+		requires.NoError(repo.UpdateDeviceStatus(context.Background(), utils.DefaultTenant, second.ID, utils.DeviceStatusSuspended))
+		requires.Equal(epoch.Add(5*time.Minute), get(second.ID).UpdatedAt)
+		requires.Equal(&rotatedAt, get(second.ID).LastSignedAt)
+
+		ids := func(query domain.DeviceQuery) (ids []string) {
+			page, err := repo.QueryDevices(context.Background(), utils.DefaultTenant, query)
+			requires.NoError(err)
+			for _, device := range page.Devices {
+				ids = append(ids, device.ID)
+			}
+			return
+		}
+		requires.Equal([]string{second.ID, first.ID}, ids(domain.DeviceQuery{SortBy: utils.DeviceSortCreated, Descending: true}))
+		requires.Equal([]string{first.ID, second.ID}, ids(domain.DeviceQuery{SortBy: utils.DeviceSortUpdated}))
+		requires.Equal([]string{first.ID, second.ID}, ids(domain.DeviceQuery{SortBy: utils.DeviceSortLastSigned}))
+		requires.Equal([]string{second.ID}, ids(domain.DeviceQuery{CreatedAfter: epoch}))
+		requires.Equal([]string{first.ID}, ids(domain.DeviceQuery{CreatedBefore: epoch.Add(time.Minute)}))
+		requires.Equal([]string{second.ID}, ids(domain.DeviceQuery{LastSignedAfter: signedAt}))
+		requires.Equal([]string{first.ID}, ids(domain.DeviceQuery{LastSignedBefore: rotatedAt}))
+
+		// Devices that have never signed sort first and count as idle.
+		clock.Advance(time.Minute)
+		third, err := repo.CreateDevice(context.Background(), newDevice(utils.DefaultTenant, utils.RandomString(16)))
+		requires.NoError(err)
+		requires.Equal([]string{third.ID, first.ID, second.ID}, ids(domain.DeviceQuery{SortBy: utils.DeviceSortLastSigned}))
+		requires.Equal([]string{first.ID, third.ID}, ids(domain.DeviceQuery{LastSignedBefore: rotatedAt}))
+	})
+
+	t.Run("QueryDevices", func(t *testing.T) {
+		requires := require.New(t)
+		repo := newRepository(utils.NewFakeClock(epoch))
+		owner := utils.RandomString(8)
+		var created []*domain.SignatureDevice
+		for i := range 5 {
+			device := newDevice(utils.DefaultTenant, utils.RandomString(16))
+			device.Algorithm = utils.Algorithms[i%2]
+			device.Label = fmt.Sprintf("till-%d", i)
+			device.Metadata = map[string]string{"site": []string{"berlin", "lagos"}[i%2]}
+			if i < 3 {
+				device.Owner = owner
+			}
+			d, err := repo.CreateDevice(context.Background(), device)
+			requires.NoError(err)
+			created = append(created, d)
+		}
+		// Sign with the devices in reverse order of creation.
+		for i, device := range created {
+			for counter := range 5 - i {
+				requires.NoError(repo.UpdateDevice(context.Background(), utils.DefaultTenant, device.ID, counter, utils.RandomString(24)))
+			}
+		}
+		_, err := repo.CreateDevice(context.Background(), newDevice("tenant-b", utils.RandomString(16)))
+		requires.NoError(err)
+		ids := func(page *domain.DevicePage) (ids []string) {
+			for _, device := range page.Devices {
+				ids = append(ids, device.ID)
+			}
+			return
+		}
+
+		// Pages follow each other without gaps or overlaps.
+		query := domain.DeviceQuery{Limit: 2}
+		var all []string
+		for {
+			page, err := repo.QueryDevices(context.Background(), utils.DefaultTenant, query)
+			requires.NoError(err)
+			requires.LessOrEqual(len(page.Devices), 2)
+			all = append(all, ids(page)...)
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+		requires.Equal([]string{created[0].ID, created[1].ID, created[2].ID, created[3].ID, created[4].ID}, all)
+
+		page, err := repo.QueryDevices(context.Background(), utils.DefaultTenant, domain.DeviceQuery{SortBy: utils.DeviceSortSignatureCounter})
+		requires.NoError(err)
+		requires.Equal([]string{created[4].ID, created[3].ID, created[2].ID, created[1].ID, created[0].ID}, ids(page))
+		page, err = repo.QueryDevices(context.Background(), utils.DefaultTenant, domain.DeviceQuery{SortBy: utils.DeviceSortSignatureCounter, Descending: true, Limit: 3})
+		requires.NoError(err)
+		requires.Equal([]string{created[0].ID, created[1].ID, created[2].ID}, ids(page))
+		page, err = repo.QueryDevices(context.Background(), utils.DefaultTenant, domain.DeviceQuery{
+			SortBy:     utils.DeviceSortSignatureCounter,
+			Descending: true,
+			Cursor:     page.NextCursor,
+		})
+		requires.NoError(err)
+		requires.Equal([]string{created[3].ID, created[4].ID}, ids(page))
+		requires.Empty(page.NextCursor)
+
+		page, err = repo.QueryDevices(context.Background(), utils.DefaultTenant, domain.DeviceQuery{
+			Owner:       &owner,
+			Algorithm:   utils.Algorithms[0],
+			LabelPrefix: "till-",
+			Metadata:    map[string]string{"site": "berlin"},
+		})
+		requires.NoError(err)
+		requires.Equal([]string{created[0].ID, created[2].ID}, ids(page))
+		requires.NoError(repo.UpdateDeviceStatus(context.Background(), utils.DefaultTenant, created[2].ID, utils.DeviceStatusSuspended))
+		page, err = repo.QueryDevices(context.Background(), utils.DefaultTenant, domain.DeviceQuery{Status: utils.DeviceStatusSuspended})
+		requires.NoError(err)
+		requires.Equal([]string{created[2].ID}, ids(page))
+		page, err = repo.QueryDevices(context.Background(), utils.DefaultTenant, domain.DeviceQuery{LabelPrefix: "pos-"})
+		requires.NoError(err)
+		requires.NotNil(page.Devices)
+		requires.Empty(page.Devices)
+
+		// Cursors are only valid for the sort order they were issued for.
+		page, err = repo.QueryDevices(context.Background(), utils.DefaultTenant, domain.DeviceQuery{Limit: 1})
+		requires.NoError(err)
+		_, err = repo.QueryDevices(context.Background(), utils.DefaultTenant, domain.DeviceQuery{Cursor: page.NextCursor, Descending: true})
+		requires.ErrorIs(err, utils.ErrInvalidCursor)
+		_, err = repo.QueryDevices(context.Background(), utils.DefaultTenant, domain.DeviceQuery{Cursor: "not-a-cursor"})
+		requires.ErrorIs(err, utils.ErrInvalidCursor)
+	})
+
+	t.Run("TenantIsolation", func(t *testing.T) {
+		requires := require.New(t)
+		repo := newRepository(utils.NewFakeClock(epoch))
+		tenantA := "tenant-a"
+		tenantB := "tenant-b"
+		id := utils.RandomString(16)
+
+		deviceA, err := repo.CreateDevice(context.Background(), newDevice(tenantA, id))
+		requires.NoError(err)
+
+		// Another tenant can neither read nor sign with the device.
+		found, err := repo.GetDevice(context.Background(), tenantB, id)
+		requires.ErrorIs(err, utils.ErrDeviceNotFound)
+		requires.Nil(found)
+		err = repo.UpdateDevice(context.Background(), tenantB, id, 0, utils.RandomString(24))
+		requires.ErrorIs(err, utils.ErrDeviceNotFound)
+		devices, err := repo.ListDevices(context.Background(), tenantB)
+		requires.NoError(err)
+		requires.Empty(devices)
+		count, err := repo.CountDevices(context.Background(), tenantB)
+		requires.NoError(err)
+		requires.Zero(count)
+
+		// Device IDs are unique per tenant only.
+		deviceB, err := repo.CreateDevice(context.Background(), newDevice(tenantB, id))
+		requires.NoError(err)
+		requires.NotEqual(deviceA.PrivateKey, deviceB.PrivateKey)
+
+		requires.NoError(repo.UpdateDevice(context.Background(), tenantB, id, 0, utils.RandomString(24)))
+		found, err = repo.GetDevice(context.Background(), tenantA, id)
+		requires.NoError(err)
+		requires.Equal(0, found.SignatureCounter)
+		requires.Equal(deviceA.PrivateKey, found.PrivateKey)
+
+		for tenantID, device := range map[string]*domain.SignatureDevice{tenantA: deviceA, tenantB: deviceB} {
+			devices, err := repo.ListDevices(context.Background(), tenantID)
+			requires.NoError(err)
+			requires.Len(devices, 1)
+			requires.Equal(tenantID, devices[0].TenantID)
+			requires.Equal(device.PrivateKey, devices[0].PrivateKey)
+		}
+	})
+
+	t.Run("Cancellation", func(t *testing.T) {
+		requires := require.New(t)
+		repo := newRepository(utils.NewFakeClock(epoch))
+		device, err := repo.CreateDevice(context.Background(), newDevice(utils.DefaultTenant, utils.RandomString(16)))
+		requires.NoError(err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// Operations fail with the error of a done context and change nothing.
+		_, err = repo.CreateDevice(ctx, newDevice(utils.DefaultTenant, utils.RandomString(16)))
+		requires.ErrorIs(err, context.Canceled)
+		_, err = repo.GetDevice(ctx, utils.DefaultTenant, device.ID)
+		requires.ErrorIs(err, context.Canceled)
+		_, err = repo.ListDevices(ctx, utils.DefaultTenant)
+		requires.ErrorIs(err, context.Canceled)
+		_, err = repo.QueryDevices(ctx, utils.DefaultTenant, domain.DeviceQuery{})
+		requires.ErrorIs(err, context.Canceled)
+		_, err = repo.CountDevices(ctx, utils.DefaultTenant)
+		requires.ErrorIs(err, context.Canceled)
+		requires.ErrorIs(repo.UpdateDevice(ctx, utils.DefaultTenant, device.ID, 0, utils.RandomString(24)), context.Canceled)
+		requires.ErrorIs(repo.UpdateDeviceStatus(ctx, utils.DefaultTenant, device.ID, utils.DeviceStatusSuspended), context.Canceled)
+		requires.ErrorIs(repo.UpdateDeviceDetails(ctx, utils.DefaultTenant, device.ID, utils.DeviceStatusActive, "label", nil), context.Canceled)
+		requires.ErrorIs(repo.RotateDeviceKey(ctx, utils.DefaultTenant, device.ID, 0, "public", "private", "signature"), context.Canceled)
+		requires.ErrorIs(repo.RestoreDevices(ctx, []*domain.SignatureDevice{newDevice(utils.DefaultTenant, utils.RandomString(16))}), context.Canceled)
+
+		found, err := repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+		requires.NoError(err)
+		requires.Equal(device, found)
+		count, err := repo.CountDevices(context.Background(), utils.DefaultTenant)
+		requires.NoError(err)
+		requires.Equal(1, count)
+	})
+}
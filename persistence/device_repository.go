@@ -1,12 +1,64 @@
 package persistence
 
 import (
+	"context"
+
 	"github.com/uwemakan/signing-service/domain"
 )
 
+// SignatureDeviceRepository stores signature devices partitioned by tenant.
+// Device IDs are unique within a tenant and every lookup is scoped to one.
+// Repositories maintain the CreatedAt, UpdatedAt and LastSignedAt timestamps
+// of devices: every update touches UpdatedAt and signing, including the
+// signature of a key rotation, sets LastSignedAt. Operations fail with the
+// error of ctx once it is cancelled or past its deadline.
 type SignatureDeviceRepository interface {
-	CreateDevice(id, algorithm, publicKey, privateKey, label string) (*domain.SignatureDevice, error)
-	GetDevice(id string) (*domain.SignatureDevice, error)
-	ListDevices() ([]*domain.SignatureDevice, error)
-	UpdateDevice(deviceID, newSignature string) error
+	CreateDevice(ctx context.Context, device *domain.SignatureDevice) (*domain.SignatureDevice, error)
+	GetDevice(ctx context.Context, tenantID, id string) (*domain.SignatureDevice, error)
+	ListDevices(ctx context.Context, tenantID string) ([]*domain.SignatureDevice, error)
+	// QueryDevices returns the page of devices of the tenant matching the
+	// query. Cursors are opaque to callers and only valid for the same sort
+	// order; an invalid cursor fails with utils.ErrInvalidCursor.
+	QueryDevices(ctx context.Context, tenantID string, query domain.DeviceQuery) (*domain.DevicePage, error)
+	CountDevices(ctx context.Context, tenantID string) (int, error)
+	// UpdateDevice stores the signature a device made at signatureCounter and
+	// advances its counter. It fails with utils.ErrSignatureConflict unless
+	// the device is still at signatureCounter, and like signing does with
+	// utils.ErrDeviceNotActive, utils.ErrDeviceExpired or
+	// utils.ErrSignatureQuotaExhausted, all checked atomically with the update.
+	UpdateDevice(ctx context.Context, tenantID, deviceID string, signatureCounter int, newSignature string) error
+	// UpdateDeviceStatus sets the lifecycle status of a device. Decommissioning
+	// a device erases its private key.
+	UpdateDeviceStatus(ctx context.Context, tenantID, deviceID, status string) error
+	// UpdateDeviceDetails replaces the status, label and metadata of a device
+	// in a single update. Decommissioning erases the private key like
+	// UpdateDeviceStatus does.
+	UpdateDeviceDetails(ctx context.Context, tenantID, deviceID, status, label string, metadata map[string]string) error
+	// RotateDeviceKey replaces the key pair of a device, moving the current
+	// public key to the key history and bumping the key version. The signature
+	// of the rotation record, made at signatureCounter, advances the signature
+	// chain like a transaction and fails for the same reasons as UpdateDevice.
+	RotateDeviceKey(ctx context.Context, tenantID, deviceID string, signatureCounter int, publicKey, privateKey, signature string) error
+	// RestoreDevices stores devices from a backup as is, keeping their
+	// signature counters, last signatures, statuses, key histories and
+	// timestamps. Missing timestamps are set to the time of the restore.
+	// Existing devices are replaced unless the backup rolls one of them back,
+	// which fails with utils.ErrBackupRollback. The devices are restored all
+	// at once or, if any of them fails, not at all.
+	RestoreDevices(ctx context.Context, devices []*domain.SignatureDevice) error
+}
+
+// Flusher is implemented by repositories that buffer writes, e.g. in a
+// write-ahead log, which must be flushed before the process exits.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Flush flushes the writes buffered by repo if it is a Flusher and does
+// nothing otherwise.
+func Flush(ctx context.Context, repo any) error {
+	if flusher, ok := repo.(Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+	return nil
 }
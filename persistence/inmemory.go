@@ -1,77 +1,454 @@
 package persistence
 
 import (
+	"cmp"
+	"context"
 	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/uwemakan/signing-service/domain"
 	"github.com/uwemakan/signing-service/utils"
 )
 
 type InMemorySignatureDeviceRepository struct {
-    devices map[string]*domain.SignatureDevice
-    mu      sync.RWMutex
+	// devices maps tenant IDs to the devices of the tenant by device ID.
+	devices map[string]map[string]*domain.SignatureDevice
+	// sequence records the order in which devices were stored.
+	sequence     map[*domain.SignatureDevice]int64
+	nextSequence int64
+	clock        utils.Clock
+	logger       *slog.Logger
+	mu           sync.RWMutex
 }
 
-func NewInMemorySignatureDeviceRepository() *InMemorySignatureDeviceRepository {
-    return &InMemorySignatureDeviceRepository{
-        devices: make(map[string]*domain.SignatureDevice),
-    }
+// NewInMemorySignatureDeviceRepository creates a repository that logs to
+// logger, or the default slog logger when it is nil.
+func NewInMemorySignatureDeviceRepository(logger *slog.Logger) *InMemorySignatureDeviceRepository {
+	return NewInMemorySignatureDeviceRepositoryWithClock(utils.SystemClock{}, logger)
 }
 
-func (repo *InMemorySignatureDeviceRepository) CreateDevice(id, algorithm, publicKey, privateKey, label string) (*domain.SignatureDevice, error) {
-    repo.mu.Lock()
-    defer repo.mu.Unlock()
+// NewInMemorySignatureDeviceRepositoryWithClock creates a repository that
+// timestamps devices with the given clock.
+func NewInMemorySignatureDeviceRepositoryWithClock(clock utils.Clock, logger *slog.Logger) *InMemorySignatureDeviceRepository {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &InMemorySignatureDeviceRepository{
+		devices:  make(map[string]map[string]*domain.SignatureDevice),
+		sequence: make(map[*domain.SignatureDevice]int64),
+		clock:    clock,
+		logger:   logger,
+	}
+}
+
+// store adds a device to its tenant. The caller must hold the write lock.
+func (repo *InMemorySignatureDeviceRepository) store(device *domain.SignatureDevice) error {
+	tenant, exists := repo.devices[device.TenantID]
+	if !exists {
+		tenant = make(map[string]*domain.SignatureDevice)
+		repo.devices[device.TenantID] = tenant
+	}
+	if _, exists := tenant[device.ID]; exists {
+		repo.logger.Debug("device already exists", "tenant", device.TenantID, "device_id", device.ID)
+		return utils.ErrDeviceAlreadyExists
+	}
+	tenant[device.ID] = device
+	repo.nextSequence++
+	repo.sequence[device] = repo.nextSequence
+	repo.logger.Debug("device stored", "tenant", device.TenantID, "device_id", device.ID, "sequence", repo.nextSequence)
+	return nil
+}
+
+// snapshot returns a copy of a stored device, so that callers read a
+// consistent state while the device is updated. The key history and
+// metadata are replaced rather than changed in place and can be shared.
+func snapshot(device *domain.SignatureDevice) *domain.SignatureDevice {
+	copied := *device
+	return &copied
+}
+
+// CreateDevice stores a new device. The signature counter, last signature,
+// status, key version and timestamps of the given device are ignored and
+// initialised for a fresh device.
+func (repo *InMemorySignatureDeviceRepository) CreateDevice(ctx context.Context, device *domain.SignatureDevice) (*domain.SignatureDevice, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	created := *device
+	created.SignatureCounter = 0
+	created.LastSignature = base64.StdEncoding.EncodeToString([]byte(device.ID))
+	created.Status = utils.DeviceStatusActive
+	created.KeyVersion = 1
+	created.KeyHistory = nil
+	created.Metadata = maps.Clone(device.Metadata)
+	created.CreatedAt = repo.clock.Now()
+	created.UpdatedAt = created.CreatedAt
+	created.LastSignedAt = nil
+	if err := repo.store(&created); err != nil {
+		return nil, err
+	}
+	return snapshot(&created), nil
+}
+
+// RestoreDevices checks every device against the device it replaces before
+// storing any of them.
+func (repo *InMemorySignatureDeviceRepository) RestoreDevices(ctx context.Context, devices []*domain.SignatureDevice) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, device := range devices {
+		if existing, exists := repo.devices[device.TenantID][device.ID]; exists && device.RollsBack(existing) {
+			return utils.ErrBackupRollback
+		}
+	}
+	now := repo.clock.Now()
+	for _, device := range devices {
+		restored := *device
+		restored.KeyHistory = slices.Clone(device.KeyHistory)
+		restored.Metadata = maps.Clone(device.Metadata)
+		if restored.CreatedAt.IsZero() {
+			restored.CreatedAt = now
+		}
+		if restored.UpdatedAt.IsZero() {
+			restored.UpdatedAt = restored.CreatedAt
+		}
+		if existing, exists := repo.devices[restored.TenantID][restored.ID]; exists {
+			*existing = restored
+			continue
+		}
+		// The device was checked not to exist above, storing it can't fail.
+		repo.store(&restored)
+	}
+	return nil
+}
+
+func (repo *InMemorySignatureDeviceRepository) GetDevice(ctx context.Context, tenantID, id string) (*domain.SignatureDevice, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	device, exists := repo.devices[tenantID][id]
+	if !exists {
+		return nil, utils.ErrDeviceNotFound
+	}
+	return snapshot(device), nil
+}
+
+func (repo *InMemorySignatureDeviceRepository) ListDevices(ctx context.Context, tenantID string) ([]*domain.SignatureDevice, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	tenant := repo.devices[tenantID]
+	devices := make([]*domain.SignatureDevice, 0, len(tenant))
+	for _, device := range tenant {
+		devices = append(devices, snapshot(device))
+	}
+	return devices, nil
+}
+
+// inMemoryCursor points at the last device of a page by its sort key and
+// sequence number.
+type inMemoryCursor struct {
+	SortBy     string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	Key        int64  `json:"k"`
+	Sequence   int64  `json:"q"`
+}
+
+func decodeCursor(query domain.DeviceQuery) (*inMemoryCursor, error) {
+	if query.Cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil {
+		return nil, utils.ErrInvalidCursor
+	}
+	var cursor inMemoryCursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, utils.ErrInvalidCursor
+	}
+	if cursor.SortBy != query.SortBy || cursor.Descending != query.Descending {
+		return nil, utils.ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+func (cursor *inMemoryCursor) encode() string {
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// lastSignedAt returns when the device last signed, devices that have never
+// signed are treated as having signed at the zero time.
+func lastSignedAt(device *domain.SignatureDevice) time.Time {
+	if device.LastSignedAt == nil {
+		return time.Time{}
+	}
+	return *device.LastSignedAt
+}
+
+// sortKey returns the value the query sorts the device by.
+func sortKey(device *domain.SignatureDevice, sortBy string) int64 {
+	switch sortBy {
+	case utils.DeviceSortSignatureCounter:
+		return int64(device.SignatureCounter)
+	case utils.DeviceSortUpdated:
+		return device.UpdatedAt.UnixNano()
+	case utils.DeviceSortLastSigned:
+		if device.LastSignedAt == nil {
+			return math.MinInt64
+		}
+		return device.LastSignedAt.UnixNano()
+	default:
+		return device.CreatedAt.UnixNano()
+	}
+}
+
+func matches(device *domain.SignatureDevice, query domain.DeviceQuery) bool {
+	if query.Owner != nil && device.Owner != *query.Owner {
+		return false
+	}
+	if query.Algorithm != "" && device.Algorithm != query.Algorithm {
+		return false
+	}
+	if query.Status != "" && device.Status != query.Status {
+		return false
+	}
+	if !strings.HasPrefix(device.Label, query.LabelPrefix) {
+		return false
+	}
+	if !query.CreatedAfter.IsZero() && !device.CreatedAt.After(query.CreatedAfter) {
+		return false
+	}
+	if !query.CreatedBefore.IsZero() && !device.CreatedAt.Before(query.CreatedBefore) {
+		return false
+	}
+	if !query.LastSignedAfter.IsZero() && !lastSignedAt(device).After(query.LastSignedAfter) {
+		return false
+	}
+	if !query.LastSignedBefore.IsZero() && !lastSignedAt(device).Before(query.LastSignedBefore) {
+		return false
+	}
+	for key, value := range query.Metadata {
+		if v, exists := device.Metadata[key]; !exists || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryDevices filters and sorts the devices of the tenant. Devices with the
+// same sort key, such as devices created at the same time or never signed,
+// are ordered by the order they were stored in.
+func (repo *InMemorySignatureDeviceRepository) QueryDevices(ctx context.Context, tenantID string, query domain.DeviceQuery) (*domain.DevicePage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if query.SortBy == "" {
+		query.SortBy = utils.DeviceSortCreated
+	}
+	cursor, err := decodeCursor(query)
+	if err != nil {
+		return nil, err
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = utils.DefaultPageSize
+	}
+	limit = min(limit, utils.MaxPageSize)
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	type entry struct {
+		device   *domain.SignatureDevice
+		key      int64
+		sequence int64
+	}
+	compare := func(key, sequence int64, other entry) int {
+		c := cmp.Or(cmp.Compare(key, other.key), cmp.Compare(sequence, other.sequence))
+		if query.Descending {
+			return -c
+		}
+		return c
+	}
+	var entries []entry
+	for _, device := range repo.devices[tenantID] {
+		if !matches(device, query) {
+			continue
+		}
+		sequence := repo.sequence[device]
+		e := entry{device: device, key: sortKey(device, query.SortBy), sequence: sequence}
+		// Skip devices up to and including the last device of the previous page.
+		if cursor != nil && compare(cursor.Key, cursor.Sequence, e) >= 0 {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return compare(a.key, a.sequence, b)
+	})
+
+	page := &domain.DevicePage{Devices: make([]*domain.SignatureDevice, 0, min(limit, len(entries)))}
+	for _, e := range entries[:min(limit, len(entries))] {
+		page.Devices = append(page.Devices, snapshot(e.device))
+	}
+	if len(entries) > limit {
+		last := entries[limit-1]
+		page.NextCursor = (&inMemoryCursor{
+			SortBy:     query.SortBy,
+			Descending: query.Descending,
+			Key:        last.key,
+			Sequence:   last.sequence,
+		}).encode()
+	}
+	return page, nil
+}
 
-    if _, exists := repo.devices[id]; exists {
-        return nil, utils.ErrDeviceAlreadyExists
-    }
+func (repo *InMemorySignatureDeviceRepository) CountDevices(ctx context.Context, tenantID string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
 
-    device := &domain.SignatureDevice{
-        ID:              id,
-        Algorithm:       algorithm,
-        PublicKey:       publicKey,
-        PrivateKey:      privateKey,
-        Label:           label,
-        SignatureCounter: 0,
-        LastSignature:   base64.StdEncoding.EncodeToString([]byte(id)),
-    }
-    repo.devices[id] = device
-    return device, nil
+	return len(repo.devices[tenantID]), nil
 }
 
-func (repo *InMemorySignatureDeviceRepository) GetDevice(id string) (*domain.SignatureDevice, error) {
-    repo.mu.RLock()
-    defer repo.mu.RUnlock()
+func (repo *InMemorySignatureDeviceRepository) UpdateDevice(ctx context.Context, tenantID, deviceId string, signatureCounter int, newSignature string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	device, exists := repo.devices[tenantID][deviceId]
+	if !exists {
+		return utils.ErrDeviceNotFound
+	}
+	if err := repo.checkSigning(device, signatureCounter); err != nil {
+		return err
+	}
+
+	now := repo.clock.Now()
+	device.SignatureCounter++
+	device.LastSignature = newSignature
+	device.UpdatedAt = now
+	device.LastSignedAt = &now
+	return nil
+}
 
-    device, exists := repo.devices[id]
-    if !exists {
-        return nil, utils.ErrDeviceNotFound
-    }
-    return device, nil
+// checkSigning checks that the device may store a signature made at
+// signatureCounter. The caller must hold the write lock.
+func (repo *InMemorySignatureDeviceRepository) checkSigning(device *domain.SignatureDevice, signatureCounter int) error {
+	if device.Status != utils.DeviceStatusActive {
+		return utils.ErrDeviceNotActive
+	}
+	if device.NotAfter != nil && !repo.clock.Now().Before(*device.NotAfter) {
+		return utils.ErrDeviceExpired
+	}
+	if remaining := device.RemainingSignatures(); remaining != nil && *remaining == 0 {
+		return utils.ErrSignatureQuotaExhausted
+	}
+	if device.SignatureCounter != signatureCounter {
+		return utils.ErrSignatureConflict
+	}
+	return nil
 }
 
-func (repo *InMemorySignatureDeviceRepository) ListDevices() ([]*domain.SignatureDevice, error) {
-    repo.mu.RLock()
-    defer repo.mu.RUnlock()
+func (repo *InMemorySignatureDeviceRepository) UpdateDeviceStatus(ctx context.Context, tenantID, deviceId, status string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	device, exists := repo.devices[tenantID][deviceId]
+	if !exists {
+		return utils.ErrDeviceNotFound
+	}
+
+	repo.setStatus(device, status)
+	device.UpdatedAt = repo.clock.Now()
+	return nil
+}
+
+// setStatus sets the status of a device, erasing its private key when it is
+// decommissioned. The caller must hold the write lock.
+func (repo *InMemorySignatureDeviceRepository) setStatus(device *domain.SignatureDevice, status string) {
+	device.Status = status
+	if status == utils.DeviceStatusDecommissioned && device.PrivateKey != "" {
+		device.PrivateKey = ""
+		repo.logger.Debug("device private key erased", "tenant", device.TenantID, "device_id", device.ID)
+	}
+}
+
+func (repo *InMemorySignatureDeviceRepository) UpdateDeviceDetails(ctx context.Context, tenantID, deviceId, status, label string, metadata map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	device, exists := repo.devices[tenantID][deviceId]
+	if !exists {
+		return utils.ErrDeviceNotFound
+	}
 
-    devices := make([]*domain.SignatureDevice, 0, len(repo.devices))
-    for _, device := range repo.devices {
-        devices = append(devices, device)
-    }
-    return devices, nil
+	repo.setStatus(device, status)
+	device.Label = label
+	device.Metadata = maps.Clone(metadata)
+	device.UpdatedAt = repo.clock.Now()
+	return nil
 }
 
-func (repo *InMemorySignatureDeviceRepository) UpdateDevice(deviceId, newSignature string) error {
-    repo.mu.Lock()
-    defer repo.mu.Unlock()
+func (repo *InMemorySignatureDeviceRepository) RotateDeviceKey(ctx context.Context, tenantID, deviceId string, signatureCounter int, publicKey, privateKey, signature string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
 
-    device, exists := repo.devices[deviceId]
-    if !exists {
-        return utils.ErrDeviceNotFound
-    }
+	device, exists := repo.devices[tenantID][deviceId]
+	if !exists {
+		return utils.ErrDeviceNotFound
+	}
+	if err := repo.checkSigning(device, signatureCounter); err != nil {
+		return err
+	}
 
-    device.SignatureCounter++
-    device.LastSignature = newSignature
-    return nil
+	// Clip so that the history is copied rather than appended in place,
+	// devices handed out earlier keep their view of it.
+	device.KeyHistory = append(slices.Clip(device.KeyHistory), domain.DeviceKey{
+		Version:   device.KeyVersion,
+		PublicKey: device.PublicKey,
+	})
+	device.KeyVersion++
+	repo.logger.Debug("device key replaced", "tenant", tenantID, "device_id", deviceId, "key_version", device.KeyVersion)
+	device.PublicKey = publicKey
+	device.PrivateKey = privateKey
+	now := repo.clock.Now()
+	device.SignatureCounter++
+	device.LastSignature = signature
+	device.UpdatedAt = now
+	device.LastSignedAt = &now
+	return nil
 }
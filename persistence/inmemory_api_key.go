@@ -0,0 +1,50 @@
+package persistence
+
+import (
+	"sync"
+
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// InMemoryAPIKeyRepository stores API keys indexed by the hash of their secret.
+type InMemoryAPIKeyRepository struct {
+	keys map[string]*domain.APIKey
+	ids  map[string]struct{}
+	mu   sync.RWMutex
+}
+
+func NewInMemoryAPIKeyRepository() *InMemoryAPIKeyRepository {
+	return &InMemoryAPIKeyRepository{
+		keys: make(map[string]*domain.APIKey),
+		ids:  make(map[string]struct{}),
+	}
+}
+
+func (repo *InMemoryAPIKeyRepository) CreateAPIKey(key *domain.APIKey) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.ids[key.ID]; exists {
+		return utils.ErrAPIKeyAlreadyExists
+	}
+	if _, exists := repo.keys[key.Hash]; exists {
+		return utils.ErrAPIKeyAlreadyExists
+	}
+	stored := *key
+	repo.keys[key.Hash] = &stored
+	repo.ids[key.ID] = struct{}{}
+	return nil
+}
+
+func (repo *InMemoryAPIKeyRepository) GetAPIKeyByHash(hash string) (*domain.APIKey, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	key, exists := repo.keys[hash]
+	if !exists {
+		return nil, utils.ErrAPIKeyNotFound
+	}
+	found := *key
+	return &found, nil
+}
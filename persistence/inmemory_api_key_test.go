@@ -0,0 +1,50 @@
+package persistence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	requires := require.New(t)
+	repo := NewInMemoryAPIKeyRepository()
+	key := &domain.APIKey{
+		ID:    utils.RandomString(8),
+		Owner: utils.RandomString(8),
+		Hash:  utils.RandomString(64),
+	}
+
+	err := repo.CreateAPIKey(key)
+	requires.NoError(err)
+
+	err = repo.CreateAPIKey(key)
+	requires.Error(err)
+	requires.ErrorIs(err, utils.ErrAPIKeyAlreadyExists)
+
+	err = repo.CreateAPIKey(&domain.APIKey{ID: key.ID, Owner: key.Owner, Hash: utils.RandomString(64)})
+	requires.Error(err)
+	requires.ErrorIs(err, utils.ErrAPIKeyAlreadyExists)
+}
+
+func TestGetAPIKeyByHash(t *testing.T) {
+	requires := require.New(t)
+	repo := NewInMemoryAPIKeyRepository()
+	key := &domain.APIKey{
+		ID:    utils.RandomString(8),
+		Owner: utils.RandomString(8),
+		Hash:  utils.RandomString(64),
+	}
+	requires.NoError(repo.CreateAPIKey(key))
+
+	found, err := repo.GetAPIKeyByHash(key.Hash)
+	requires.NoError(err)
+	requires.Equal(key, found)
+
+	found, err = repo.GetAPIKeyByHash(utils.RandomString(64))
+	requires.Error(err)
+	requires.ErrorIs(err, utils.ErrAPIKeyNotFound)
+	requires.Nil(found)
+}
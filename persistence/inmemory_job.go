@@ -0,0 +1,133 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// JobTTL is how long finished jobs can still be polled before the
+// in-memory repository evicts them.
+const JobTTL = time.Hour
+
+type finishedJob struct {
+	id string
+	at time.Time
+}
+
+// InMemoryJobRepository keeps jobs until JobTTL after they finish. Expired
+// jobs are evicted whenever a job is created or finished, oldest first.
+type InMemoryJobRepository struct {
+	jobs     map[string]*domain.Job
+	finished []finishedJob
+	now      func() time.Time
+	mu       sync.RWMutex
+}
+
+func NewInMemoryJobRepository() *InMemoryJobRepository {
+	return &InMemoryJobRepository{
+		jobs: make(map[string]*domain.Job),
+		now:  time.Now,
+	}
+}
+
+func (repo *InMemoryJobRepository) CreateJob(ctx context.Context, id, tenantID, owner string) (*domain.Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.evictExpired()
+
+	job := &domain.Job{
+		ID:       id,
+		TenantID: tenantID,
+		Status:   utils.JobStatusPending,
+		Owner:    owner,
+	}
+	repo.jobs[id] = job
+	copied := *job
+	return &copied, nil
+}
+
+// GetJob returns a copy of the stored job so that callers can read it
+// while a worker is still updating the original.
+func (repo *InMemoryJobRepository) GetJob(ctx context.Context, id string) (*domain.Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	job, exists := repo.jobs[id]
+	if !exists || repo.expired(job) {
+		return nil, utils.ErrJobNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (repo *InMemoryJobRepository) CompleteJob(ctx context.Context, id string, device *domain.SignatureDevice) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	job, exists := repo.jobs[id]
+	if !exists {
+		return utils.ErrJobNotFound
+	}
+	job.Status = utils.JobStatusSucceeded
+	job.Device = device
+	repo.finish(job)
+	return nil
+}
+
+func (repo *InMemoryJobRepository) FailJob(ctx context.Context, id, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	job, exists := repo.jobs[id]
+	if !exists {
+		return utils.ErrJobNotFound
+	}
+	job.Status = utils.JobStatusFailed
+	job.Error = reason
+	repo.finish(job)
+	return nil
+}
+
+// finish records when job finished and evicts the jobs that have expired
+// since. Callers must hold the write lock.
+func (repo *InMemoryJobRepository) finish(job *domain.Job) {
+	job.FinishedAt = repo.now()
+	repo.finished = append(repo.finished, finishedJob{id: job.ID, at: job.FinishedAt})
+	repo.evictExpired()
+}
+
+// evictExpired drops the jobs that finished more than JobTTL ago. Jobs
+// finish in clock order, so the expired ones are at the front of the queue.
+// Callers must hold the write lock.
+func (repo *InMemoryJobRepository) evictExpired() {
+	cutoff := repo.now().Add(-JobTTL)
+	evicted := 0
+	for _, finished := range repo.finished {
+		if finished.at.After(cutoff) {
+			break
+		}
+		delete(repo.jobs, finished.id)
+		evicted++
+	}
+	repo.finished = repo.finished[evicted:]
+}
+
+func (repo *InMemoryJobRepository) expired(job *domain.Job) bool {
+	return !job.FinishedAt.IsZero() && !job.FinishedAt.After(repo.now().Add(-JobTTL))
+}
@@ -0,0 +1,114 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func TestCreateJob(t *testing.T) {
+	requires := require.New(t)
+	repo := NewInMemoryJobRepository()
+	jobId := utils.RandomString(16)
+
+	job, err := repo.CreateJob(context.Background(), jobId, utils.DefaultTenant, "")
+	requires.NoError(err)
+	requires.NotNil(job)
+	requires.Equal(jobId, job.ID)
+	requires.Equal(utils.DefaultTenant, job.TenantID)
+	requires.Equal(utils.JobStatusPending, job.Status)
+	requires.Nil(job.Device)
+	requires.Empty(job.Error)
+}
+
+func TestGetJob(t *testing.T) {
+	requires := require.New(t)
+	repo := NewInMemoryJobRepository()
+	jobId := utils.RandomString(16)
+	_, err := repo.CreateJob(context.Background(), jobId, utils.DefaultTenant, "")
+	requires.NoError(err)
+
+	job, err := repo.GetJob(context.Background(), jobId)
+	requires.NoError(err)
+	requires.NotNil(job)
+	requires.Equal(jobId, job.ID)
+
+	job, err = repo.GetJob(context.Background(), utils.RandomString(16))
+	requires.Error(err)
+	requires.ErrorIs(err, utils.ErrJobNotFound)
+	requires.Nil(job)
+}
+
+func TestCompleteJob(t *testing.T) {
+	requires := require.New(t)
+	repo := NewInMemoryJobRepository()
+	jobId := utils.RandomString(16)
+	_, err := repo.CreateJob(context.Background(), jobId, utils.DefaultTenant, "")
+	requires.NoError(err)
+	device := &domain.SignatureDevice{ID: utils.RandomString(16), Algorithm: utils.Algorithms[0]}
+
+	err = repo.CompleteJob(context.Background(), jobId, device)
+	requires.NoError(err)
+	job, err := repo.GetJob(context.Background(), jobId)
+	requires.NoError(err)
+	requires.Equal(utils.JobStatusSucceeded, job.Status)
+	requires.Equal(device, job.Device)
+
+	err = repo.CompleteJob(context.Background(), utils.RandomString(16), device)
+	requires.Error(err)
+	requires.ErrorIs(err, utils.ErrJobNotFound)
+}
+
+func TestFailJob(t *testing.T) {
+	requires := require.New(t)
+	repo := NewInMemoryJobRepository()
+	jobId := utils.RandomString(16)
+	_, err := repo.CreateJob(context.Background(), jobId, utils.DefaultTenant, "")
+	requires.NoError(err)
+
+	err = repo.FailJob(context.Background(), jobId, utils.ErrUnsupportedAlgorithm.Error())
+	requires.NoError(err)
+	job, err := repo.GetJob(context.Background(), jobId)
+	requires.NoError(err)
+	requires.Equal(utils.JobStatusFailed, job.Status)
+	requires.Equal(utils.ErrUnsupportedAlgorithm.Error(), job.Error)
+	requires.Nil(job.Device)
+
+	err = repo.FailJob(context.Background(), utils.RandomString(16), "")
+	requires.Error(err)
+	requires.ErrorIs(err, utils.ErrJobNotFound)
+}
+
+func TestJobExpiry(t *testing.T) {
+	requires := require.New(t)
+	repo := NewInMemoryJobRepository()
+	now := time.Now()
+	repo.now = func() time.Time { return now }
+	finishedId := utils.RandomString(16)
+	pendingId := utils.RandomString(16)
+	_, err := repo.CreateJob(context.Background(), finishedId, utils.DefaultTenant, "")
+	requires.NoError(err)
+	_, err = repo.CreateJob(context.Background(), pendingId, utils.DefaultTenant, "")
+	requires.NoError(err)
+	requires.NoError(repo.FailJob(context.Background(), finishedId, utils.ErrUnsupportedAlgorithm.Error()))
+
+	now = now.Add(JobTTL - time.Second)
+	_, err = repo.GetJob(context.Background(), finishedId)
+	requires.NoError(err)
+
+	now = now.Add(time.Second)
+	_, err = repo.GetJob(context.Background(), finishedId)
+	requires.ErrorIs(err, utils.ErrJobNotFound)
+	_, err = repo.CreateJob(context.Background(), utils.RandomString(16), utils.DefaultTenant, "")
+	requires.NoError(err)
+	requires.NotContains(repo.jobs, finishedId)
+	requires.Empty(repo.finished)
+
+	job, err := repo.GetJob(context.Background(), pendingId)
+	requires.NoError(err)
+	requires.Equal(utils.JobStatusPending, job.Status)
+}
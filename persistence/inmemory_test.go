@@ -1,7 +1,11 @@
 package persistence
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
+	"errors"
+	"log/slog"
 	"sync"
 	"testing"
 
@@ -12,14 +16,21 @@ import (
 
 func createDevice(t *testing.T) (*domain.SignatureDevice, *InMemorySignatureDeviceRepository) {
 	requires := require.New(t)
-	repo := NewInMemorySignatureDeviceRepository()
+	repo := NewInMemorySignatureDeviceRepository(nil)
 	deviceId := utils.RandomString(16)
 	label := utils.RandomString(6)
 	publicKey := utils.RandomString(16)
 	privateKey := utils.RandomString(16)
 	algorithm := utils.Algorithms[0]
 
-	device, err := repo.CreateDevice(deviceId, algorithm, publicKey, privateKey, label)
+	device, err := repo.CreateDevice(context.Background(), &domain.SignatureDevice{
+		ID:         deviceId,
+		TenantID:   utils.DefaultTenant,
+		Algorithm:  algorithm,
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+		Label:      label,
+	})
 	requires.NoError(err)
 	requires.NotNil(device)
 	return device, repo
@@ -28,21 +39,32 @@ func createDevice(t *testing.T) (*domain.SignatureDevice, *InMemorySignatureDevi
 func TestCreateDevice(t *testing.T) {
 	requires := require.New(t)
 	device, repo := createDevice(t)
-	newDevice, err := repo.CreateDevice(device.ID, device.Algorithm, device.PublicKey, device.PrivateKey, device.Label)
+	newDevice, err := repo.CreateDevice(context.Background(), device)
 	requires.Error(err)
 	requires.ErrorIs(err, utils.ErrDeviceAlreadyExists)
 	requires.Nil(newDevice)
 }
 
+func TestRepositoryLogger(t *testing.T) {
+	requires := require.New(t)
+	var logs bytes.Buffer
+	repo := NewInMemorySignatureDeviceRepository(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	_, err := repo.CreateDevice(context.Background(), &domain.SignatureDevice{ID: "till-1", TenantID: utils.DefaultTenant, Algorithm: utils.Algorithms[0]})
+	requires.NoError(err)
+	requires.Contains(logs.String(), `"msg":"device stored"`)
+	requires.Contains(logs.String(), `"device_id":"till-1"`)
+}
+
 func TestGetDevice(t *testing.T) {
 	requires := require.New(t)
 	device, repo := createDevice(t)
 
-	d1, err := repo.GetDevice(device.ID)
+	d1, err := repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
 	requires.NoError(err)
 	requires.NotNil(d1)
 
-	d2, err := repo.GetDevice(utils.RandomString(6))
+	d2, err := repo.GetDevice(context.Background(), utils.DefaultTenant, utils.RandomString(6))
 	requires.Error(err)
 	requires.Nil(d2)
 }
@@ -51,11 +73,30 @@ func TestListDevices(t *testing.T) {
 	requires := require.New(t)
 	_, repo := createDevice(t)
 
-	devices, err := repo.ListDevices()
+	devices, err := repo.ListDevices(context.Background(), utils.DefaultTenant)
 	requires.NoError(err)
 	requires.Len(devices, 1)
 }
 
+func TestCountDevices(t *testing.T) {
+	requires := require.New(t)
+	_, repo := createDevice(t)
+
+	count, err := repo.CountDevices(context.Background(), utils.DefaultTenant)
+	requires.NoError(err)
+	requires.Equal(1, count)
+
+	count, err = repo.CountDevices(context.Background(), utils.RandomString(8))
+	requires.NoError(err)
+	requires.Zero(count)
+}
+
+func TestInMemorySignatureDeviceRepositoryConformance(t *testing.T) {
+	testSignatureDeviceRepositoryConformance(t, func(clock utils.Clock) SignatureDeviceRepository {
+		return NewInMemorySignatureDeviceRepositoryWithClock(clock, nil)
+	})
+}
+
 func TestUpdateDevice(t *testing.T) {
 	requires := require.New(t)
 	device, repo := createDevice(t)
@@ -64,15 +105,15 @@ func TestUpdateDevice(t *testing.T) {
 	requires.Equal(0, device.SignatureCounter)
 	requires.Equal(base64.StdEncoding.EncodeToString([]byte(device.ID)), device.LastSignature)
 
-	err := repo.UpdateDevice(device.ID, newSignature)
+	err := repo.UpdateDevice(context.Background(), utils.DefaultTenant, device.ID, 0, newSignature)
 	requires.NoError(err)
-	device, err = repo.GetDevice(device.ID)
+	device, err = repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
 	requires.NoError(err)
 	requires.NotNil(device)
 	requires.Equal(1, device.SignatureCounter)
 	requires.Equal(newSignature, device.LastSignature)
 
-	err = repo.UpdateDevice(utils.RandomString(16), newSignature)
+	err = repo.UpdateDevice(context.Background(), utils.DefaultTenant, utils.RandomString(16), 0, newSignature)
 	requires.Error(err)
 	requires.ErrorIs(err, utils.ErrDeviceNotFound)
 }
@@ -81,7 +122,7 @@ func TestLoadUpdateDevice(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping TestLoadUpdateDevice in short mode.")
 	}
-	repo := NewInMemorySignatureDeviceRepository()
+	repo := NewInMemorySignatureDeviceRepository(nil)
 	var wg sync.WaitGroup
 	// You can vary the number of devices and the number of signings
 	numberOfDevices := 10
@@ -97,7 +138,14 @@ func TestLoadUpdateDevice(t *testing.T) {
 			privateKey := utils.RandomString(16)
 			algorithm := utils.Algorithms[0]
 
-			device, err := repo.CreateDevice(deviceId, algorithm, publicKey, privateKey, label)
+			device, err := repo.CreateDevice(context.Background(), &domain.SignatureDevice{
+				ID:         deviceId,
+				TenantID:   utils.DefaultTenant,
+				Algorithm:  algorithm,
+				PublicKey:  publicKey,
+				PrivateKey: privateKey,
+				Label:      label,
+			})
 			requires.NoError(err)
 			requires.NotNil(device)
 			for range m {
@@ -105,15 +153,23 @@ func TestLoadUpdateDevice(t *testing.T) {
 				go func() {
 					defer wg.Done()
 					requires := require.New(t)
-					err := repo.UpdateDevice(device.ID, utils.RandomString(10))
-					requires.NoError(err)
+					// Concurrent signers retry with the counter they lost to.
+					for {
+						current, err := repo.GetDevice(context.Background(), utils.DefaultTenant, device.ID)
+						requires.NoError(err)
+						err = repo.UpdateDevice(context.Background(), utils.DefaultTenant, device.ID, current.SignatureCounter, utils.RandomString(10))
+						if !errors.Is(err, utils.ErrSignatureConflict) {
+							requires.NoError(err)
+							return
+						}
+					}
 				}()
 			}
 		}(numberOfSignings)
 	}
 	wg.Wait()
 	requires := require.New(t)
-	devices, err := repo.ListDevices()
+	devices, err := repo.ListDevices(context.Background(), utils.DefaultTenant)
 	requires.NoError(err)
 	requires.NotNil(devices)
 	requires.Len(devices, numberOfDevices)
@@ -0,0 +1,78 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/metrics"
+)
+
+// instrumentedSignatureDeviceRepository records the duration of every
+// operation of the repository it wraps.
+type instrumentedSignatureDeviceRepository struct {
+	next    SignatureDeviceRepository
+	metrics *metrics.Metrics
+}
+
+// NewInstrumentedSignatureDeviceRepository wraps next so that the duration of
+// its operations is recorded in the repository operation histogram.
+func NewInstrumentedSignatureDeviceRepository(next SignatureDeviceRepository, m *metrics.Metrics) SignatureDeviceRepository {
+	return &instrumentedSignatureDeviceRepository{next: next, metrics: m}
+}
+
+func (r *instrumentedSignatureDeviceRepository) CreateDevice(ctx context.Context, device *domain.SignatureDevice) (*domain.SignatureDevice, error) {
+	defer r.metrics.ObserveRepositoryOperation("CreateDevice", time.Now())
+	return r.next.CreateDevice(ctx, device)
+}
+
+func (r *instrumentedSignatureDeviceRepository) GetDevice(ctx context.Context, tenantID, id string) (*domain.SignatureDevice, error) {
+	defer r.metrics.ObserveRepositoryOperation("GetDevice", time.Now())
+	return r.next.GetDevice(ctx, tenantID, id)
+}
+
+func (r *instrumentedSignatureDeviceRepository) ListDevices(ctx context.Context, tenantID string) ([]*domain.SignatureDevice, error) {
+	defer r.metrics.ObserveRepositoryOperation("ListDevices", time.Now())
+	return r.next.ListDevices(ctx, tenantID)
+}
+
+func (r *instrumentedSignatureDeviceRepository) QueryDevices(ctx context.Context, tenantID string, query domain.DeviceQuery) (*domain.DevicePage, error) {
+	defer r.metrics.ObserveRepositoryOperation("QueryDevices", time.Now())
+	return r.next.QueryDevices(ctx, tenantID, query)
+}
+
+func (r *instrumentedSignatureDeviceRepository) CountDevices(ctx context.Context, tenantID string) (int, error) {
+	defer r.metrics.ObserveRepositoryOperation("CountDevices", time.Now())
+	return r.next.CountDevices(ctx, tenantID)
+}
+
+func (r *instrumentedSignatureDeviceRepository) UpdateDevice(ctx context.Context, tenantID, deviceID string, signatureCounter int, newSignature string) error {
+	defer r.metrics.ObserveRepositoryOperation("UpdateDevice", time.Now())
+	return r.next.UpdateDevice(ctx, tenantID, deviceID, signatureCounter, newSignature)
+}
+
+func (r *instrumentedSignatureDeviceRepository) UpdateDeviceStatus(ctx context.Context, tenantID, deviceID, status string) error {
+	defer r.metrics.ObserveRepositoryOperation("UpdateDeviceStatus", time.Now())
+	return r.next.UpdateDeviceStatus(ctx, tenantID, deviceID, status)
+}
+
+func (r *instrumentedSignatureDeviceRepository) UpdateDeviceDetails(ctx context.Context, tenantID, deviceID, status, label string, metadata map[string]string) error {
+	defer r.metrics.ObserveRepositoryOperation("UpdateDeviceDetails", time.Now())
+	return r.next.UpdateDeviceDetails(ctx, tenantID, deviceID, status, label, metadata)
+}
+
+func (r *instrumentedSignatureDeviceRepository) RotateDeviceKey(ctx context.Context, tenantID, deviceID string, signatureCounter int, publicKey, privateKey, signature string) error {
+	defer r.metrics.ObserveRepositoryOperation("RotateDeviceKey", time.Now())
+	return r.next.RotateDeviceKey(ctx, tenantID, deviceID, signatureCounter, publicKey, privateKey, signature)
+}
+
+func (r *instrumentedSignatureDeviceRepository) RestoreDevices(ctx context.Context, devices []*domain.SignatureDevice) error {
+	defer r.metrics.ObserveRepositoryOperation("RestoreDevices", time.Now())
+	return r.next.RestoreDevices(ctx, devices)
+}
+
+// Flush flushes the repository it wraps if that buffers writes.
+func (r *instrumentedSignatureDeviceRepository) Flush(ctx context.Context) error {
+	defer r.metrics.ObserveRepositoryOperation("Flush", time.Now())
+	return Flush(ctx, r.next)
+}
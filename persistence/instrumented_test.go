@@ -0,0 +1,70 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/metrics"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func TestInstrumentedSignatureDeviceRepositoryConformance(t *testing.T) {
+	testSignatureDeviceRepositoryConformance(t, func(clock utils.Clock) SignatureDeviceRepository {
+		return NewInstrumentedSignatureDeviceRepository(NewInMemorySignatureDeviceRepositoryWithClock(clock, nil), metrics.New(prometheus.NewRegistry()))
+	})
+}
+
+func TestInstrumentedSignatureDeviceRepository(t *testing.T) {
+	requires := require.New(t)
+	m := metrics.New(prometheus.NewRegistry())
+	repo := NewInstrumentedSignatureDeviceRepository(NewInMemorySignatureDeviceRepository(nil), m)
+
+	requires.Zero(testutil.CollectAndCount(m.RepositoryOperation))
+
+	device, err := repo.CreateDevice(context.Background(), &domain.SignatureDevice{
+		ID:         utils.RandomString(16),
+		TenantID:   utils.DefaultTenant,
+		Algorithm:  utils.Algorithms[0],
+		PublicKey:  utils.RandomString(16),
+		PrivateKey: utils.RandomString(16),
+	})
+	requires.NoError(err)
+	requires.Equal(1, testutil.CollectAndCount(m.RepositoryOperation))
+
+	// Failed operations are timed too.
+	_, err = repo.GetDevice(context.Background(), device.TenantID, utils.RandomString(16))
+	requires.ErrorIs(err, utils.ErrDeviceNotFound)
+	requires.Equal(2, testutil.CollectAndCount(m.RepositoryOperation))
+}
+
+// flushingRepository counts the flushes of the repository it embeds.
+type flushingRepository struct {
+	SignatureDeviceRepository
+	flushes int
+}
+
+func (r *flushingRepository) Flush(ctx context.Context) error {
+	r.flushes++
+	return ctx.Err()
+}
+
+func TestInstrumentedSignatureDeviceRepositoryFlush(t *testing.T) {
+	requires := require.New(t)
+	m := metrics.New(prometheus.NewRegistry())
+
+	// Repositories that buffer nothing have nothing to flush.
+	requires.NoError(Flush(context.Background(), NewInstrumentedSignatureDeviceRepository(NewInMemorySignatureDeviceRepository(nil), m)))
+
+	next := &flushingRepository{SignatureDeviceRepository: NewInMemorySignatureDeviceRepository(nil)}
+	repo := NewInstrumentedSignatureDeviceRepository(next, m)
+	requires.NoError(Flush(context.Background(), repo))
+	requires.Equal(1, next.flushes)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	requires.ErrorIs(Flush(ctx, repo), context.Canceled)
+	requires.Equal(2, next.flushes)
+}
@@ -0,0 +1,16 @@
+package persistence
+
+import (
+	"context"
+
+	"github.com/uwemakan/signing-service/domain"
+)
+
+// JobRepository tracks asynchronous device creation jobs. Operations fail
+// with the error of ctx once it is cancelled or past its deadline.
+type JobRepository interface {
+	CreateJob(ctx context.Context, id, tenantID, owner string) (*domain.Job, error)
+	GetJob(ctx context.Context, id string) (*domain.Job, error)
+	CompleteJob(ctx context.Context, id string, device *domain.SignatureDevice) error
+	FailJob(ctx context.Context, id, reason string) error
+}
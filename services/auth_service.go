@@ -0,0 +1,58 @@
+package services
+
+import (
+	"sync/atomic"
+
+	"github.com/uwemakan/signing-service/crypto"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/persistence"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+type AuthService interface {
+	// Enabled reports whether at least one API key has been registered.
+	Enabled() bool
+	RegisterAPIKey(id, owner, tenant, secret string) error
+	Authenticate(secret string) (*domain.Principal, error)
+}
+
+type authService struct {
+	repo    persistence.APIKeyRepository
+	enabled atomic.Bool
+}
+
+func NewAuthService(repo persistence.APIKeyRepository) AuthService {
+	return &authService{repo: repo}
+}
+
+func (s *authService) Enabled() bool {
+	return s.enabled.Load()
+}
+
+// RegisterAPIKey hashes the secret and stores it as a key of the given owner.
+// Keys with a tenant can only be used within that tenant.
+func (s *authService) RegisterAPIKey(id, owner, tenant, secret string) error {
+	err := s.repo.CreateAPIKey(&domain.APIKey{
+		ID:     id,
+		Owner:  owner,
+		Tenant: tenant,
+		Hash:   crypto.HashAPIKey(secret),
+	})
+	if err != nil {
+		return err
+	}
+	s.enabled.Store(true)
+	return nil
+}
+
+// Authenticate resolves the principal of an API key secret.
+func (s *authService) Authenticate(secret string) (*domain.Principal, error) {
+	if secret == "" {
+		return nil, utils.ErrUnauthenticated
+	}
+	key, err := s.repo.GetAPIKeyByHash(crypto.HashAPIKey(secret))
+	if err != nil {
+		return nil, utils.ErrUnauthenticated
+	}
+	return &domain.Principal{ID: key.ID, Credential: utils.CredentialAPIKey, Owner: domain.Qualify(utils.CredentialAPIKey, key.Owner), Tenant: key.Tenant, Scopes: utils.Scopes}, nil
+}
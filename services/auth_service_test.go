@@ -0,0 +1,45 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/persistence"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func TestAuthenticate(t *testing.T) {
+	requires := require.New(t)
+	service := NewAuthService(persistence.NewInMemoryAPIKeyRepository())
+	requires.False(service.Enabled())
+
+	id := utils.RandomString(8)
+	owner := utils.RandomString(8)
+	tenant := utils.RandomString(8)
+	secret := utils.RandomString(32)
+	err := service.RegisterAPIKey(id, owner, tenant, secret)
+	requires.NoError(err)
+	requires.True(service.Enabled())
+
+	principal, err := service.Authenticate(secret)
+	requires.NoError(err)
+	requires.NotNil(principal)
+	requires.Equal(id, principal.ID)
+	requires.Equal(utils.CredentialAPIKey+":"+owner, principal.Owner)
+	requires.Equal(tenant, principal.Tenant)
+	requires.Equal(utils.Scopes, principal.Scopes)
+
+	principal, err = service.Authenticate(utils.RandomString(32))
+	requires.Error(err)
+	requires.ErrorIs(err, utils.ErrUnauthenticated)
+	requires.Nil(principal)
+
+	principal, err = service.Authenticate("")
+	requires.Error(err)
+	requires.ErrorIs(err, utils.ErrUnauthenticated)
+	requires.Nil(principal)
+
+	err = service.RegisterAPIKey(id, owner, tenant, utils.RandomString(32))
+	requires.Error(err)
+	requires.ErrorIs(err, utils.ErrAPIKeyAlreadyExists)
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/uwemakan/signing-service/crypto"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// newBackupArchive returns an empty archive for the secret with a fresh salt
+// together with its wrapping key.
+func newBackupArchive(secret domain.BackupSecret) (*domain.BackupArchive, []byte, error) {
+	salt := make([]byte, utils.BackupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, err
+	}
+	archive := &domain.BackupArchive{
+		Version: utils.BackupArchiveVersion,
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+	}
+	if secret.Passphrase != "" {
+		archive.KDF = crypto.KDFPBKDF2
+		archive.Iterations = utils.BackupKDFIterations
+	} else {
+		archive.KDF = crypto.KDFHKDF
+	}
+	wrappingKey, err := wrappingKeyOf(archive, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	return archive, wrappingKey, nil
+}
+
+// wrappingKeyOf derives the wrapping key of the archive from the secret.
+func wrappingKeyOf(archive *domain.BackupArchive, secret domain.BackupSecret) ([]byte, error) {
+	if (secret.Passphrase == "") == (secret.Key == "") {
+		return nil, utils.ErrInvalidBackupSecret
+	}
+	salt, err := base64.StdEncoding.DecodeString(archive.Salt)
+	if err != nil || archive.Version != utils.BackupArchiveVersion {
+		return nil, utils.ErrInvalidBackupArchive
+	}
+	switch archive.KDF {
+	case crypto.KDFPBKDF2:
+		if len(secret.Passphrase) < utils.MinBackupPassphraseLength {
+			return nil, utils.ErrInvalidBackupSecret
+		}
+		if archive.Iterations <= 0 || archive.Iterations > utils.MaxBackupKDFIterations {
+			return nil, utils.ErrInvalidBackupArchive
+		}
+		return crypto.DerivePassphraseKey(secret.Passphrase, salt, archive.Iterations), nil
+	case crypto.KDFHKDF:
+		key, err := base64.StdEncoding.DecodeString(secret.Key)
+		if err != nil || len(key) != crypto.WrappingKeySize {
+			return nil, utils.ErrInvalidBackupSecret
+		}
+		return crypto.DeriveKey(key, salt)
+	default:
+		return nil, utils.ErrInvalidBackupArchive
+	}
+}
+
+// ExportSignatureDevices exports the devices of the tenant visible to the
+// principal into an archive encrypted with the secret. Private keys are
+// re-wrapped from the key encryption key to the wrapping key of the archive.
+func (s *signatureService) ExportSignatureDevices(ctx context.Context, principal *domain.Principal, tenantID string, secret domain.BackupSecret) (*domain.BackupArchive, error) {
+	if err := authorizeTenant(principal, tenantID); err != nil {
+		return nil, err
+	}
+	devices, err := s.repo.ListDevices(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	devices = slices.DeleteFunc(devices, func(device *domain.SignatureDevice) bool {
+		return !owns(principal, device.Owner)
+	})
+	archive, wrappingKey, err := newBackupArchive(secret)
+	if err != nil {
+		return nil, err
+	}
+	payload := domain.BackupPayload{Devices: make([]domain.DeviceBackup, 0, len(devices))}
+	for _, device := range devices {
+		backup := domain.DeviceBackup{
+			ID:               device.ID,
+			Algorithm:        device.Algorithm,
+			Label:            device.Label,
+			Owner:            device.Owner,
+			Terminal:         device.Terminal,
+			Status:           device.Status,
+			SignatureCounter: device.SignatureCounter,
+			LastSignature:    device.LastSignature,
+			KeyVersion:       device.KeyVersion,
+			KeyHistory:       device.KeyHistory,
+			Metadata:         device.Metadata,
+			CreatedAt:        device.CreatedAt,
+			UpdatedAt:        device.UpdatedAt,
+			LastSignedAt:     device.LastSignedAt,
+			MaxSignatures:    device.MaxSignatures,
+			NotAfter:         device.NotAfter,
+			PublicKey:        device.PublicKey,
+		}
+		if device.PrivateKey != "" {
+			privateKey, err := crypto.DecryptAES(device.PrivateKey, s.kek)
+			if err != nil {
+				return nil, err
+			}
+			backup.WrappedPrivateKey, err = crypto.EncryptGCM([]byte(privateKey), wrappingKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+		payload.Devices = append(payload.Devices, backup)
+	}
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	archive.Ciphertext, err = crypto.EncryptGCM(plaintext, wrappingKey)
+	if err != nil {
+		return nil, err
+	}
+	// Exports carry every private key of the tenant, each is logged for audit.
+	ids := make([]string, 0, len(payload.Devices))
+	for _, backup := range payload.Devices {
+		ids = append(ids, backup.ID)
+	}
+	s.logger.Info("devices exported", "principal", principalIDOf(principal), "owner", ownerOf(principal), "tenant", tenantID,
+		"devices", len(payload.Devices), "device_ids", ids, "kdf", archive.KDF)
+	return archive, nil
+}
+
+// ImportSignatureDevices restores the devices of an archive into the tenant.
+// A device that already exists is replaced, unless the backup would roll it
+// back to a lower signature counter or key version or a less restrictive
+// status. Nothing is restored if the archive can't be decrypted, holds
+// devices of another owner, inconsistent devices or devices it would roll
+// back.
+func (s *signatureService) ImportSignatureDevices(ctx context.Context, principal *domain.Principal, tenantID string, archive *domain.BackupArchive, secret domain.BackupSecret) (int, error) {
+	if err := authorizeTenant(principal, tenantID); err != nil {
+		return 0, err
+	}
+	wrappingKey, err := wrappingKeyOf(archive, secret)
+	if err != nil {
+		return 0, err
+	}
+	plaintext, err := crypto.DecryptGCM(archive.Ciphertext, wrappingKey)
+	if err != nil {
+		return 0, utils.ErrInvalidBackupArchive
+	}
+	var payload domain.BackupPayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return 0, utils.ErrInvalidBackupArchive
+	}
+
+	s.createMu.Lock()
+	defer s.createMu.Unlock()
+	devices := make([]*domain.SignatureDevice, 0, len(payload.Devices))
+	seen := make(map[string]bool, len(payload.Devices))
+	added := 0
+	for _, backup := range payload.Devices {
+		if seen[backup.ID] {
+			return 0, utils.ErrInvalidBackupArchive
+		}
+		seen[backup.ID] = true
+		if !owns(principal, backup.Owner) {
+			return 0, utils.ErrPermissionDenied
+		}
+		var privateKey []byte
+		if backup.WrappedPrivateKey != "" {
+			privateKey, err = crypto.DecryptGCM(backup.WrappedPrivateKey, wrappingKey)
+			if err != nil {
+				return 0, utils.ErrInvalidBackupArchive
+			}
+		}
+		if err := s.checkBackup(ctx, &backup, privateKey); err != nil {
+			return 0, err
+		}
+		device := &domain.SignatureDevice{
+			ID:               backup.ID,
+			TenantID:         tenantID,
+			Algorithm:        backup.Algorithm,
+			Label:            backup.Label,
+			Owner:            backup.Owner,
+			Terminal:         backup.Terminal,
+			Status:           backup.Status,
+			SignatureCounter: backup.SignatureCounter,
+			LastSignature:    backup.LastSignature,
+			KeyVersion:       backup.KeyVersion,
+			KeyHistory:       backup.KeyHistory,
+			Metadata:         backup.Metadata,
+			CreatedAt:        backup.CreatedAt,
+			UpdatedAt:        backup.UpdatedAt,
+			LastSignedAt:     backup.LastSignedAt,
+			MaxSignatures:    backup.MaxSignatures,
+			NotAfter:         backup.NotAfter,
+			PublicKey:        backup.PublicKey,
+		}
+		// The repository checks again on restore, the device may sign in the
+		// meantime.
+		existing, err := s.repo.GetDevice(ctx, tenantID, backup.ID)
+		switch {
+		case errors.Is(err, utils.ErrDeviceNotFound):
+			added++
+		case err != nil:
+			return 0, err
+		case !owns(principal, existing.Owner):
+			return 0, utils.ErrPermissionDenied
+		case device.RollsBack(existing):
+			return 0, utils.ErrBackupRollback
+		}
+		if privateKey != nil {
+			device.PrivateKey, err = crypto.EncryptAES(privateKey, s.kek)
+			if err != nil {
+				return 0, err
+			}
+		}
+		devices = append(devices, device)
+	}
+	if limit := s.deviceLimitOf(tenantID); limit > 0 {
+		count, err := s.repo.CountDevices(ctx, tenantID)
+		if err != nil {
+			return 0, err
+		}
+		if count+added > limit {
+			return 0, utils.ErrTenantDeviceLimit
+		}
+	}
+	if err := s.repo.RestoreDevices(ctx, devices); err != nil {
+		return 0, err
+	}
+	s.logger.Info("devices restored", "principal", principalIDOf(principal), "tenant", tenantID, "devices", len(devices), "replaced", len(devices)-added)
+	return len(devices), nil
+}
+
+// checkBackup checks that a device of an archive is consistent before it is
+// restored. Its algorithm, status and counters must be valid and its key
+// history must hold the public keys of the algorithm for every earlier key
+// version. The private key, required unless the device is decommissioned,
+// must be a key of the algorithm whose public key is the one of the device.
+func (s *signatureService) checkBackup(ctx context.Context, backup *domain.DeviceBackup, privateKey []byte) error {
+	switch {
+	case !slices.Contains(utils.Algorithms, backup.Algorithm),
+		!slices.Contains(utils.DeviceStatuses, backup.Status),
+		backup.SignatureCounter < 0,
+		backup.SignatureCounter == 0 && backup.LastSignature != base64.StdEncoding.EncodeToString([]byte(backup.ID)),
+		backup.MaxSignatures != nil && *backup.MaxSignatures < 1,
+		backup.KeyVersion != len(backup.KeyHistory)+1:
+		return utils.ErrInvalidBackupArchive
+	}
+	for i, key := range backup.KeyHistory {
+		if key.Version != i+1 {
+			return utils.ErrInvalidBackupArchive
+		}
+		if _, err := crypto.ParsePublicKey(backup.Algorithm, []byte(key.PublicKey)); err != nil {
+			return utils.ErrInvalidBackupArchive
+		}
+	}
+	if privateKey == nil {
+		if backup.Status != utils.DeviceStatusDecommissioned {
+			return utils.ErrInvalidBackupArchive
+		}
+		if _, err := crypto.ParsePublicKey(backup.Algorithm, []byte(backup.PublicKey)); err != nil {
+			return utils.ErrInvalidBackupArchive
+		}
+		return nil
+	}
+	publicKey, _, err := s.importKeyPair(ctx, backup.Algorithm, privateKey)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err != nil || string(publicKey) != backup.PublicKey {
+		return utils.ErrInvalidBackupArchive
+	}
+	return nil
+}
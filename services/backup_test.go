@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/crypto"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/persistence"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// backends lists the SignatureDeviceRepository implementations backups are
+// round-tripped between.
+var backends = map[string]func() persistence.SignatureDeviceRepository{
+	"InMemory": func() persistence.SignatureDeviceRepository {
+		return persistence.NewInMemorySignatureDeviceRepository(nil)
+	},
+}
+
+func newBackupTestService(repo persistence.SignatureDeviceRepository, kek string) SignatureService {
+	return NewSignatureService(SignatureServiceParams{
+		Repo:           repo,
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+		KEK:            []byte(kek),
+	})
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte(utils.RandomString(crypto.WrappingKeySize)))
+	secrets := map[string]domain.BackupSecret{
+		"Passphrase": {Passphrase: "correct horse battery staple"},
+		"Key":        {Key: key},
+	}
+
+	for sourceName, newSource := range backends {
+		for targetName, newTarget := range backends {
+			for secretName, secret := range secrets {
+				t.Run(fmt.Sprintf("%s_To_%s_%s", sourceName, targetName, secretName), func(t *testing.T) {
+					requires := require.New(t)
+					source := newBackupTestService(newSource(), "1234567890123456")
+					target := newBackupTestService(newTarget(), "6543210987654321")
+
+					// One device that has signed, one with a rotated key and a
+					// decommissioned one.
+					signed, rotated, decommissioned := utils.RandomString(16), utils.RandomString(16), utils.RandomString(16)
+					for _, id := range []string{signed, rotated, decommissioned} {
+						_, err := source.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+							ID:        id,
+							Algorithm: utils.Algorithms[1],
+						})
+						requires.NoError(err)
+					}
+					_, err := source.SignTransaction(context.Background(), nil, utils.DefaultTenant, signed, fmt.Sprintf("0_TestData_%s", base64.StdEncoding.EncodeToString([]byte(signed))))
+					requires.NoError(err)
+					_, err = source.RotateDeviceKey(context.Background(), nil, utils.DefaultTenant, rotated)
+					requires.NoError(err)
+					_, err = source.UpdateSignatureDevice(context.Background(), nil, utils.DefaultTenant, decommissioned, statusUpdate(utils.DeviceStatusDecommissioned))
+					requires.NoError(err)
+
+					archive, err := source.ExportSignatureDevices(context.Background(), nil, utils.DefaultTenant, secret)
+					requires.NoError(err)
+					restored, err := target.ImportSignatureDevices(context.Background(), nil, "restored", archive, secret)
+					requires.NoError(err)
+					requires.Equal(3, restored)
+
+					for _, id := range []string{signed, rotated, decommissioned} {
+						original, err := source.GetSignatureDevice(context.Background(), nil, utils.DefaultTenant, id)
+						requires.NoError(err)
+						device, err := target.GetSignatureDevice(context.Background(), nil, "restored", id)
+						requires.NoError(err)
+						requires.Equal("restored", device.TenantID)
+						requires.Equal(original.Status, device.Status)
+						requires.Equal(original.SignatureCounter, device.SignatureCounter)
+						requires.Equal(original.LastSignature, device.LastSignature)
+						requires.Equal(original.KeyVersion, device.KeyVersion)
+						requires.Equal(original.KeyHistory, device.KeyHistory)
+						requires.Equal(original.PublicKey, device.PublicKey)
+						requires.Equal(original.CreatedAt, device.CreatedAt)
+						requires.Equal(original.UpdatedAt, device.UpdatedAt)
+						requires.Equal(original.LastSignedAt, device.LastSignedAt)
+						if id == decommissioned {
+							requires.Empty(device.PrivateKey)
+							continue
+						}
+
+						// The chain continues with the restored private key,
+						// now encrypted with the target's key encryption key.
+						data := fmt.Sprintf("%d_TestData_%s", device.SignatureCounter, device.LastSignature)
+						sr, err := target.SignTransaction(context.Background(), nil, "restored", id, data)
+						requires.NoError(err)
+						requires.NotNil(sr)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestImportSignatureDevices(t *testing.T) {
+	requires := require.New(t)
+	secret := domain.BackupSecret{Passphrase: "correct horse battery staple"}
+	owner := &domain.Principal{ID: utils.RandomString(8), Owner: utils.RandomString(8)}
+
+	source := newBackupTestService(persistence.NewInMemorySignatureDeviceRepository(nil), "1234567890123456")
+	deviceId := utils.RandomString(16)
+	_, err := source.CreateSignatureDevice(context.Background(), owner, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.NoError(err)
+	archive, err := source.ExportSignatureDevices(context.Background(), owner, utils.DefaultTenant, secret)
+	requires.NoError(err)
+
+	testCases := []struct {
+		name      string
+		principal *domain.Principal
+		archive   func() *domain.BackupArchive
+		secret    domain.BackupSecret
+		err       error
+	}{
+		{name: "Import_Wrong_Passphrase", principal: owner, secret: domain.BackupSecret{Passphrase: "incorrect horse battery"}, err: utils.ErrInvalidBackupArchive},
+		{name: "Import_Short_Passphrase", principal: owner, secret: domain.BackupSecret{Passphrase: "short"}, err: utils.ErrInvalidBackupSecret},
+		{name: "Import_Both_Secrets", principal: owner, secret: domain.BackupSecret{Passphrase: secret.Passphrase, Key: "key"}, err: utils.ErrInvalidBackupSecret},
+		{name: "Import_Key_For_Passphrase_Archive", principal: owner, secret: domain.BackupSecret{Key: base64.StdEncoding.EncodeToString(make([]byte, crypto.WrappingKeySize))}, err: utils.ErrInvalidBackupSecret},
+		{
+			name:      "Import_Tampered_Archive",
+			principal: owner,
+			archive: func() *domain.BackupArchive {
+				tampered := *archive
+				ciphertext, err := base64.StdEncoding.DecodeString(tampered.Ciphertext)
+				requires.NoError(err)
+				ciphertext[len(ciphertext)-1] ^= 1
+				tampered.Ciphertext = base64.StdEncoding.EncodeToString(ciphertext)
+				return &tampered
+			},
+			secret: secret,
+			err:    utils.ErrInvalidBackupArchive,
+		},
+		{
+			name:      "Import_Too_Many_Iterations",
+			principal: owner,
+			archive: func() *domain.BackupArchive {
+				expensive := *archive
+				expensive.Iterations = utils.MaxBackupKDFIterations + 1
+				return &expensive
+			},
+			secret: secret,
+			err:    utils.ErrInvalidBackupArchive,
+		},
+		{name: "Import_Other_Owner", principal: &domain.Principal{ID: utils.RandomString(8), Owner: utils.RandomString(8)}, secret: secret, err: utils.ErrPermissionDenied},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target := newBackupTestService(persistence.NewInMemorySignatureDeviceRepository(nil), "6543210987654321")
+			a := archive
+			if tc.archive != nil {
+				a = tc.archive()
+			}
+			restored, err := target.ImportSignatureDevices(context.Background(), tc.principal, utils.DefaultTenant, a, tc.secret)
+			requires.ErrorIs(err, tc.err)
+			requires.Zero(restored)
+		})
+	}
+
+	limited := NewSignatureService(SignatureServiceParams{
+		Repo:               persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory:     crypto.NewKeyPairFactory(),
+		SignerFactory:      crypto.NewSignerFactory(),
+		TenantDeviceLimits: map[string]int{utils.DefaultTenant: 1},
+	})
+	_, err = limited.CreateSignatureDevice(context.Background(), owner, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        utils.RandomString(16),
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.NoError(err)
+	restored, err := limited.ImportSignatureDevices(context.Background(), owner, utils.DefaultTenant, archive, secret)
+	requires.ErrorIs(err, utils.ErrTenantDeviceLimit)
+	requires.Zero(restored)
+}
+
+// openBackup decrypts the payload of an archive.
+func openBackup(t *testing.T, archive *domain.BackupArchive, secret domain.BackupSecret) (domain.BackupPayload, []byte) {
+	wrappingKey, err := wrappingKeyOf(archive, secret)
+	require.NoError(t, err)
+	plaintext, err := crypto.DecryptGCM(archive.Ciphertext, wrappingKey)
+	require.NoError(t, err)
+	var payload domain.BackupPayload
+	require.NoError(t, json.Unmarshal(plaintext, &payload))
+	return payload, wrappingKey
+}
+
+// resealBackup replaces the payload of an archive, keeping its wrapping key so
+// that the private keys of the payload stay readable.
+func resealBackup(t *testing.T, archive *domain.BackupArchive, wrappingKey []byte, payload domain.BackupPayload) *domain.BackupArchive {
+	plaintext, err := json.Marshal(payload)
+	require.NoError(t, err)
+	resealed := *archive
+	resealed.Ciphertext, err = crypto.EncryptGCM(plaintext, wrappingKey)
+	require.NoError(t, err)
+	return &resealed
+}
+
+func TestImportInconsistentBackup(t *testing.T) {
+	requires := require.New(t)
+	secret := domain.BackupSecret{Passphrase: "correct horse battery staple"}
+	source := newBackupTestService(persistence.NewInMemorySignatureDeviceRepository(nil), "1234567890123456")
+	deviceId, otherId := utils.RandomString(16), utils.RandomString(16)
+	for _, id := range []string{deviceId, otherId} {
+		_, err := source.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+			ID:        id,
+			Algorithm: utils.Algorithms[1],
+		})
+		requires.NoError(err)
+	}
+	_, err := source.RotateDeviceKey(context.Background(), nil, utils.DefaultTenant, deviceId)
+	requires.NoError(err)
+	archive, err := source.ExportSignatureDevices(context.Background(), nil, utils.DefaultTenant, secret)
+	requires.NoError(err)
+	payload, wrappingKey := openBackup(t, archive, secret)
+	var valid, other domain.DeviceBackup
+	for _, backup := range payload.Devices {
+		if backup.ID == deviceId {
+			valid = backup
+		} else {
+			other = backup
+		}
+	}
+
+	untampered := newBackupTestService(persistence.NewInMemorySignatureDeviceRepository(nil), "6543210987654321")
+	restored, err := untampered.ImportSignatureDevices(context.Background(), nil, utils.DefaultTenant, resealBackup(t, archive, wrappingKey, domain.BackupPayload{Devices: []domain.DeviceBackup{valid}}), secret)
+	requires.NoError(err)
+	requires.Equal(1, restored)
+
+	testCases := []struct {
+		name   string
+		tamper func(backup *domain.DeviceBackup)
+	}{
+		{name: "Unsupported_Algorithm", tamper: func(backup *domain.DeviceBackup) { backup.Algorithm = "DSA" }},
+		{name: "Algorithm_Of_Other_Key", tamper: func(backup *domain.DeviceBackup) { backup.Algorithm = utils.Algorithms[0] }},
+		{name: "Unknown_Status", tamper: func(backup *domain.DeviceBackup) { backup.Status = "paused" }},
+		{name: "Negative_Counter", tamper: func(backup *domain.DeviceBackup) { backup.SignatureCounter = -1 }},
+		{name: "Zero_Max_Signatures", tamper: func(backup *domain.DeviceBackup) { backup.MaxSignatures = new(int) }},
+		{name: "Key_Version_Without_History", tamper: func(backup *domain.DeviceBackup) { backup.KeyHistory = nil }},
+		{name: "Invalid_Key_History", tamper: func(backup *domain.DeviceBackup) {
+			backup.KeyHistory = []domain.DeviceKey{{Version: 1, PublicKey: utils.RandomString(32)}}
+		}},
+		{name: "Public_Key_Of_Other_Device", tamper: func(backup *domain.DeviceBackup) { backup.PublicKey = other.PublicKey }},
+		{name: "Private_Key_Of_Other_Device", tamper: func(backup *domain.DeviceBackup) { backup.WrappedPrivateKey = other.WrappedPrivateKey }},
+		{name: "Active_Without_Private_Key", tamper: func(backup *domain.DeviceBackup) { backup.WrappedPrivateKey = "" }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			backup := valid
+			tc.tamper(&backup)
+			target := newBackupTestService(persistence.NewInMemorySignatureDeviceRepository(nil), "6543210987654321")
+			restored, err := target.ImportSignatureDevices(context.Background(), nil, utils.DefaultTenant, resealBackup(t, archive, wrappingKey, domain.BackupPayload{Devices: []domain.DeviceBackup{backup}}), secret)
+			require.ErrorIs(t, err, utils.ErrInvalidBackupArchive)
+			require.Zero(t, restored)
+		})
+	}
+}
+
+func TestImportOverExistingDevice(t *testing.T) {
+	requires := require.New(t)
+	secret := domain.BackupSecret{Passphrase: "correct horse battery staple"}
+	owner := &domain.Principal{ID: utils.RandomString(8), Owner: utils.RandomString(8)}
+	service := newBackupTestService(persistence.NewInMemorySignatureDeviceRepository(nil), "1234567890123456")
+	deviceId := utils.RandomString(16)
+	_, err := service.CreateSignatureDevice(context.Background(), owner, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.NoError(err)
+	export := func() *domain.BackupArchive {
+		archive, err := service.ExportSignatureDevices(context.Background(), owner, utils.DefaultTenant, secret)
+		requires.NoError(err)
+		return archive
+	}
+	sign := func() {
+		device, err := service.GetSignatureDevice(context.Background(), owner, utils.DefaultTenant, deviceId)
+		requires.NoError(err)
+		_, err = service.SignTransaction(context.Background(), owner, utils.DefaultTenant, deviceId, fmt.Sprintf("%d_TestData_%s", device.SignatureCounter, device.LastSignature))
+		requires.NoError(err)
+	}
+
+	// Restoring the current state again changes nothing.
+	restored, err := service.ImportSignatureDevices(context.Background(), owner, utils.DefaultTenant, export(), secret)
+	requires.NoError(err)
+	requires.Equal(1, restored)
+
+	// An older backup would reuse signature counters.
+	older := export()
+	sign()
+	restored, err = service.ImportSignatureDevices(context.Background(), owner, utils.DefaultTenant, older, secret)
+	requires.ErrorIs(err, utils.ErrBackupRollback)
+	requires.Zero(restored)
+
+	// A backup of an active device would reactivate it.
+	active := export()
+	_, err = service.UpdateSignatureDevice(context.Background(), owner, utils.DefaultTenant, deviceId, statusUpdate(utils.DeviceStatusSuspended))
+	requires.NoError(err)
+	restored, err = service.ImportSignatureDevices(context.Background(), owner, utils.DefaultTenant, active, secret)
+	requires.ErrorIs(err, utils.ErrBackupRollback)
+	requires.Zero(restored)
+
+	// Devices of other owners are not replaced.
+	other := &domain.Principal{ID: utils.RandomString(8), Owner: utils.RandomString(8)}
+	archive := export()
+	payload, wrappingKey := openBackup(t, archive, secret)
+	payload.Devices[0].Owner = other.Owner
+	restored, err = service.ImportSignatureDevices(context.Background(), other, utils.DefaultTenant, resealBackup(t, archive, wrappingKey, payload), secret)
+	requires.ErrorIs(err, utils.ErrPermissionDenied)
+	requires.Zero(restored)
+
+	device, err := service.GetSignatureDevice(context.Background(), owner, utils.DefaultTenant, deviceId)
+	requires.NoError(err)
+	requires.Equal(utils.DeviceStatusSuspended, device.Status)
+	requires.Equal(1, device.SignatureCounter)
+}
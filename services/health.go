@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/uwemakan/signing-service/crypto"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/persistence"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// canaryAlgorithm is the algorithm of the canary key readiness checks sign
+// with, the cheaper of the two.
+const canaryAlgorithm = "ECC"
+
+// canaryData is what readiness checks sign with the canary key.
+var canaryData = []byte("readiness")
+
+// HealthService checks the dependencies the signature service needs to serve
+// requests.
+type HealthService interface {
+	// Ready checks the repository, the key encryption key, signing and the
+	// key generation queue. Checks are keyed by component and measurement,
+	// e.g. repository:responseTime.
+	Ready(ctx context.Context) map[string][]domain.HealthCheck
+}
+
+type healthService struct {
+	repo          persistence.SignatureDeviceRepository
+	signerFactory *crypto.SignerFactory
+	workerPool    *WorkerPool
+	kek           []byte
+	clock         utils.Clock
+	// canaryKey is the private key of the canary, which readiness checks
+	// encrypt and decrypt with the KEK like the keys of devices. canaryErr is
+	// set when it couldn't be generated.
+	canaryKey []byte
+	canaryErr error
+}
+
+// HealthServiceParams holds the dependencies of the HealthService. KEK and
+// Clock default like in SignatureServiceParams. WorkerPool is optional, the
+// key generation queue is not checked without it.
+type HealthServiceParams struct {
+	Repo           persistence.SignatureDeviceRepository
+	KeyPairFactory *crypto.KeyPairFactory
+	SignerFactory  *crypto.SignerFactory
+	WorkerPool     *WorkerPool
+	KEK            []byte
+	Clock          utils.Clock
+}
+
+// NewHealthService generates the canary key readiness checks sign with.
+func NewHealthService(params HealthServiceParams) HealthService {
+	kek := params.KEK
+	if kek == nil {
+		kek = aesKey
+	}
+	clock := params.Clock
+	if clock == nil {
+		clock = utils.SystemClock{}
+	}
+	s := &healthService{
+		repo:          params.Repo,
+		signerFactory: params.SignerFactory,
+		workerPool:    params.WorkerPool,
+		kek:           kek,
+		clock:         clock,
+	}
+	_, s.canaryKey, s.canaryErr = params.KeyPairFactory.GenerateKeyPair(context.Background(), canaryAlgorithm)
+	return s
+}
+
+func (s *healthService) Ready(ctx context.Context) map[string][]domain.HealthCheck {
+	checks := map[string][]domain.HealthCheck{
+		"repository:responseTime": {s.checkRepository(ctx)},
+	}
+	privateKey, kekCheck := s.checkKEK()
+	checks["kek:availability"] = []domain.HealthCheck{kekCheck}
+	checks["signer:responseTime"] = []domain.HealthCheck{s.checkSigner(ctx, privateKey, kekCheck)}
+	if s.workerPool != nil {
+		checks["keyGenerationQueue:depth"] = []domain.HealthCheck{s.checkQueue()}
+	}
+	return checks
+}
+
+// checkRepository reads from the repository.
+func (s *healthService) checkRepository(ctx context.Context) domain.HealthCheck {
+	start := s.clock.Now()
+	_, err := s.repo.CountDevices(ctx, utils.DefaultTenant)
+	return s.timed("datastore", start, err)
+}
+
+// checkKEK encrypts the canary key with the KEK and decrypts it again, as
+// keys are wrapped and unwrapped when devices are created and sign, and
+// returns the decrypted key once it matches the canary key.
+func (s *healthService) checkKEK() (string, domain.HealthCheck) {
+	check := domain.HealthCheck{ComponentType: "component", Status: utils.HealthStatusPass, Time: s.clock.Now()}
+	err := s.canaryErr
+	var wrappedKey, privateKey string
+	if err == nil {
+		// EncryptAES pads in place when the slice has room to spare.
+		wrappedKey, err = crypto.EncryptAES(slices.Clip(s.canaryKey), s.kek)
+	}
+	if err == nil {
+		privateKey, err = crypto.DecryptAES(wrappedKey, s.kek)
+	}
+	if err == nil && privateKey != string(s.canaryKey) {
+		err = errors.New("canary key changed in a round trip through the KEK")
+	}
+	if err != nil {
+		check.Status = utils.HealthStatusFail
+		check.Output = err.Error()
+	}
+	return privateKey, check
+}
+
+// checkSigner signs with the canary key, which is only available when the
+// KEK check passed.
+func (s *healthService) checkSigner(ctx context.Context, privateKey string, kekCheck domain.HealthCheck) domain.HealthCheck {
+	start := s.clock.Now()
+	if kekCheck.Status != utils.HealthStatusPass {
+		return s.timed("component", start, fmt.Errorf("canary key unavailable: %s", kekCheck.Output))
+	}
+	signer, err := s.signerFactory.GetSigner(ctx, canaryAlgorithm, []byte(privateKey))
+	if err == nil {
+		_, err = signer.Sign(canaryData)
+	}
+	return s.timed("component", start, err)
+}
+
+// checkQueue warns when the key generation queue is nearly full, as async
+// device creation is soon turned away.
+func (s *healthService) checkQueue() domain.HealthCheck {
+	depth := s.workerPool.Depth()
+	check := domain.HealthCheck{
+		ComponentType: "component",
+		ObservedValue: depth,
+		ObservedUnit:  "jobs",
+		Status:        utils.HealthStatusPass,
+		Time:          s.clock.Now(),
+	}
+	if float64(depth) >= utils.HealthQueueWarnRatio*float64(s.workerPool.Capacity()) {
+		check.Status = utils.HealthStatusWarn
+		check.Output = fmt.Sprintf("%d of %d queued jobs", depth, s.workerPool.Capacity())
+	}
+	return check
+}
+
+// timed returns a response time check of an operation started at start that
+// failed with err, if not nil.
+func (s *healthService) timed(componentType string, start time.Time, err error) domain.HealthCheck {
+	now := s.clock.Now()
+	check := domain.HealthCheck{
+		ComponentType: componentType,
+		ObservedValue: float64(now.Sub(start).Microseconds()) / 1000,
+		ObservedUnit:  "ms",
+		Status:        utils.HealthStatusPass,
+		Time:          now,
+	}
+	if err != nil {
+		check.Status = utils.HealthStatusFail
+		check.Output = err.Error()
+	}
+	return check
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/crypto"
+	"github.com/uwemakan/signing-service/persistence"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func TestHealthServiceReady(t *testing.T) {
+	requires := require.New(t)
+	newHealthService := func(kek []byte, pool *WorkerPool) HealthService {
+		return NewHealthService(HealthServiceParams{
+			Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+			KeyPairFactory: crypto.NewKeyPairFactory(),
+			SignerFactory:  crypto.NewSignerFactory(),
+			WorkerPool:     pool,
+			KEK:            kek,
+		})
+	}
+	statuses := func(ctx context.Context, service HealthService) map[string]string {
+		result := make(map[string]string)
+		for name, checks := range service.Ready(ctx) {
+			requires.Len(checks, 1, name)
+			result[name] = checks[0].Status
+		}
+		return result
+	}
+
+	pool := NewWorkerPool(1, 5)
+	service := newHealthService(nil, pool)
+	requires.Equal(map[string]string{
+		"repository:responseTime":  utils.HealthStatusPass,
+		"kek:availability":         utils.HealthStatusPass,
+		"signer:responseTime":      utils.HealthStatusPass,
+		"keyGenerationQueue:depth": utils.HealthStatusPass,
+	}, statuses(context.Background(), service))
+
+	// A nearly full key generation queue is a warning only.
+	release := make(chan struct{})
+	started := make(chan struct{})
+	requires.NoError(pool.Submit(func() {
+		close(started)
+		<-release
+	}))
+	<-started
+	for range 4 {
+		requires.NoError(pool.Submit(func() {}))
+	}
+	checks := service.Ready(context.Background())["keyGenerationQueue:depth"]
+	requires.Equal(utils.HealthStatusWarn, checks[0].Status)
+	requires.Equal(4, checks[0].ObservedValue)
+	close(release)
+
+	// Without a usable KEK the canary key can neither be encrypted nor used.
+	broken := newHealthService([]byte("short"), nil)
+	requires.Equal(map[string]string{
+		"repository:responseTime": utils.HealthStatusPass,
+		"kek:availability":        utils.HealthStatusFail,
+		"signer:responseTime":     utils.HealthStatusFail,
+	}, statuses(context.Background(), broken))
+	checks = broken.Ready(context.Background())["kek:availability"]
+	requires.Contains(checks[0].Output, "invalid key size")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	checks = service.Ready(ctx)["repository:responseTime"]
+	requires.Equal(utils.HealthStatusFail, checks[0].Status)
+	requires.Equal(context.Canceled.Error(), checks[0].Output)
+}
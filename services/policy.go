@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// Role grants a set of permissions. Permissions of a role with
+// AssignedDevicesOnly only apply to the devices assigned to a principal.
+type Role struct {
+	Permissions         []string `json:"permissions"`
+	AssignedDevicesOnly bool     `json:"assignedDevicesOnly"`
+}
+
+// RoleBinding assigns roles and devices to a principal.
+type RoleBinding struct {
+	Roles   []string `json:"roles"`
+	Devices []string `json:"devices"`
+}
+
+// Policy maps roles to permissions and principals to their role bindings.
+// Bindings are keyed by the qualified ID of the principal, its credential
+// type and ID, e.g. key:<API key ID>, jwt:<token subject> or
+// cert:<certificate subject>. Principals without a binding have no
+// permissions.
+type Policy struct {
+	Roles    map[string]Role        `json:"roles"`
+	Bindings map[string]RoleBinding `json:"bindings"`
+}
+
+// DefaultRoles returns the built-in roles: admins may do everything,
+// operators may list, audit and back up devices and jobs and signers may only
+// sign with their assigned devices.
+func DefaultRoles() map[string]Role {
+	return map[string]Role{
+		utils.RoleAdmin: {
+			Permissions: slices.Clone(utils.Permissions),
+		},
+		utils.RoleOperator: {
+			Permissions: []string{utils.PermissionDevicesBackup, utils.PermissionDevicesList, utils.PermissionDevicesRead, utils.PermissionJobsRead},
+		},
+		utils.RoleSigner: {
+			Permissions:         []string{utils.PermissionTransactionsSign},
+			AssignedDevicesOnly: true,
+		},
+	}
+}
+
+// LoadPolicy reads a JSON policy file. Roles defined in the file replace the
+// default roles of the same name.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	roles := DefaultRoles()
+	for name, role := range policy.Roles {
+		roles[name] = role
+	}
+	policy.Roles = roles
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (p *Policy) validate() error {
+	for name, role := range p.Roles {
+		for _, permission := range role.Permissions {
+			if !slices.Contains(utils.Permissions, permission) {
+				return fmt.Errorf("role %s: unknown permission %q", name, permission)
+			}
+		}
+	}
+	for principal, binding := range p.Bindings {
+		credential, id, found := strings.Cut(principal, ":")
+		if !found || id == "" || !slices.Contains(utils.Credentials, credential) {
+			return fmt.Errorf("binding %s: must be <credential>:<id> with a credential of %s", principal, utils.Credentials)
+		}
+		for _, role := range binding.Roles {
+			if _, exists := p.Roles[role]; !exists {
+				return fmt.Errorf("binding %s: unknown role %q", principal, role)
+			}
+		}
+	}
+	return nil
+}
+
+// Allowed reports whether the principal has the permission. deviceId names the
+// device the permission is exercised on and is empty for permissions that
+// don't concern a single device.
+func (p *Policy) Allowed(principal *domain.Principal, permission, deviceId string) bool {
+	binding, exists := p.Bindings[principal.QualifiedID()]
+	if !exists {
+		return false
+	}
+	for _, name := range binding.Roles {
+		role := p.Roles[name]
+		if !slices.Contains(role.Permissions, permission) {
+			continue
+		}
+		if !role.AssignedDevicesOnly || (deviceId != "" && slices.Contains(binding.Devices, deviceId)) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the principal is bound to any of the roles.
+func (p *Policy) HasRole(principal *domain.Principal, roles ...string) bool {
+	return slices.ContainsFunc(p.Bindings[principal.QualifiedID()].Roles, func(role string) bool {
+		return slices.Contains(roles, role)
+	})
+}
+
+// authorizedSignatureService enforces a Policy in front of a SignatureService.
+type authorizedSignatureService struct {
+	next   SignatureService
+	policy *Policy
+}
+
+// NewAuthorizedSignatureService wraps a SignatureService so that every call is
+// checked against the policy. Calls without a principal are only made when
+// authentication is disabled and are passed through.
+func NewAuthorizedSignatureService(next SignatureService, policy *Policy) SignatureService {
+	return &authorizedSignatureService{next: next, policy: policy}
+}
+
+// authorize checks the permission and returns the principal to call the
+// wrapped service with. A principal the policy grants a permission is not
+// limited to its own devices, it may exercise it on every device of its
+// tenant.
+func (s *authorizedSignatureService) authorize(principal *domain.Principal, permission, deviceId string) (*domain.Principal, error) {
+	if principal == nil {
+		return nil, nil
+	}
+	if !s.policy.Allowed(principal, permission, deviceId) {
+		return nil, utils.ErrPermissionDenied
+	}
+	granted := *principal
+	granted.AnyOwner = true
+	return &granted, nil
+}
+
+func (s *authorizedSignatureService) ListSignatureDevices(ctx context.Context, principal *domain.Principal, tenantID string, query domain.DeviceQuery) (*domain.DevicePage, error) {
+	principal, err := s.authorize(principal, utils.PermissionDevicesList, "")
+	if err != nil {
+		return nil, err
+	}
+	return s.next.ListSignatureDevices(ctx, principal, tenantID, query)
+}
+
+func (s *authorizedSignatureService) GetSignatureDevice(ctx context.Context, principal *domain.Principal, tenantID, deviceId string) (*domain.SignatureDevice, error) {
+	principal, err := s.authorize(principal, utils.PermissionDevicesRead, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return s.next.GetSignatureDevice(ctx, principal, tenantID, deviceId)
+}
+
+func (s *authorizedSignatureService) CreateSignatureDevice(ctx context.Context, principal *domain.Principal, tenantID string, request *domain.SignatureDeviceRequest) (*domain.SignatureDevice, error) {
+	principal, err := s.authorize(principal, utils.PermissionDevicesCreate, "")
+	if err != nil {
+		return nil, err
+	}
+	return s.next.CreateSignatureDevice(ctx, principal, tenantID, request)
+}
+
+func (s *authorizedSignatureService) CreateSignatureDeviceAsync(ctx context.Context, principal *domain.Principal, tenantID string, request *domain.SignatureDeviceRequest) (*domain.Job, error) {
+	principal, err := s.authorize(principal, utils.PermissionDevicesCreate, "")
+	if err != nil {
+		return nil, err
+	}
+	return s.next.CreateSignatureDeviceAsync(ctx, principal, tenantID, request)
+}
+
+func (s *authorizedSignatureService) GetJob(ctx context.Context, principal *domain.Principal, tenantID, jobId string) (*domain.Job, error) {
+	principal, err := s.authorize(principal, utils.PermissionJobsRead, "")
+	if err != nil {
+		return nil, err
+	}
+	return s.next.GetJob(ctx, principal, tenantID, jobId)
+}
+
+func (s *authorizedSignatureService) SignTransaction(ctx context.Context, principal *domain.Principal, tenantID, deviceId, data string) (*domain.SignTransactionResponse, error) {
+	principal, err := s.authorize(principal, utils.PermissionTransactionsSign, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return s.next.SignTransaction(ctx, principal, tenantID, deviceId, data)
+}
+
+func (s *authorizedSignatureService) VerifySignature(ctx context.Context, principal *domain.Principal, tenantID, deviceId, signedData, signature string) (*domain.SignatureVerification, error) {
+	principal, err := s.authorize(principal, utils.PermissionDevicesRead, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return s.next.VerifySignature(ctx, principal, tenantID, deviceId, signedData, signature)
+}
+
+// UpdateSignatureDevice requires PermissionDevicesDeactivate to change the
+// status and PermissionDevicesUpdate to change the label or metadata.
+func (s *authorizedSignatureService) UpdateSignatureDevice(ctx context.Context, principal *domain.Principal, tenantID, deviceId string, request *domain.UpdateSignatureDeviceRequest) (*domain.SignatureDevice, error) {
+	granted := principal
+	if request.Status != nil {
+		authorized, err := s.authorize(principal, utils.PermissionDevicesDeactivate, deviceId)
+		if err != nil {
+			return nil, err
+		}
+		granted = authorized
+	}
+	if request.Label != nil || request.Metadata != nil {
+		authorized, err := s.authorize(principal, utils.PermissionDevicesUpdate, deviceId)
+		if err != nil {
+			return nil, err
+		}
+		granted = authorized
+	}
+	return s.next.UpdateSignatureDevice(ctx, granted, tenantID, deviceId, request)
+}
+
+func (s *authorizedSignatureService) RotateDeviceKey(ctx context.Context, principal *domain.Principal, tenantID, deviceId string) (*domain.KeyRotation, error) {
+	principal, err := s.authorize(principal, utils.PermissionDevicesRotate, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return s.next.RotateDeviceKey(ctx, principal, tenantID, deviceId)
+}
+
+// authorizeRole is authorize for permissions that are in addition reserved
+// for principals bound to one of the roles, whatever other roles grant.
+func (s *authorizedSignatureService) authorizeRole(principal *domain.Principal, permission string, roles ...string) (*domain.Principal, error) {
+	granted, err := s.authorize(principal, permission, "")
+	if err != nil {
+		return nil, err
+	}
+	if principal != nil && !s.policy.HasRole(principal, roles...) {
+		return nil, utils.ErrPermissionDenied
+	}
+	return granted, nil
+}
+
+// ExportSignatureDevices is reserved for admins and operators, exports carry
+// the private keys of the devices.
+func (s *authorizedSignatureService) ExportSignatureDevices(ctx context.Context, principal *domain.Principal, tenantID string, secret domain.BackupSecret) (*domain.BackupArchive, error) {
+	principal, err := s.authorizeRole(principal, utils.PermissionDevicesBackup, utils.RoleAdmin, utils.RoleOperator)
+	if err != nil {
+		return nil, err
+	}
+	return s.next.ExportSignatureDevices(ctx, principal, tenantID, secret)
+}
+
+// ImportSignatureDevices is reserved for admins, restores replace the state
+// and keys of devices.
+func (s *authorizedSignatureService) ImportSignatureDevices(ctx context.Context, principal *domain.Principal, tenantID string, archive *domain.BackupArchive, secret domain.BackupSecret) (int, error) {
+	principal, err := s.authorizeRole(principal, utils.PermissionDevicesRestore, utils.RoleAdmin)
+	if err != nil {
+		return 0, err
+	}
+	return s.next.ImportSignatureDevices(ctx, principal, tenantID, archive, secret)
+}
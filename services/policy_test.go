@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/crypto"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/persistence"
+	"github.com/uwemakan/signing-service/utils"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	requires := require.New(t)
+
+	testCases := []struct {
+		name    string
+		content string
+		err     bool
+		check   func(policy *Policy)
+	}{
+		{
+			name:    "LoadPolicy_Default_Roles",
+			content: `{"bindings": {"key:key-a": {"roles": ["operator"]}}}`,
+			check: func(policy *Policy) {
+				requires.Equal(DefaultRoles(), policy.Roles)
+				requires.Equal([]string{utils.RoleOperator}, policy.Bindings["key:key-a"].Roles)
+			},
+		},
+		{
+			name:    "LoadPolicy_Override_Role",
+			content: `{"roles": {"operator": {"permissions": ["devices:list"]}, "auditor": {"permissions": ["jobs:read"]}}}`,
+			check: func(policy *Policy) {
+				requires.Equal([]string{utils.PermissionDevicesList}, policy.Roles[utils.RoleOperator].Permissions)
+				requires.Equal([]string{utils.PermissionJobsRead}, policy.Roles["auditor"].Permissions)
+				requires.Equal(DefaultRoles()[utils.RoleAdmin], policy.Roles[utils.RoleAdmin])
+			},
+		},
+		{name: "LoadPolicy_Unknown_Permission", content: `{"roles": {"operator": {"permissions": ["devices:delete"]}}}`, err: true},
+		{name: "LoadPolicy_Unknown_Role", content: `{"bindings": {"key:key-a": {"roles": ["root"]}}}`, err: true},
+		{name: "LoadPolicy_Unqualified_Binding", content: `{"bindings": {"key-a": {"roles": ["operator"]}}}`, err: true},
+		{name: "LoadPolicy_Unknown_Credential", content: `{"bindings": {"oidc:key-a": {"roles": ["operator"]}}}`, err: true},
+		{name: "LoadPolicy_Invalid_JSON", content: `{`, err: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			requires.NoError(os.WriteFile(path, []byte(tc.content), 0o600))
+			policy, err := LoadPolicy(path)
+			if tc.err {
+				requires.Error(err)
+				return
+			}
+			requires.NoError(err)
+			tc.check(policy)
+		})
+	}
+}
+
+func TestPolicyAllowed(t *testing.T) {
+	requires := require.New(t)
+	policy := &Policy{
+		Roles: DefaultRoles(),
+		Bindings: map[string]RoleBinding{
+			"key:admin":    {Roles: []string{utils.RoleAdmin}},
+			"key:operator": {Roles: []string{utils.RoleOperator}},
+			"key:signer":   {Roles: []string{utils.RoleSigner}, Devices: []string{"device-a"}},
+		},
+	}
+
+	testCases := []struct {
+		principal  string
+		permission string
+		deviceId   string
+		allowed    bool
+	}{
+		{principal: "admin", permission: utils.PermissionDevicesCreate, allowed: true},
+		{principal: "admin", permission: utils.PermissionTransactionsSign, deviceId: "device-b", allowed: true},
+		{principal: "operator", permission: utils.PermissionDevicesList, allowed: true},
+		{principal: "operator", permission: utils.PermissionJobsRead, allowed: true},
+		{principal: "operator", permission: utils.PermissionDevicesCreate, allowed: false},
+		{principal: "operator", permission: utils.PermissionTransactionsSign, deviceId: "device-a", allowed: false},
+		{principal: "signer", permission: utils.PermissionTransactionsSign, deviceId: "device-a", allowed: true},
+		{principal: "signer", permission: utils.PermissionTransactionsSign, deviceId: "device-b", allowed: false},
+		{principal: "signer", permission: utils.PermissionDevicesList, allowed: false},
+		{principal: "unbound", permission: utils.PermissionDevicesList, allowed: false},
+	}
+	for _, tc := range testCases {
+		principal := &domain.Principal{ID: tc.principal, Credential: utils.CredentialAPIKey}
+		requires.Equal(tc.allowed, policy.Allowed(principal, tc.permission, tc.deviceId), "%s %s %s", tc.principal, tc.permission, tc.deviceId)
+	}
+
+	// A token whose subject is the ID of an admin API key is not an admin.
+	subject := &domain.Principal{ID: "admin", Credential: utils.CredentialJWT}
+	requires.False(policy.Allowed(subject, utils.PermissionDevicesCreate, ""))
+	requires.False(policy.HasRole(subject, utils.RoleAdmin))
+}
+
+func TestAuthorizedSignatureService(t *testing.T) {
+	requires := require.New(t)
+	policy := &Policy{
+		Roles: DefaultRoles(),
+		Bindings: map[string]RoleBinding{
+			"key:admin":    {Roles: []string{utils.RoleAdmin}},
+			"key:operator": {Roles: []string{utils.RoleOperator}},
+			"key:signer":   {Roles: []string{utils.RoleSigner}},
+		},
+	}
+	service := NewAuthorizedSignatureService(NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	}), policy)
+	admin := &domain.Principal{ID: "admin", Credential: utils.CredentialAPIKey, Owner: "merchant"}
+	operator := &domain.Principal{ID: "operator", Credential: utils.CredentialAPIKey, Owner: "merchant"}
+	signer := &domain.Principal{ID: "signer", Credential: utils.CredentialAPIKey, Owner: "merchant"}
+
+	deviceId := utils.RandomString(16)
+	request := &domain.SignatureDeviceRequest{ID: deviceId, Algorithm: utils.Algorithms[1]}
+	_, err := service.CreateSignatureDevice(context.Background(), operator, utils.DefaultTenant, request)
+	requires.ErrorIs(err, utils.ErrPermissionDenied)
+	_, err = service.CreateSignatureDeviceAsync(context.Background(), signer, utils.DefaultTenant, request)
+	requires.ErrorIs(err, utils.ErrPermissionDenied)
+	_, err = service.CreateSignatureDevice(context.Background(), admin, utils.DefaultTenant, request)
+	requires.NoError(err)
+
+	page, err := service.ListSignatureDevices(context.Background(), operator, utils.DefaultTenant, domain.DeviceQuery{})
+	requires.NoError(err)
+	requires.Len(page.Devices, 1)
+	_, err = service.GetSignatureDevice(context.Background(), signer, utils.DefaultTenant, deviceId)
+	requires.ErrorIs(err, utils.ErrPermissionDenied)
+	_, err = service.SignTransaction(context.Background(), signer, utils.DefaultTenant, deviceId, "data")
+	requires.ErrorIs(err, utils.ErrPermissionDenied)
+
+	page, err = service.ListSignatureDevices(context.Background(), nil, utils.DefaultTenant, domain.DeviceQuery{})
+	requires.NoError(err)
+	requires.Len(page.Devices, 1)
+
+	// Backups are reserved for admins and operators and restores for admins,
+	// even when other roles grant the permissions.
+	policy.Roles["archivist"] = Role{Permissions: []string{utils.PermissionDevicesBackup, utils.PermissionDevicesRestore}}
+	policy.Bindings["key:archivist"] = RoleBinding{Roles: []string{"archivist"}}
+	archivist := &domain.Principal{ID: "archivist", Credential: utils.CredentialAPIKey, Owner: "merchant"}
+	secret := domain.BackupSecret{Passphrase: "correct horse battery staple"}
+	_, err = service.ExportSignatureDevices(context.Background(), archivist, utils.DefaultTenant, secret)
+	requires.ErrorIs(err, utils.ErrPermissionDenied)
+	archive, err := service.ExportSignatureDevices(context.Background(), operator, utils.DefaultTenant, secret)
+	requires.NoError(err)
+	_, err = service.ImportSignatureDevices(context.Background(), archivist, utils.DefaultTenant, archive, secret)
+	requires.ErrorIs(err, utils.ErrPermissionDenied)
+	_, err = service.ImportSignatureDevices(context.Background(), operator, utils.DefaultTenant, archive, secret)
+	requires.ErrorIs(err, utils.ErrPermissionDenied)
+	restored, err := service.ImportSignatureDevices(context.Background(), admin, utils.DefaultTenant, archive, secret)
+	requires.NoError(err)
+	requires.Equal(1, restored)
+}
+
+func TestAuthorizedSignatureServiceOtherOwners(t *testing.T) {
+	requires := require.New(t)
+	deviceId := utils.RandomString(16)
+	policy := &Policy{
+		Roles: DefaultRoles(),
+		Bindings: map[string]RoleBinding{
+			"key:creator":  {Roles: []string{utils.RoleAdmin}},
+			"jwt:operator": {Roles: []string{utils.RoleOperator}},
+			"jwt:signer":   {Roles: []string{utils.RoleSigner}, Devices: []string{deviceId}},
+			"jwt:other":    {Roles: []string{utils.RoleSigner}},
+		},
+	}
+	service := NewAuthorizedSignatureService(NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	}), policy)
+	creator := &domain.Principal{ID: "creator", Credential: utils.CredentialAPIKey, Owner: "key:merchant"}
+	operator := &domain.Principal{ID: "operator", Credential: utils.CredentialJWT, Owner: "jwt:operator"}
+	signer := &domain.Principal{ID: "signer", Credential: utils.CredentialJWT, Owner: "jwt:signer"}
+	other := &domain.Principal{ID: "other", Credential: utils.CredentialJWT, Owner: "jwt:other"}
+
+	_, err := service.CreateSignatureDevice(context.Background(), creator, utils.DefaultTenant, &domain.SignatureDeviceRequest{ID: deviceId, Algorithm: utils.Algorithms[1]})
+	requires.NoError(err)
+
+	// The operator and the signer own no devices, the policy grants them
+	// access to the device of another owner.
+	device, err := service.GetSignatureDevice(context.Background(), operator, utils.DefaultTenant, deviceId)
+	requires.NoError(err)
+	requires.Equal(creator.Owner, device.Owner)
+	page, err := service.ListSignatureDevices(context.Background(), operator, utils.DefaultTenant, domain.DeviceQuery{})
+	requires.NoError(err)
+	requires.Len(page.Devices, 1)
+	_, err = service.SignTransaction(context.Background(), signer, utils.DefaultTenant, deviceId, "0_TestData_"+base64.StdEncoding.EncodeToString([]byte(deviceId)))
+	requires.NoError(err)
+	_, err = service.SignTransaction(context.Background(), other, utils.DefaultTenant, deviceId, "data")
+	requires.ErrorIs(err, utils.ErrPermissionDenied)
+
+	// Grants stay within the tenant of the principal.
+	operator.Tenant = "tenant-a"
+	_, err = service.GetSignatureDevice(context.Background(), operator, utils.DefaultTenant, deviceId)
+	requires.ErrorIs(err, utils.ErrTenantAccessDenied)
+}
@@ -1,51 +1,302 @@
 package services
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/uwemakan/signing-service/crypto"
 	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/metrics"
 	"github.com/uwemakan/signing-service/persistence"
+	"github.com/uwemakan/signing-service/tracing"
 	"github.com/uwemakan/signing-service/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// aesKey is the default key encryption key.
 var aesKey = []byte("1234567890123456")
 
+// SignatureService manages the signature devices of a tenant on behalf of a
+// principal. Devices are owned by the principal that created them and are
+// invisible to others. A nil principal is only passed when authentication is
+// disabled and grants access to every device. Calls stop with the error of
+// ctx once it is cancelled or past its deadline.
 type SignatureService interface {
-	ListSignatureDevices() ([]*domain.SignatureDevice, error)
-	GetSignatureDevice(deviceId string) (*domain.SignatureDevice, error)
-	CreateSignatureDevice(request *domain.SignatureDeviceRequest) (*domain.SignatureDevice, error)
-	SignTransaction(deviceId, data string) (*domain.SignTransactionResponse, error)
+	ListSignatureDevices(ctx context.Context, principal *domain.Principal, tenantID string, query domain.DeviceQuery) (*domain.DevicePage, error)
+	GetSignatureDevice(ctx context.Context, principal *domain.Principal, tenantID, deviceId string) (*domain.SignatureDevice, error)
+	CreateSignatureDevice(ctx context.Context, principal *domain.Principal, tenantID string, request *domain.SignatureDeviceRequest) (*domain.SignatureDevice, error)
+	CreateSignatureDeviceAsync(ctx context.Context, principal *domain.Principal, tenantID string, request *domain.SignatureDeviceRequest) (*domain.Job, error)
+	GetJob(ctx context.Context, principal *domain.Principal, tenantID, jobId string) (*domain.Job, error)
+	SignTransaction(ctx context.Context, principal *domain.Principal, tenantID, deviceId, data string) (*domain.SignTransactionResponse, error)
+	VerifySignature(ctx context.Context, principal *domain.Principal, tenantID, deviceId, signedData, signature string) (*domain.SignatureVerification, error)
+	UpdateSignatureDevice(ctx context.Context, principal *domain.Principal, tenantID, deviceId string, request *domain.UpdateSignatureDeviceRequest) (*domain.SignatureDevice, error)
+	RotateDeviceKey(ctx context.Context, principal *domain.Principal, tenantID, deviceId string) (*domain.KeyRotation, error)
+	ExportSignatureDevices(ctx context.Context, principal *domain.Principal, tenantID string, secret domain.BackupSecret) (*domain.BackupArchive, error)
+	ImportSignatureDevices(ctx context.Context, principal *domain.Principal, tenantID string, archive *domain.BackupArchive, secret domain.BackupSecret) (int, error)
+}
+
+// deviceStatusTransitions lists the statuses a device can move to from its
+// current status. Decommissioning is final.
+var deviceStatusTransitions = map[string][]string{
+	utils.DeviceStatusActive:    {utils.DeviceStatusSuspended, utils.DeviceStatusDecommissioned},
+	utils.DeviceStatusSuspended: {utils.DeviceStatusActive, utils.DeviceStatusDecommissioned},
 }
 
 type signatureService struct {
-	repo           persistence.SignatureDeviceRepository
-	keyPairFactory *crypto.KeyPairFactory
-	signerFactory  *crypto.SignerFactory
+	repo               persistence.SignatureDeviceRepository
+	jobs               persistence.JobRepository
+	workerPool         *WorkerPool
+	keyPairFactory     *crypto.KeyPairFactory
+	signerFactory      *crypto.SignerFactory
+	kek                []byte
+	clock              utils.Clock
+	logger             *slog.Logger
+	metrics            *metrics.Metrics
+	tracer             trace.Tracer
+	deviceLimit        int
+	tenantDeviceLimits map[string]int
+	signatureLimiter   SignatureLimiter
+	// createMu serialises the limit check and insert of devices of tenants
+	// that have a device limit.
+	createMu sync.Mutex
+	// lifecycleMu serialises status transitions so that each is checked
+	// against the current status of the device.
+	lifecycleMu sync.Mutex
 }
 
+// SignatureServiceParams holds the dependencies of the SignatureService.
+// Jobs and WorkerPool are optional and default to an in-memory job
+// repository and a worker pool of utils.DefaultWorkerPoolSize workers.
+// KEK is the key encryption key private keys are encrypted with at rest and
+// imported wrapped keys are unwrapped with.
+// DeviceLimit caps the number of devices of every tenant unless overridden
+// in TenantDeviceLimits; zero means unlimited.
+// Clock decides when devices expire and defaults to the system clock.
+// Logger defaults to the default slog logger.
+// Metrics is optional, nothing is recorded without it.
+// TracerProvider defaults to the global OpenTelemetry tracer provider.
+// SignatureLimiter is optional, signatures are not rate limited without it.
 type SignatureServiceParams struct {
-	Repo           persistence.SignatureDeviceRepository
-	KeyPairFactory *crypto.KeyPairFactory
-	SignerFactory  *crypto.SignerFactory
+	Repo               persistence.SignatureDeviceRepository
+	Jobs               persistence.JobRepository
+	WorkerPool         *WorkerPool
+	KeyPairFactory     *crypto.KeyPairFactory
+	SignerFactory      *crypto.SignerFactory
+	KEK                []byte
+	Clock              utils.Clock
+	Logger             *slog.Logger
+	Metrics            *metrics.Metrics
+	TracerProvider     trace.TracerProvider
+	DeviceLimit        int
+	TenantDeviceLimits map[string]int
+	SignatureLimiter   SignatureLimiter
+}
+
+// SignatureLimiter rate limits the signatures of devices. AllowSignature
+// takes a token of the device and, when none is left, reports how long until
+// one is available.
+type SignatureLimiter interface {
+	AllowSignature(tenantID, deviceID string) (bool, time.Duration)
 }
 
 func NewSignatureService(params SignatureServiceParams) SignatureService {
-	return &signatureService{repo: params.Repo, keyPairFactory: params.KeyPairFactory, signerFactory: params.SignerFactory}
+	jobs := params.Jobs
+	if jobs == nil {
+		jobs = persistence.NewInMemoryJobRepository()
+	}
+	workerPool := params.WorkerPool
+	if workerPool == nil {
+		workerPool = NewWorkerPool(utils.DefaultWorkerPoolSize, utils.DefaultJobQueueSize)
+	}
+	kek := params.KEK
+	if kek == nil {
+		kek = aesKey
+	}
+	clock := params.Clock
+	if clock == nil {
+		clock = utils.SystemClock{}
+	}
+	logger := params.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	tracerProvider := params.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+	return &signatureService{
+		repo:               params.Repo,
+		jobs:               jobs,
+		workerPool:         workerPool,
+		keyPairFactory:     params.KeyPairFactory,
+		signerFactory:      params.SignerFactory,
+		kek:                kek,
+		clock:              clock,
+		logger:             logger,
+		metrics:            params.Metrics,
+		tracer:             tracerProvider.Tracer(tracing.InstrumentationName),
+		deviceLimit:        params.DeviceLimit,
+		tenantDeviceLimits: params.TenantDeviceLimits,
+		signatureLimiter:   params.SignatureLimiter,
+	}
+}
+
+// owns reports whether the principal may access a resource of the given owner.
+func owns(principal *domain.Principal, owner string) bool {
+	return principal == nil || principal.AnyOwner || principal.Owner == owner
+}
+
+// ownerOf returns the owner recorded on resources created by the principal.
+func ownerOf(principal *domain.Principal) string {
+	if principal == nil {
+		return ""
+	}
+	return principal.Owner
+}
+
+// principalIDOf returns the ID of the principal, empty when authentication
+// is disabled.
+func principalIDOf(principal *domain.Principal) string {
+	if principal == nil {
+		return ""
+	}
+	return principal.ID
+}
+
+// terminalOf returns the client certificate identity the principal called from.
+func terminalOf(principal *domain.Principal) string {
+	if principal == nil {
+		return ""
+	}
+	return principal.Terminal
+}
+
+// authorizeTenant rejects principals bound to a tenant other than tenantID.
+func authorizeTenant(principal *domain.Principal, tenantID string) error {
+	if principal != nil && principal.Tenant != "" && principal.Tenant != tenantID {
+		return utils.ErrTenantAccessDenied
+	}
+	return nil
+}
+
+// getOwnedDevice loads a device of the tenant and hides it from principals that
+// don't own it.
+func (s *signatureService) getOwnedDevice(ctx context.Context, principal *domain.Principal, tenantID, deviceId string) (*domain.SignatureDevice, error) {
+	if err := authorizeTenant(principal, tenantID); err != nil {
+		return nil, err
+	}
+	device, err := tracing.Call(ctx, s.tracer, "repository.GetDevice", func(ctx context.Context) (*domain.SignatureDevice, error) {
+		return s.repo.GetDevice(ctx, tenantID, deviceId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !owns(principal, device.Owner) {
+		return nil, utils.ErrDeviceNotFound
+	}
+	return device, nil
+}
+
+func (s *signatureService) GetSignatureDevice(ctx context.Context, principal *domain.Principal, tenantID, deviceId string) (*domain.SignatureDevice, error) {
+	return s.getOwnedDevice(ctx, principal, tenantID, deviceId)
+}
+
+// deviceLimitOf returns the maximum number of devices of the tenant, or zero
+// if the tenant is unlimited.
+func (s *signatureService) deviceLimitOf(tenantID string) int {
+	if limit, exists := s.tenantDeviceLimits[tenantID]; exists {
+		return limit
+	}
+	return s.deviceLimit
+}
+
+// checkDeviceLimit fails once the tenant has reached its device limit.
+func (s *signatureService) checkDeviceLimit(ctx context.Context, tenantID string) error {
+	limit := s.deviceLimitOf(tenantID)
+	if limit <= 0 {
+		return nil
+	}
+	count, err := tracing.Call(ctx, s.tracer, "repository.CountDevices", func(ctx context.Context) (int, error) {
+		return s.repo.CountDevices(ctx, tenantID)
+	})
+	if err != nil {
+		return err
+	}
+	if count >= limit {
+		return utils.ErrTenantDeviceLimit
+	}
+	return nil
+}
+
+// keyPairFor returns the key pair of a new device, either imported from the
+// request or freshly generated.
+func (s *signatureService) keyPairFor(ctx context.Context, request *domain.SignatureDeviceRequest) ([]byte, []byte, error) {
+	switch {
+	case request.PrivateKey != nil:
+		return s.importKeyPair(ctx, request.Algorithm, []byte(*request.PrivateKey))
+	case request.WrappedPrivateKey != nil:
+		privateKey, err := tracing.Call(ctx, s.tracer, "crypto.DecryptAES", func(context.Context) (string, error) {
+			return crypto.DecryptAES(*request.WrappedPrivateKey, s.kek)
+		})
+		if err != nil {
+			return nil, nil, utils.ErrInvalidPrivateKey
+		}
+		return s.importKeyPair(ctx, request.Algorithm, []byte(privateKey))
+	default:
+		return s.generateKeyPair(ctx, request.Algorithm)
+	}
 }
 
-func (s *signatureService) GetSignatureDevice(deviceId string) (*domain.SignatureDevice, error) {
-	return s.repo.GetDevice(deviceId)
+// generateKeyPair generates a new key pair, recording how long it took.
+func (s *signatureService) generateKeyPair(ctx context.Context, algorithm string) (publicKey, privateKey []byte, err error) {
+	_, span := s.tracer.Start(ctx, "crypto.GenerateKeyPair", trace.WithAttributes(attribute.String("device.algorithm", algorithm)))
+	defer tracing.End(span, &err)
+	defer s.metrics.ObserveKeyGeneration(algorithm, time.Now())
+	return s.keyPairFactory.GenerateKeyPair(ctx, algorithm)
 }
 
-func (s *signatureService) CreateSignatureDevice(request *domain.SignatureDeviceRequest) (*domain.SignatureDevice, error) {
-	publicKey, privateKey, err := s.keyPairFactory.GenerateKeyPair(request.Algorithm)
+// importKeyPair parses an imported private key and derives its public key.
+func (s *signatureService) importKeyPair(ctx context.Context, algorithm string, privateKeyPEM []byte) (publicKey, privateKey []byte, err error) {
+	_, span := s.tracer.Start(ctx, "crypto.ImportKeyPair", trace.WithAttributes(attribute.String("device.algorithm", algorithm)))
+	defer tracing.End(span, &err)
+	return s.keyPairFactory.ImportKeyPair(ctx, algorithm, privateKeyPEM)
+}
+
+func (s *signatureService) CreateSignatureDevice(ctx context.Context, principal *domain.Principal, tenantID string, request *domain.SignatureDeviceRequest) (_ *domain.SignatureDevice, err error) {
+	ctx, span := s.tracer.Start(ctx, "SignatureService.CreateSignatureDevice", trace.WithAttributes(
+		attribute.String("tenant.id", tenantID),
+		attribute.String("device.id", request.ID),
+		attribute.String("device.algorithm", request.Algorithm),
+	))
+	defer tracing.End(span, &err)
+	if err := authorizeTenant(principal, tenantID); err != nil {
+		return nil, err
+	}
+	if err := s.checkNotAfter(request); err != nil {
+		return nil, err
+	}
+	// Fail fast before generating keys, the limit is enforced again on insert.
+	if err := s.checkDeviceLimit(ctx, tenantID); err != nil {
+		return nil, err
+	}
+	publicKey, privateKey, err := s.keyPairFor(ctx, request)
 	if err != nil {
 		return nil, err
 	}
-	encryptedPrivateKey, err := crypto.EncryptAES(privateKey, aesKey)
+	encryptedPrivateKey, err := tracing.Call(ctx, s.tracer, "crypto.EncryptAES", func(context.Context) (string, error) {
+		return crypto.EncryptAES(privateKey, s.kek)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -53,38 +304,373 @@ func (s *signatureService) CreateSignatureDevice(request *domain.SignatureDevice
 	if request.Label != nil {
 		label = *request.Label
 	}
-	return s.repo.CreateDevice(request.ID, request.Algorithm, string(publicKey), encryptedPrivateKey, label)
+	device := &domain.SignatureDevice{
+		ID:            request.ID,
+		TenantID:      tenantID,
+		Algorithm:     request.Algorithm,
+		Label:         label,
+		Metadata:      request.Metadata,
+		Owner:         ownerOf(principal),
+		Terminal:      terminalOf(principal),
+		PublicKey:     string(publicKey),
+		PrivateKey:    encryptedPrivateKey,
+		MaxSignatures: request.MaxSignatures,
+		NotAfter:      request.NotAfter,
+	}
+	created, err := s.createDevice(ctx, tenantID, device)
+	if err != nil {
+		return nil, err
+	}
+	s.metrics.DeviceCreated(created.Algorithm)
+	s.logger.Info("device created", "tenant", tenantID, "device_id", created.ID, "algorithm", created.Algorithm,
+		"imported_key", request.PrivateKey != nil || request.WrappedPrivateKey != nil)
+	return created, nil
+}
+
+// createDevice stores the device, enforcing the device limit of the tenant.
+func (s *signatureService) createDevice(ctx context.Context, tenantID string, device *domain.SignatureDevice) (*domain.SignatureDevice, error) {
+	if s.deviceLimitOf(tenantID) > 0 {
+		s.createMu.Lock()
+		defer s.createMu.Unlock()
+		if err := s.checkDeviceLimit(ctx, tenantID); err != nil {
+			return nil, err
+		}
+	}
+	return tracing.Call(ctx, s.tracer, "repository.CreateDevice", func(ctx context.Context) (*domain.SignatureDevice, error) {
+		return s.repo.CreateDevice(ctx, device)
+	})
+}
+
+// checkNotAfter rejects devices that would be created already expired.
+func (s *signatureService) checkNotAfter(request *domain.SignatureDeviceRequest) error {
+	if request.NotAfter != nil && !request.NotAfter.After(s.clock.Now()) {
+		return utils.ErrInvalidNotAfter
+	}
+	return nil
 }
 
-func (s *signatureService) SignTransaction(deviceId, data string) (*domain.SignTransactionResponse, error) {
+// CreateSignatureDeviceAsync registers a pending job and creates the device on the
+// worker pool. Errors that can be detected upfront are returned immediately, any
+// later failure is recorded on the job.
+func (s *signatureService) CreateSignatureDeviceAsync(ctx context.Context, principal *domain.Principal, tenantID string, request *domain.SignatureDeviceRequest) (*domain.Job, error) {
+	if err := authorizeTenant(principal, tenantID); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetDevice(ctx, tenantID, request.ID); err == nil {
+		return nil, utils.ErrDeviceAlreadyExists
+	}
+	if err := s.checkNotAfter(request); err != nil {
+		return nil, err
+	}
+	if err := s.checkDeviceLimit(ctx, tenantID); err != nil {
+		return nil, err
+	}
+	jobId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	job, err := s.jobs.CreateJob(ctx, jobId.String(), tenantID, ownerOf(principal))
+	if err != nil {
+		return nil, err
+	}
+	deviceRequest := *request
+	// The job outlives the request, it keeps the values of ctx, such as the
+	// trace, but not its cancellation.
+	jobCtx := context.WithoutCancel(ctx)
+	err = s.workerPool.Submit(func() {
+		device, err := s.CreateSignatureDevice(jobCtx, principal, tenantID, &deviceRequest)
+		if err != nil {
+			s.logger.Warn("device creation job failed", "tenant", tenantID, "job_id", job.ID, "device_id", deviceRequest.ID, "error", err)
+			s.jobs.FailJob(jobCtx, job.ID, jobError(err))
+			return
+		}
+		s.jobs.CompleteJob(jobCtx, job.ID, device)
+	})
+	if err != nil {
+		s.jobs.FailJob(ctx, job.ID, jobError(err))
+		return nil, err
+	}
+	return job, nil
+}
+
+// jobError is the reason recorded on a failed job, which its owner can read.
+// Only the messages of service errors are recorded; internal errors, whose
+// details are logged, are reported as such.
+func jobError(err error) string {
+	var known *utils.Error
+	if errors.As(err, &known) && known.Kind != utils.KindInternal {
+		return known.Message
+	}
+	return "internal error"
+}
+
+func (s *signatureService) GetJob(ctx context.Context, principal *domain.Principal, tenantID, jobId string) (*domain.Job, error) {
+	if err := authorizeTenant(principal, tenantID); err != nil {
+		return nil, err
+	}
+	job, err := s.jobs.GetJob(ctx, jobId)
+	if err != nil {
+		return nil, err
+	}
+	if job.TenantID != tenantID || !owns(principal, job.Owner) {
+		return nil, utils.ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (s *signatureService) SignTransaction(ctx context.Context, principal *domain.Principal, tenantID, deviceId, data string) (response *domain.SignTransactionResponse, err error) {
+	ctx, span := s.tracer.Start(ctx, "SignatureService.SignTransaction", trace.WithAttributes(
+		attribute.String("tenant.id", tenantID),
+		attribute.String("device.id", deviceId),
+	))
+	defer tracing.End(span, &err)
+	// The algorithm is unknown until the device is found.
+	algorithm := metrics.AlgorithmUnknown
+	defer func() { s.metrics.Signature(algorithm, err) }()
 	dataSlice := strings.Split(data, "_")
-	device, err := s.repo.GetDevice(deviceId)
+	device, err := s.getOwnedDevice(ctx, principal, tenantID, deviceId)
 	if err != nil {
 		return nil, err
 	}
+	algorithm = device.Algorithm
+	span.SetAttributes(attribute.String("device.algorithm", algorithm))
+	// Devices created from a terminal can only sign from that terminal.
+	if principal != nil && device.Terminal != "" && device.Terminal != principal.Terminal {
+		return nil, utils.ErrDeviceBoundToTerminal
+	}
+	// Only callers that may sign with the device spend its tokens, others
+	// can't exhaust them.
+	if s.signatureLimiter != nil {
+		if allowed, retryAfter := s.signatureLimiter.AllowSignature(tenantID, deviceId); !allowed {
+			return nil, &utils.RateLimitedError{RetryAfter: retryAfter}
+		}
+	}
+	if err := s.checkSigning(device); err != nil {
+		return nil, err
+	}
 	if fmt.Sprint(device.SignatureCounter) != dataSlice[0] {
 		return nil, utils.ErrInvalidSignatureCounter
 	}
 	if device.LastSignature != dataSlice[2] {
 		return nil, utils.ErrInvalidLastSignature
 	}
-	decryptedPrivateKey, err := crypto.DecryptAES(device.PrivateKey, aesKey)
+	encodedSignature, err := s.sign(ctx, device, []byte(dataSlice[1]))
 	if err != nil {
+		s.logger.Error("signing failed", "tenant", tenantID, "device_id", deviceId, "error", err)
 		return nil, err
 	}
-	signer, err := s.signerFactory.GetSigner(device.Algorithm, []byte(decryptedPrivateKey))
+	// A signature is only handed out once it is stored, or the next one would
+	// reuse its counter. Once made it is stored even if the caller has gone.
+	// The repository repeats the checks above atomically with the update, so
+	// concurrent signatures, status changes and quotas can't fork the chain.
+	_, err = tracing.Call(context.WithoutCancel(ctx), s.tracer, "repository.UpdateDevice", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.repo.UpdateDevice(ctx, tenantID, deviceId, device.SignatureCounter, encodedSignature)
+	})
 	if err != nil {
+		s.logger.Error("storing signature failed", "tenant", tenantID, "device_id", deviceId, "error", err)
 		return nil, err
 	}
-	signature, err := signer.Sign([]byte(dataSlice[1]))
+	s.logger.Debug("transaction signed", "tenant", tenantID, "device_id", deviceId, "signature_counter", device.SignatureCounter)
+	return &domain.SignTransactionResponse{Signature: encodedSignature, SignedData: data}, nil
+}
+
+// checkSigning checks that the device may sign: it must be active, not
+// expired and have signatures left.
+func (s *signatureService) checkSigning(device *domain.SignatureDevice) error {
+	if device.Status != utils.DeviceStatusActive {
+		return utils.ErrDeviceNotActive
+	}
+	if device.NotAfter != nil && !s.clock.Now().Before(*device.NotAfter) {
+		return utils.ErrDeviceExpired
+	}
+	if remaining := device.RemainingSignatures(); remaining != nil && *remaining == 0 {
+		return utils.ErrSignatureQuotaExhausted
+	}
+	return nil
+}
+
+// sign signs data with the current private key of the device and returns the
+// base64 encoded signature. Decrypting the key, parsing it and signing are
+// traced as separate spans.
+func (s *signatureService) sign(ctx context.Context, device *domain.SignatureDevice, data []byte) (string, error) {
+	decryptedPrivateKey, err := tracing.Call(ctx, s.tracer, "crypto.DecryptAES", func(context.Context) (string, error) {
+		defer s.metrics.ObserveDecryption(time.Now())
+		return crypto.DecryptAES(device.PrivateKey, s.kek)
+	})
+	if err != nil {
+		return "", err
+	}
+	signer, err := tracing.Call(ctx, s.tracer, "crypto.ParsePrivateKey", func(ctx context.Context) (crypto.Signer, error) {
+		return s.signerFactory.GetSigner(ctx, device.Algorithm, []byte(decryptedPrivateKey))
+	})
+	if err != nil {
+		return "", err
+	}
+	signature, err := tracing.Call(ctx, s.tracer, "crypto.Sign", func(context.Context) ([]byte, error) {
+		defer s.metrics.ObserveSigning(device.Algorithm, time.Now())
+		return signer.Sign(data)
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// VerifySignature checks a base64 encoded signature of the device against the
+// signed data it was returned with, first with the current key of the device
+// and then with its retired keys. Transactions sign the data part of the
+// signed data and key rotations the whole record, so both are tried.
+func (s *signatureService) VerifySignature(ctx context.Context, principal *domain.Principal, tenantID, deviceId, signedData, signature string) (_ *domain.SignatureVerification, err error) {
+	ctx, span := s.tracer.Start(ctx, "SignatureService.VerifySignature", trace.WithAttributes(
+		attribute.String("tenant.id", tenantID),
+		attribute.String("device.id", deviceId),
+	))
+	defer tracing.End(span, &err)
+	dataSlice := strings.Split(signedData, "_")
+	if len(dataSlice) != 3 {
+		return nil, utils.ErrInvalidData
+	}
+	decodedSignature, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, utils.ErrInvalidSignature
+	}
+	device, err := s.getOwnedDevice(ctx, principal, tenantID, deviceId)
 	if err != nil {
 		return nil, err
 	}
-	encodedSignature := base64.StdEncoding.EncodeToString(signature)
-	s.repo.UpdateDevice(deviceId, encodedSignature)
-	return &domain.SignTransactionResponse{Signature: encodedSignature, SignedData: data}, nil
+	keys := append(slices.Clone(device.KeyHistory), domain.DeviceKey{Version: device.KeyVersion, PublicKey: device.PublicKey})
+	slices.Reverse(keys)
+	for _, key := range keys {
+		for _, payload := range []string{dataSlice[1], signedData} {
+			valid, err := crypto.Verify(device.Algorithm, []byte(key.PublicKey), []byte(payload), decodedSignature)
+			if err != nil {
+				return nil, err
+			}
+			if valid {
+				return &domain.SignatureVerification{Valid: true, KeyVersion: key.Version}, nil
+			}
+		}
+	}
+	return &domain.SignatureVerification{Valid: false}, nil
 }
 
-func (s *signatureService) ListSignatureDevices() ([]*domain.SignatureDevice, error) {
-	return s.repo.ListDevices()
+// RotateDeviceKey generates a new key pair for an active device. The rotation
+// record, made of the key version and the fingerprints of the old and new
+// public keys, takes the next position in the signature chain and is signed
+// with the old key, so verifiers can follow the chain across the rotation.
+func (s *signatureService) RotateDeviceKey(ctx context.Context, principal *domain.Principal, tenantID, deviceId string) (*domain.KeyRotation, error) {
+	device, err := s.getOwnedDevice(ctx, principal, tenantID, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	// The rotation record takes a position in the signature chain, so it
+	// counts against the quota like any signature.
+	if err := s.checkSigning(device); err != nil {
+		return nil, err
+	}
+	publicKey, privateKey, err := s.generateKeyPair(ctx, device.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	encryptedPrivateKey, err := crypto.EncryptAES(privateKey, s.kek)
+	if err != nil {
+		return nil, err
+	}
+	keyVersion := device.KeyVersion + 1
+	record := fmt.Sprintf("key-rotation:%d:%s:%s",
+		keyVersion,
+		crypto.PublicKeyFingerprint([]byte(device.PublicKey)),
+		crypto.PublicKeyFingerprint(publicKey),
+	)
+	signedData := fmt.Sprintf("%d_%s_%s", device.SignatureCounter, record, device.LastSignature)
+	signature, err := s.sign(ctx, device, []byte(signedData))
+	if err != nil {
+		s.logger.Error("signing key rotation failed", "tenant", tenantID, "device_id", deviceId, "error", err)
+		return nil, err
+	}
+	previousPublicKey := device.PublicKey
+	// Like a signature, the rotation is only stored if the device didn't sign
+	// or rotate in the meantime, which would fork the chain, and is still
+	// allowed to sign. The key pair is generated without holding a lock, so
+	// concurrent rotations race and all but the first fail with a conflict.
+	if err := s.repo.RotateDeviceKey(ctx, tenantID, deviceId, device.SignatureCounter, string(publicKey), encryptedPrivateKey, signature); err != nil {
+		return nil, err
+	}
+	s.logger.Info("device key rotated", "tenant", tenantID, "device_id", deviceId, "key_version", keyVersion)
+	return &domain.KeyRotation{
+		DeviceID:          deviceId,
+		KeyVersion:        keyVersion,
+		PreviousPublicKey: previousPublicKey,
+		PublicKey:         string(publicKey),
+		Signature:         signature,
+		SignedData:        signedData,
+	}, nil
+}
+
+// UpdateSignatureDevice changes the lifecycle status, label and metadata of a
+// device. Setting the current status again is a no-op. Metadata is merged into
+// the existing metadata, keys set to nil are removed. Nothing is changed if
+// any part of the update is invalid.
+func (s *signatureService) UpdateSignatureDevice(ctx context.Context, principal *domain.Principal, tenantID, deviceId string, request *domain.UpdateSignatureDeviceRequest) (*domain.SignatureDevice, error) {
+	if request.Status != nil && !slices.Contains(utils.DeviceStatuses, *request.Status) {
+		return nil, utils.ErrInvalidDeviceStatus
+	}
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	device, err := s.getOwnedDevice(ctx, principal, tenantID, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	status := device.Status
+	if request.Status != nil && *request.Status != status && !slices.Contains(deviceStatusTransitions[status], *request.Status) {
+		return nil, utils.ErrInvalidStatusTransition
+	}
+	label := device.Label
+	if request.Label != nil {
+		label = *request.Label
+	}
+	metadata := mergeMetadata(device.Metadata, request.Metadata)
+	if len(metadata) > utils.MaxMetadataEntries {
+		return nil, utils.ErrMetadataLimit
+	}
+	newStatus := status
+	if request.Status != nil {
+		newStatus = *request.Status
+	}
+	if err := s.repo.UpdateDeviceDetails(ctx, tenantID, deviceId, newStatus, label, metadata); err != nil {
+		return nil, err
+	}
+	if newStatus != status {
+		s.logger.Info("device status changed", "tenant", tenantID, "device_id", deviceId, "from", status, "to", newStatus)
+	}
+	return s.repo.GetDevice(ctx, tenantID, deviceId)
+}
+
+// mergeMetadata returns a copy of metadata with the patch applied, removing
+// the keys set to nil.
+func mergeMetadata(metadata map[string]string, patch map[string]*string) map[string]string {
+	merged := maps.Clone(metadata)
+	if merged == nil {
+		merged = make(map[string]string, len(patch))
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = *value
+	}
+	return merged
+}
+
+// ListSignatureDevices returns a page of the devices of the tenant visible to
+// the principal that match the query.
+func (s *signatureService) ListSignatureDevices(ctx context.Context, principal *domain.Principal, tenantID string, query domain.DeviceQuery) (*domain.DevicePage, error) {
+	if err := authorizeTenant(principal, tenantID); err != nil {
+		return nil, err
+	}
+	if principal != nil && !principal.AnyOwner {
+		query.Owner = &principal.Owner
+	}
+	return s.repo.QueryDevices(ctx, tenantID, query)
 }
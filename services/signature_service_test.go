@@ -1,9 +1,22 @@
 package services
 
 import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/uwemakan/signing-service/crypto"
@@ -16,27 +29,27 @@ func TestGetSignatureDevice(t *testing.T) {
 	requires := require.New(t)
 
 	service := NewSignatureService(SignatureServiceParams{
-		Repo:           persistence.NewInMemorySignatureDeviceRepository(),
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
 		KeyPairFactory: crypto.NewKeyPairFactory(),
 		SignerFactory:  crypto.NewSignerFactory(),
 	})
 
 	deviceId := utils.RandomString(16)
-	device, err := service.GetSignatureDevice(deviceId)
+	device, err := service.GetSignatureDevice(context.Background(), nil, utils.DefaultTenant, deviceId)
 	requires.Error(err)
 	requires.ErrorIs(err, utils.ErrDeviceNotFound)
 	requires.Nil(device)
 
 	algorithm := utils.Algorithms[0]
 	label := utils.RandomString(8)
-	device, err = service.CreateSignatureDevice(&domain.SignatureDeviceRequest{
+	device, err = service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
 		ID:        deviceId,
 		Algorithm: algorithm,
 		Label:     &label,
 	})
 	requires.NoError(err)
 	requires.NotNil(device)
-	d, err := service.GetSignatureDevice(deviceId)
+	d, err := service.GetSignatureDevice(context.Background(), nil, utils.DefaultTenant, deviceId)
 	requires.NoError(err)
 	requires.Equal(device, d)
 }
@@ -45,29 +58,69 @@ func TestListSignatureDevices(t *testing.T) {
 	requires := require.New(t)
 
 	service := NewSignatureService(SignatureServiceParams{
-		Repo:           persistence.NewInMemorySignatureDeviceRepository(),
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
 		KeyPairFactory: crypto.NewKeyPairFactory(),
 		SignerFactory:  crypto.NewSignerFactory(),
 	})
 
-	devices, err := service.ListSignatureDevices()
+	page, err := service.ListSignatureDevices(context.Background(), nil, utils.DefaultTenant, domain.DeviceQuery{})
 	requires.NoError(err)
-	requires.Len(devices, 0)
+	requires.Len(page.Devices, 0)
 
 	deviceId := utils.RandomString(16)
 	algorithm := utils.Algorithms[0]
 	label := utils.RandomString(8)
-	device, err := service.CreateSignatureDevice(&domain.SignatureDeviceRequest{
+	device, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
 		ID:        deviceId,
 		Algorithm: algorithm,
 		Label:     &label,
 	})
 	requires.NoError(err)
 	requires.NotNil(device)
-	devices, err = service.ListSignatureDevices()
+	page, err = service.ListSignatureDevices(context.Background(), nil, utils.DefaultTenant, domain.DeviceQuery{})
 	requires.NoError(err)
-	requires.Len(devices, 1)
-	requires.Equal(device, devices[0])
+	requires.Len(page.Devices, 1)
+	requires.Equal(device, page.Devices[0])
+}
+
+func TestListSignatureDevicesQuery(t *testing.T) {
+	requires := require.New(t)
+
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	})
+	owner := &domain.Principal{ID: utils.RandomString(8), Owner: utils.RandomString(8)}
+	other := &domain.Principal{ID: utils.RandomString(8), Owner: utils.RandomString(8)}
+	for _, principal := range []*domain.Principal{owner, owner, other} {
+		_, err := service.CreateSignatureDevice(context.Background(), principal, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+			ID:        utils.RandomString(16),
+			Algorithm: utils.Algorithms[1],
+		})
+		requires.NoError(err)
+	}
+
+	page, err := service.ListSignatureDevices(context.Background(), owner, utils.DefaultTenant, domain.DeviceQuery{Limit: 1})
+	requires.NoError(err)
+	requires.Len(page.Devices, 1)
+	requires.NotEmpty(page.NextCursor)
+	page, err = service.ListSignatureDevices(context.Background(), owner, utils.DefaultTenant, domain.DeviceQuery{Limit: 1, Cursor: page.NextCursor})
+	requires.NoError(err)
+	requires.Len(page.Devices, 1)
+	requires.Equal(owner.Owner, page.Devices[0].Owner)
+	requires.Empty(page.NextCursor)
+
+	// A principal cannot list the devices of another owner.
+	page, err = service.ListSignatureDevices(context.Background(), owner, utils.DefaultTenant, domain.DeviceQuery{Owner: &other.Owner})
+	requires.NoError(err)
+	requires.Len(page.Devices, 2)
+	for _, device := range page.Devices {
+		requires.Equal(owner.Owner, device.Owner)
+	}
+	page, err = service.ListSignatureDevices(context.Background(), nil, utils.DefaultTenant, domain.DeviceQuery{})
+	requires.NoError(err)
+	requires.Len(page.Devices, 3)
 }
 
 func TestCreateSignatureDevice(t *testing.T) {
@@ -108,7 +161,7 @@ func TestCreateSignatureDevice(t *testing.T) {
 				Label:     &label,
 			},
 			setup: func(ss SignatureService) {
-				ss.CreateSignatureDevice(&domain.SignatureDeviceRequest{
+				ss.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
 					ID:        deviceId,
 					Algorithm: algorithm,
 					Label:     &label,
@@ -138,12 +191,12 @@ func TestCreateSignatureDevice(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			service := NewSignatureService(SignatureServiceParams{
-				Repo:           persistence.NewInMemorySignatureDeviceRepository(),
+				Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
 				KeyPairFactory: crypto.NewKeyPairFactory(),
 				SignerFactory:  crypto.NewSignerFactory(),
 			})
 			tc.setup(service)
-			d, err := service.CreateSignatureDevice(tc.request)
+			d, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, tc.request)
 			tc.checkResponse(d, err)
 		})
 	}
@@ -168,7 +221,7 @@ func TestSignTransaction(t *testing.T) {
 			deviceId: deviceId,
 			data:     data,
 			setup: func(ss SignatureService) {
-				ss.CreateSignatureDevice(&domain.SignatureDeviceRequest{
+				ss.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
 					ID:        deviceId,
 					Algorithm: algorithm,
 					Label:     &label,
@@ -196,7 +249,7 @@ func TestSignTransaction(t *testing.T) {
 			deviceId: deviceId,
 			data:     fmt.Sprintf("1_TestData_%s", base64.StdEncoding.EncodeToString([]byte(deviceId))),
 			setup: func(ss SignatureService) {
-				ss.CreateSignatureDevice(&domain.SignatureDeviceRequest{
+				ss.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
 					ID:        deviceId,
 					Algorithm: algorithm,
 					Label:     &label,
@@ -213,7 +266,7 @@ func TestSignTransaction(t *testing.T) {
 			deviceId: deviceId,
 			data:     fmt.Sprintf("0_TestData_%s", utils.RandomString(16)),
 			setup: func(ss SignatureService) {
-				ss.CreateSignatureDevice(&domain.SignatureDeviceRequest{
+				ss.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
 					ID:        deviceId,
 					Algorithm: algorithm,
 					Label:     &label,
@@ -230,7 +283,7 @@ func TestSignTransaction(t *testing.T) {
 			deviceId: deviceId,
 			data:     fmt.Sprintf("0_TestData_%s", utils.RandomString(16)),
 			setup: func(ss SignatureService) {
-				ss.CreateSignatureDevice(&domain.SignatureDeviceRequest{
+				ss.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
 					ID:        deviceId,
 					Algorithm: algorithm,
 					Label:     &label,
@@ -246,13 +299,928 @@ func TestSignTransaction(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			service := NewSignatureService(SignatureServiceParams{
-				Repo:           persistence.NewInMemorySignatureDeviceRepository(),
+				Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
 				KeyPairFactory: crypto.NewKeyPairFactory(),
 				SignerFactory:  crypto.NewSignerFactory(),
 			})
 			tc.setup(service)
-			sr, err := service.SignTransaction(tc.deviceId, tc.data)
+			sr, err := service.SignTransaction(context.Background(), nil, utils.DefaultTenant, tc.deviceId, tc.data)
 			tc.checkResponse(sr, err)
 		})
 	}
 }
+
+func TestCreateSignatureDeviceAsync(t *testing.T) {
+	requires := require.New(t)
+
+	deviceId := utils.RandomString(16)
+	label := utils.RandomString(8)
+	testCases := []struct {
+		name          string
+		request       *domain.SignatureDeviceRequest
+		setup         func(SignatureService)
+		checkResponse func(SignatureService, *domain.Job, error)
+	}{
+		{
+			name: "CreateSignatureDeviceAsync_OK",
+			request: &domain.SignatureDeviceRequest{
+				ID:        deviceId,
+				Algorithm: utils.Algorithms[1],
+				Label:     &label,
+			},
+			setup: func(ss SignatureService) {},
+			checkResponse: func(ss SignatureService, job *domain.Job, err error) {
+				requires.NoError(err)
+				requires.NotNil(job)
+				requires.Equal(utils.JobStatusPending, job.Status)
+				requires.Eventually(func() bool {
+					j, err := ss.GetJob(context.Background(), nil, utils.DefaultTenant, job.ID)
+					return err == nil && j.Status == utils.JobStatusSucceeded
+				}, 10*time.Second, 10*time.Millisecond)
+				j, err := ss.GetJob(context.Background(), nil, utils.DefaultTenant, job.ID)
+				requires.NoError(err)
+				requires.NotNil(j.Device)
+				requires.Equal(deviceId, j.Device.ID)
+				requires.Equal(label, j.Device.Label)
+				d, err := ss.GetSignatureDevice(context.Background(), nil, utils.DefaultTenant, deviceId)
+				requires.NoError(err)
+				requires.Equal(d, j.Device)
+			},
+		},
+		{
+			name: "CreateSignatureDeviceAsync_Device_Exist",
+			request: &domain.SignatureDeviceRequest{
+				ID:        deviceId,
+				Algorithm: utils.Algorithms[1],
+			},
+			setup: func(ss SignatureService) {
+				ss.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+					ID:        deviceId,
+					Algorithm: utils.Algorithms[1],
+				})
+			},
+			checkResponse: func(ss SignatureService, job *domain.Job, err error) {
+				requires.Error(err)
+				requires.ErrorIs(err, utils.ErrDeviceAlreadyExists)
+				requires.Nil(job)
+			},
+		},
+		{
+			name: "CreateSignatureDeviceAsync_Unknown_Algorithm",
+			request: &domain.SignatureDeviceRequest{
+				ID:        deviceId,
+				Algorithm: "UNKNOWN",
+			},
+			setup: func(ss SignatureService) {},
+			checkResponse: func(ss SignatureService, job *domain.Job, err error) {
+				requires.NoError(err)
+				requires.NotNil(job)
+				requires.Eventually(func() bool {
+					j, err := ss.GetJob(context.Background(), nil, utils.DefaultTenant, job.ID)
+					return err == nil && j.Status == utils.JobStatusFailed
+				}, 10*time.Second, 10*time.Millisecond)
+				j, err := ss.GetJob(context.Background(), nil, utils.DefaultTenant, job.ID)
+				requires.NoError(err)
+				requires.Nil(j.Device)
+				requires.Equal(utils.ErrUnsupportedAlgorithm.Error(), j.Error)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := NewSignatureService(SignatureServiceParams{
+				Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+				Jobs:           persistence.NewInMemoryJobRepository(),
+				WorkerPool:     NewWorkerPool(1, 1),
+				KeyPairFactory: crypto.NewKeyPairFactory(),
+				SignerFactory:  crypto.NewSignerFactory(),
+			})
+			tc.setup(service)
+			job, err := service.CreateSignatureDeviceAsync(context.Background(), nil, utils.DefaultTenant, tc.request)
+			tc.checkResponse(service, job, err)
+		})
+	}
+}
+
+func TestGetJob(t *testing.T) {
+	requires := require.New(t)
+
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	})
+
+	job, err := service.GetJob(context.Background(), nil, utils.DefaultTenant, utils.RandomString(16))
+	requires.Error(err)
+	requires.ErrorIs(err, utils.ErrJobNotFound)
+	requires.Nil(job)
+}
+
+func TestJobError(t *testing.T) {
+	requires := require.New(t)
+
+	requires.Equal(utils.ErrUnsupportedAlgorithm.Error(), jobError(fmt.Errorf("creating device: %w", utils.ErrUnsupportedAlgorithm)))
+	requires.Equal("internal error", jobError(fmt.Errorf("decrypting key: %w", utils.ErrInvalidCiphertext)))
+	requires.Equal("internal error", jobError(errors.New("entropy source failed")))
+}
+
+func TestWorkerPoolSubmit(t *testing.T) {
+	requires := require.New(t)
+	pool := NewWorkerPool(1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	requires.NoError(pool.Submit(func() {
+		close(started)
+		<-release
+	}))
+	<-started
+	requires.NoError(pool.Submit(func() {}))
+	err := pool.Submit(func() {})
+	requires.Error(err)
+	requires.ErrorIs(err, utils.ErrJobQueueFull)
+	close(release)
+}
+
+func TestWorkerPoolShutdown(t *testing.T) {
+	requires := require.New(t)
+	pool := NewWorkerPool(1, 2)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	ran := 0
+
+	requires.NoError(pool.Submit(func() {
+		close(started)
+		<-release
+	}))
+	<-started
+	requires.NoError(pool.Submit(func() { ran++ }))
+
+	// Shutting down waits for the queued tasks, up to the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	requires.ErrorIs(pool.Shutdown(ctx), context.DeadlineExceeded)
+	requires.ErrorIs(pool.Submit(func() {}), utils.ErrShuttingDown)
+	close(release)
+	requires.NoError(pool.Shutdown(context.Background()))
+	requires.Equal(1, ran)
+}
+
+func TestDeviceOwnership(t *testing.T) {
+	requires := require.New(t)
+
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	})
+	owner := &domain.Principal{ID: utils.RandomString(8), Owner: utils.RandomString(8)}
+	other := &domain.Principal{ID: utils.RandomString(8), Owner: utils.RandomString(8)}
+
+	deviceId := utils.RandomString(16)
+	device, err := service.CreateSignatureDevice(context.Background(), owner, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.NoError(err)
+	requires.Equal(owner.Owner, device.Owner)
+
+	d, err := service.GetSignatureDevice(context.Background(), owner, utils.DefaultTenant, deviceId)
+	requires.NoError(err)
+	requires.Equal(device, d)
+	d, err = service.GetSignatureDevice(context.Background(), other, utils.DefaultTenant, deviceId)
+	requires.ErrorIs(err, utils.ErrDeviceNotFound)
+	requires.Nil(d)
+
+	page, err := service.ListSignatureDevices(context.Background(), owner, utils.DefaultTenant, domain.DeviceQuery{})
+	requires.NoError(err)
+	requires.Len(page.Devices, 1)
+	page, err = service.ListSignatureDevices(context.Background(), other, utils.DefaultTenant, domain.DeviceQuery{})
+	requires.NoError(err)
+	requires.Empty(page.Devices)
+
+	data := fmt.Sprintf("0_TestData_%s", base64.StdEncoding.EncodeToString([]byte(deviceId)))
+	sr, err := service.SignTransaction(context.Background(), other, utils.DefaultTenant, deviceId, data)
+	requires.ErrorIs(err, utils.ErrDeviceNotFound)
+	requires.Nil(sr)
+	sr, err = service.SignTransaction(context.Background(), owner, utils.DefaultTenant, deviceId, data)
+	requires.NoError(err)
+	requires.NotNil(sr)
+
+	job, err := service.CreateSignatureDeviceAsync(context.Background(), owner, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        utils.RandomString(16),
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.NoError(err)
+	j, err := service.GetJob(context.Background(), other, utils.DefaultTenant, job.ID)
+	requires.ErrorIs(err, utils.ErrJobNotFound)
+	requires.Nil(j)
+	j, err = service.GetJob(context.Background(), owner, utils.DefaultTenant, job.ID)
+	requires.NoError(err)
+	requires.NotNil(j)
+}
+
+func TestTerminalBinding(t *testing.T) {
+	requires := require.New(t)
+
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	})
+	owner := utils.RandomString(8)
+	terminal := &domain.Principal{ID: utils.RandomString(8), Owner: owner, Terminal: "CN=terminal-1"}
+	otherTerminal := &domain.Principal{ID: terminal.ID, Owner: owner, Terminal: "CN=terminal-2"}
+	noTerminal := &domain.Principal{ID: terminal.ID, Owner: owner}
+
+	deviceId := utils.RandomString(16)
+	device, err := service.CreateSignatureDevice(context.Background(), terminal, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.NoError(err)
+	requires.Equal(terminal.Terminal, device.Terminal)
+
+	data := fmt.Sprintf("0_TestData_%s", base64.StdEncoding.EncodeToString([]byte(deviceId)))
+	for _, principal := range []*domain.Principal{otherTerminal, noTerminal} {
+		sr, err := service.SignTransaction(context.Background(), principal, utils.DefaultTenant, deviceId, data)
+		requires.ErrorIs(err, utils.ErrDeviceBoundToTerminal)
+		requires.Nil(sr)
+	}
+	sr, err := service.SignTransaction(context.Background(), terminal, utils.DefaultTenant, deviceId, data)
+	requires.NoError(err)
+	requires.NotNil(sr)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	requires := require.New(t)
+
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	})
+	owner := utils.RandomString(8)
+	tenantA := &domain.Principal{ID: utils.RandomString(8), Owner: owner, Tenant: "tenant-a"}
+	tenantB := &domain.Principal{ID: utils.RandomString(8), Owner: owner, Tenant: "tenant-b"}
+	unbound := &domain.Principal{ID: utils.RandomString(8), Owner: owner}
+
+	deviceId := utils.RandomString(16)
+	request := &domain.SignatureDeviceRequest{ID: deviceId, Algorithm: utils.Algorithms[1]}
+	device, err := service.CreateSignatureDevice(context.Background(), tenantA, "tenant-a", request)
+	requires.NoError(err)
+	requires.Equal("tenant-a", device.TenantID)
+
+	_, err = service.CreateSignatureDevice(context.Background(), tenantA, "tenant-b", request)
+	requires.ErrorIs(err, utils.ErrTenantAccessDenied)
+	_, err = service.GetSignatureDevice(context.Background(), tenantB, "tenant-a", deviceId)
+	requires.ErrorIs(err, utils.ErrTenantAccessDenied)
+	_, err = service.ListSignatureDevices(context.Background(), tenantB, "tenant-a", domain.DeviceQuery{})
+	requires.ErrorIs(err, utils.ErrTenantAccessDenied)
+	data := fmt.Sprintf("0_TestData_%s", base64.StdEncoding.EncodeToString([]byte(deviceId)))
+	_, err = service.SignTransaction(context.Background(), tenantB, "tenant-a", deviceId, data)
+	requires.ErrorIs(err, utils.ErrTenantAccessDenied)
+
+	_, err = service.GetSignatureDevice(context.Background(), tenantB, "tenant-b", deviceId)
+	requires.ErrorIs(err, utils.ErrDeviceNotFound)
+	_, err = service.SignTransaction(context.Background(), tenantB, "tenant-b", deviceId, data)
+	requires.ErrorIs(err, utils.ErrDeviceNotFound)
+
+	d, err := service.GetSignatureDevice(context.Background(), unbound, "tenant-a", deviceId)
+	requires.NoError(err)
+	requires.Equal(device, d)
+	page, err := service.ListSignatureDevices(context.Background(), unbound, utils.DefaultTenant, domain.DeviceQuery{})
+	requires.NoError(err)
+	requires.Empty(page.Devices)
+
+	job, err := service.CreateSignatureDeviceAsync(context.Background(), tenantA, "tenant-a", &domain.SignatureDeviceRequest{
+		ID:        utils.RandomString(16),
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.NoError(err)
+	_, err = service.GetJob(context.Background(), unbound, "tenant-b", job.ID)
+	requires.ErrorIs(err, utils.ErrJobNotFound)
+	_, err = service.GetJob(context.Background(), tenantA, "tenant-a", job.ID)
+	requires.NoError(err)
+}
+
+func TestTenantDeviceLimit(t *testing.T) {
+	requires := require.New(t)
+
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:               persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory:     crypto.NewKeyPairFactory(),
+		SignerFactory:      crypto.NewSignerFactory(),
+		DeviceLimit:        2,
+		TenantDeviceLimits: map[string]int{"tenant-a": 1, "tenant-b": 0},
+	})
+	create := func(tenantID string) error {
+		_, err := service.CreateSignatureDevice(context.Background(), nil, tenantID, &domain.SignatureDeviceRequest{
+			ID:        utils.RandomString(16),
+			Algorithm: utils.Algorithms[1],
+		})
+		return err
+	}
+
+	requires.NoError(create("tenant-a"))
+	requires.ErrorIs(create("tenant-a"), utils.ErrTenantDeviceLimit)
+	_, err := service.CreateSignatureDeviceAsync(context.Background(), nil, "tenant-a", &domain.SignatureDeviceRequest{
+		ID:        utils.RandomString(16),
+		Algorithm: utils.Algorithms[1],
+	})
+	requires.ErrorIs(err, utils.ErrTenantDeviceLimit)
+
+	requires.NoError(create(utils.DefaultTenant))
+	requires.NoError(create(utils.DefaultTenant))
+	requires.ErrorIs(create(utils.DefaultTenant), utils.ErrTenantDeviceLimit)
+
+	for range 3 {
+		requires.NoError(create("tenant-b"))
+	}
+}
+
+// statusUpdate returns an update request that only changes the status.
+func statusUpdate(status string) *domain.UpdateSignatureDeviceRequest {
+	return &domain.UpdateSignatureDeviceRequest{Status: &status}
+}
+
+func TestUpdateSignatureDeviceStatus(t *testing.T) {
+	requires := require.New(t)
+
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	})
+	deviceId := utils.RandomString(16)
+	device, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: utils.Algorithms[0],
+	})
+	requires.NoError(err)
+	requires.Equal(utils.DeviceStatusActive, device.Status)
+	publicKey := device.PublicKey
+
+	data := fmt.Sprintf("0_TestData_%s", base64.StdEncoding.EncodeToString([]byte(deviceId)))
+	testCases := []struct {
+		name    string
+		status  string
+		err     error
+		signErr error
+	}{
+		{name: "Suspend", status: utils.DeviceStatusSuspended, signErr: utils.ErrDeviceNotActive},
+		{name: "Suspend_Again", status: utils.DeviceStatusSuspended, signErr: utils.ErrDeviceNotActive},
+		{name: "Reactivate", status: utils.DeviceStatusActive},
+		{name: "Invalid_Status", status: "retired", err: utils.ErrInvalidDeviceStatus},
+		{name: "Decommission", status: utils.DeviceStatusDecommissioned, signErr: utils.ErrDeviceNotActive},
+		{name: "Reactivate_Decommissioned", status: utils.DeviceStatusActive, err: utils.ErrInvalidStatusTransition, signErr: utils.ErrDeviceNotActive},
+		{name: "Suspend_Decommissioned", status: utils.DeviceStatusSuspended, err: utils.ErrInvalidStatusTransition, signErr: utils.ErrDeviceNotActive},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := service.UpdateSignatureDevice(context.Background(), nil, utils.DefaultTenant, deviceId, statusUpdate(tc.status))
+			if tc.err != nil {
+				requires.ErrorIs(err, tc.err)
+				requires.Nil(d)
+			} else {
+				requires.NoError(err)
+				requires.Equal(tc.status, d.Status)
+			}
+			// Only check the device state, a successful signature would
+			// advance the counter of the following cases.
+			if tc.signErr != nil {
+				sr, err := service.SignTransaction(context.Background(), nil, utils.DefaultTenant, deviceId, data)
+				requires.ErrorIs(err, tc.signErr)
+				requires.Nil(sr)
+			}
+		})
+	}
+
+	device, err = service.GetSignatureDevice(context.Background(), nil, utils.DefaultTenant, deviceId)
+	requires.NoError(err)
+	requires.Empty(device.PrivateKey)
+	requires.Equal(publicKey, device.PublicKey)
+
+	_, err = service.UpdateSignatureDevice(context.Background(), nil, utils.DefaultTenant, utils.RandomString(16), statusUpdate(utils.DeviceStatusSuspended))
+	requires.ErrorIs(err, utils.ErrDeviceNotFound)
+}
+
+func TestSignTransactionLimits(t *testing.T) {
+	requires := require.New(t)
+
+	clock := utils.NewFakeClock(time.Date(2024, time.June, 1, 9, 0, 0, 0, time.UTC))
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepositoryWithClock(clock, nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+		Clock:          clock,
+	})
+	maxSignatures := 2
+	notAfter := clock.Now().Add(8 * time.Hour)
+	sign := func(deviceId string) error {
+		device, err := service.GetSignatureDevice(context.Background(), nil, utils.DefaultTenant, deviceId)
+		requires.NoError(err)
+		data := fmt.Sprintf("%d_TestData_%s", device.SignatureCounter, device.LastSignature)
+		_, err = service.SignTransaction(context.Background(), nil, utils.DefaultTenant, deviceId, data)
+		return err
+	}
+
+	quota, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:            utils.RandomString(16),
+		Algorithm:     utils.Algorithms[1],
+		MaxSignatures: &maxSignatures,
+	})
+	requires.NoError(err)
+	requires.Equal(2, *quota.RemainingSignatures())
+	requires.NoError(sign(quota.ID))
+	requires.NoError(sign(quota.ID))
+	requires.ErrorIs(sign(quota.ID), utils.ErrSignatureQuotaExhausted)
+	quota, err = service.GetSignatureDevice(context.Background(), nil, utils.DefaultTenant, quota.ID)
+	requires.NoError(err)
+	requires.Equal(0, *quota.RemainingSignatures())
+	requires.Equal(2, quota.SignatureCounter)
+
+	expiring, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        utils.RandomString(16),
+		Algorithm: utils.Algorithms[1],
+		NotAfter:  &notAfter,
+	})
+	requires.NoError(err)
+	requires.Nil(expiring.RemainingSignatures())
+	clock.Advance(8*time.Hour - time.Second)
+	requires.NoError(sign(expiring.ID))
+	clock.Advance(time.Second)
+	requires.ErrorIs(sign(expiring.ID), utils.ErrDeviceExpired)
+
+	_, err = service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        utils.RandomString(16),
+		Algorithm: utils.Algorithms[1],
+		NotAfter:  &notAfter,
+	})
+	requires.ErrorIs(err, utils.ErrInvalidNotAfter)
+	_, err = service.CreateSignatureDeviceAsync(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        utils.RandomString(16),
+		Algorithm: utils.Algorithms[1],
+		NotAfter:  &notAfter,
+	})
+	requires.ErrorIs(err, utils.ErrInvalidNotAfter)
+}
+
+func TestRotateDeviceKey(t *testing.T) {
+	requires := require.New(t)
+
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	})
+	deviceId := utils.RandomString(16)
+	device, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: "RSA",
+	})
+	requires.NoError(err)
+	previousPublicKey := device.PublicKey
+	lastSignature := device.LastSignature
+
+	rotation, err := service.RotateDeviceKey(context.Background(), nil, utils.DefaultTenant, deviceId)
+	requires.NoError(err)
+	requires.Equal(2, rotation.KeyVersion)
+	requires.Equal(previousPublicKey, rotation.PreviousPublicKey)
+	requires.NotEqual(previousPublicKey, rotation.PublicKey)
+	requires.Equal(fmt.Sprintf("0_key-rotation:2:%s:%s_%s",
+		crypto.PublicKeyFingerprint([]byte(previousPublicKey)),
+		crypto.PublicKeyFingerprint([]byte(rotation.PublicKey)),
+		lastSignature,
+	), rotation.SignedData)
+
+	// The rotation record is signed with the previous key.
+	block, _ := pem.Decode([]byte(previousPublicKey))
+	publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	requires.NoError(err)
+	signature, err := base64.StdEncoding.DecodeString(rotation.Signature)
+	requires.NoError(err)
+	hashed := sha512.Sum512([]byte(rotation.SignedData))
+	requires.NoError(rsa.VerifyPKCS1v15(publicKey, stdcrypto.SHA512, hashed[:], signature))
+
+	device, err = service.GetSignatureDevice(context.Background(), nil, utils.DefaultTenant, deviceId)
+	requires.NoError(err)
+	requires.Equal(2, device.KeyVersion)
+	requires.Equal(rotation.PublicKey, device.PublicKey)
+	requires.Equal([]domain.DeviceKey{{Version: 1, PublicKey: previousPublicKey}}, device.KeyHistory)
+
+	// The chain continues from the rotation record.
+	sr, err := service.SignTransaction(context.Background(), nil, utils.DefaultTenant, deviceId, fmt.Sprintf("0_TestData_%s", rotation.Signature))
+	requires.ErrorIs(err, utils.ErrInvalidSignatureCounter)
+	requires.Nil(sr)
+	sr, err = service.SignTransaction(context.Background(), nil, utils.DefaultTenant, deviceId, fmt.Sprintf("1_TestData_%s", rotation.Signature))
+	requires.NoError(err)
+	requires.NotNil(sr)
+
+	_, err = service.UpdateSignatureDevice(context.Background(), nil, utils.DefaultTenant, deviceId, statusUpdate(utils.DeviceStatusSuspended))
+	requires.NoError(err)
+	rotation, err = service.RotateDeviceKey(context.Background(), nil, utils.DefaultTenant, deviceId)
+	requires.ErrorIs(err, utils.ErrDeviceNotActive)
+	requires.Nil(rotation)
+
+	rotation, err = service.RotateDeviceKey(context.Background(), nil, utils.DefaultTenant, utils.RandomString(16))
+	requires.ErrorIs(err, utils.ErrDeviceNotFound)
+	requires.Nil(rotation)
+
+	// A rotation counts against the quota of the device.
+	maxSignatures := 1
+	limitedId := utils.RandomString(16)
+	_, err = service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:            limitedId,
+		Algorithm:     "ECC",
+		MaxSignatures: &maxSignatures,
+	})
+	requires.NoError(err)
+	_, err = service.RotateDeviceKey(context.Background(), nil, utils.DefaultTenant, limitedId)
+	requires.NoError(err)
+	rotation, err = service.RotateDeviceKey(context.Background(), nil, utils.DefaultTenant, limitedId)
+	requires.ErrorIs(err, utils.ErrSignatureQuotaExhausted)
+	requires.Nil(rotation)
+}
+
+func TestVerifySignature(t *testing.T) {
+	for _, algorithm := range utils.Algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			requires := require.New(t)
+
+			service := NewSignatureService(SignatureServiceParams{
+				Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+				KeyPairFactory: crypto.NewKeyPairFactory(),
+				SignerFactory:  crypto.NewSignerFactory(),
+			})
+			deviceId := utils.RandomString(16)
+			device, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+				ID:        deviceId,
+				Algorithm: algorithm,
+			})
+			requires.NoError(err)
+			signed, err := service.SignTransaction(context.Background(), nil, utils.DefaultTenant, deviceId, fmt.Sprintf("0_TestData_%s", device.LastSignature))
+			requires.NoError(err)
+
+			verification, err := service.VerifySignature(context.Background(), nil, utils.DefaultTenant, deviceId, signed.SignedData, signed.Signature)
+			requires.NoError(err)
+			requires.Equal(&domain.SignatureVerification{Valid: true, KeyVersion: 1}, verification)
+
+			// Signatures made before a rotation verify with the retired key,
+			// and the rotation record itself with the key it retired.
+			rotation, err := service.RotateDeviceKey(context.Background(), nil, utils.DefaultTenant, deviceId)
+			requires.NoError(err)
+			verification, err = service.VerifySignature(context.Background(), nil, utils.DefaultTenant, deviceId, signed.SignedData, signed.Signature)
+			requires.NoError(err)
+			requires.Equal(&domain.SignatureVerification{Valid: true, KeyVersion: 1}, verification)
+			verification, err = service.VerifySignature(context.Background(), nil, utils.DefaultTenant, deviceId, rotation.SignedData, rotation.Signature)
+			requires.NoError(err)
+			requires.Equal(&domain.SignatureVerification{Valid: true, KeyVersion: 1}, verification)
+			signed, err = service.SignTransaction(context.Background(), nil, utils.DefaultTenant, deviceId, fmt.Sprintf("2_TestData_%s", rotation.Signature))
+			requires.NoError(err)
+			verification, err = service.VerifySignature(context.Background(), nil, utils.DefaultTenant, deviceId, signed.SignedData, signed.Signature)
+			requires.NoError(err)
+			requires.Equal(&domain.SignatureVerification{Valid: true, KeyVersion: 2}, verification)
+
+			verification, err = service.VerifySignature(context.Background(), nil, utils.DefaultTenant, deviceId, "2_OtherData_"+rotation.Signature, signed.Signature)
+			requires.NoError(err)
+			requires.False(verification.Valid)
+			verification, err = service.VerifySignature(context.Background(), nil, utils.DefaultTenant, deviceId, signed.SignedData, base64.StdEncoding.EncodeToString([]byte("forged")))
+			requires.NoError(err)
+			requires.False(verification.Valid)
+
+			_, err = service.VerifySignature(context.Background(), nil, utils.DefaultTenant, deviceId, "TestData", signed.Signature)
+			requires.ErrorIs(err, utils.ErrInvalidData)
+			_, err = service.VerifySignature(context.Background(), nil, utils.DefaultTenant, deviceId, signed.SignedData, "not base64!")
+			requires.ErrorIs(err, utils.ErrInvalidSignature)
+			_, err = service.VerifySignature(context.Background(), nil, utils.DefaultTenant, utils.RandomString(16), signed.SignedData, signed.Signature)
+			requires.ErrorIs(err, utils.ErrDeviceNotFound)
+		})
+	}
+}
+
+// racingRotationRepository stores a signature of the device right before
+// storing a key rotation, like a transaction signed during the rotation.
+type racingRotationRepository struct {
+	persistence.SignatureDeviceRepository
+}
+
+func (r racingRotationRepository) RotateDeviceKey(ctx context.Context, tenantID, deviceID string, signatureCounter int, publicKey, privateKey, signature string) error {
+	if err := r.UpdateDevice(ctx, tenantID, deviceID, signatureCounter, utils.RandomString(24)); err != nil {
+		return err
+	}
+	return r.SignatureDeviceRepository.RotateDeviceKey(ctx, tenantID, deviceID, signatureCounter, publicKey, privateKey, signature)
+}
+
+func TestRotateDeviceKeyWhileSigning(t *testing.T) {
+	requires := require.New(t)
+	repo := persistence.NewInMemorySignatureDeviceRepository(nil)
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           racingRotationRepository{repo},
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	})
+	deviceId := utils.RandomString(16)
+	created, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: "ECC",
+	})
+	requires.NoError(err)
+
+	// The rotation was signed at the counter the transaction took, storing
+	// it would fork the chain.
+	rotation, err := service.RotateDeviceKey(context.Background(), nil, utils.DefaultTenant, deviceId)
+	requires.ErrorIs(err, utils.ErrSignatureConflict)
+	requires.Nil(rotation)
+	device, err := repo.GetDevice(context.Background(), utils.DefaultTenant, deviceId)
+	requires.NoError(err)
+	requires.Equal(1, device.SignatureCounter)
+	requires.Equal(1, device.KeyVersion)
+	requires.Equal(created.PublicKey, device.PublicKey)
+}
+
+func TestImportSignatureDevice(t *testing.T) {
+	requires := require.New(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	requires.NoError(err)
+	weakRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	requires.NoError(err)
+	eccKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	requires.NoError(err)
+	encodePEM := func(blockType string, der []byte) *string {
+		encoded := string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+		return &encoded
+	}
+	encodePKCS8 := func(key any) *string {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		requires.NoError(err)
+		return encodePEM("PRIVATE KEY", der)
+	}
+	sec1, err := x509.MarshalECPrivateKey(eccKey)
+	requires.NoError(err)
+	kek := []byte("6543210987654321")
+	wrap := func(privateKey *string) *string {
+		wrapped, err := crypto.EncryptAES([]byte(*privateKey), kek)
+		requires.NoError(err)
+		return &wrapped
+	}
+	invalid := "not a key"
+
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+		KEK:            kek,
+	})
+
+	testCases := []struct {
+		name      string
+		algorithm string
+		request   domain.SignatureDeviceRequest
+		publicKey any
+		err       error
+	}{
+		{name: "RSA_PKCS1", algorithm: "RSA", request: domain.SignatureDeviceRequest{PrivateKey: encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))}, publicKey: &rsaKey.PublicKey},
+		{name: "RSA_PKCS8", algorithm: "RSA", request: domain.SignatureDeviceRequest{PrivateKey: encodePKCS8(rsaKey)}, publicKey: &rsaKey.PublicKey},
+		{name: "ECC_SEC1", algorithm: "ECC", request: domain.SignatureDeviceRequest{PrivateKey: encodePEM("EC PRIVATE KEY", sec1)}, publicKey: &eccKey.PublicKey},
+		{name: "ECC_PKCS8", algorithm: "ECC", request: domain.SignatureDeviceRequest{PrivateKey: encodePKCS8(eccKey)}, publicKey: &eccKey.PublicKey},
+		{name: "ECC_Wrapped", algorithm: "ECC", request: domain.SignatureDeviceRequest{WrappedPrivateKey: wrap(encodePKCS8(eccKey))}, publicKey: &eccKey.PublicKey},
+		{name: "Algorithm_Mismatch", algorithm: "ECC", request: domain.SignatureDeviceRequest{PrivateKey: encodePKCS8(rsaKey)}, err: utils.ErrKeyAlgorithmMismatch},
+		{name: "Weak_RSA_Key", algorithm: "RSA", request: domain.SignatureDeviceRequest{PrivateKey: encodePKCS8(weakRSAKey)}, err: utils.ErrInvalidPrivateKey},
+		{name: "Invalid_PEM", algorithm: "RSA", request: domain.SignatureDeviceRequest{PrivateKey: &invalid}, err: utils.ErrInvalidPrivateKey},
+		{name: "Invalid_Wrapped_Key", algorithm: "ECC", request: domain.SignatureDeviceRequest{WrappedPrivateKey: &invalid}, err: utils.ErrInvalidPrivateKey},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deviceId := utils.RandomString(16)
+			request := tc.request
+			request.ID = deviceId
+			request.Algorithm = tc.algorithm
+			device, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &request)
+			if tc.err != nil {
+				requires.ErrorIs(err, tc.err)
+				requires.Nil(device)
+				return
+			}
+			requires.NoError(err)
+			block, _ := pem.Decode([]byte(device.PublicKey))
+			var publicKey any
+			if tc.algorithm == "RSA" {
+				publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+			} else {
+				publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+			}
+			requires.NoError(err)
+			requires.Equal(tc.publicKey, publicKey)
+
+			data := fmt.Sprintf("0_TestData_%s", base64.StdEncoding.EncodeToString([]byte(deviceId)))
+			sr, err := service.SignTransaction(context.Background(), nil, utils.DefaultTenant, deviceId, data)
+			requires.NoError(err)
+			requires.NotNil(sr)
+		})
+	}
+}
+
+func TestUpdateSignatureDeviceDetails(t *testing.T) {
+	requires := require.New(t)
+
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	})
+	deviceId := utils.RandomString(16)
+	device, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: utils.Algorithms[1],
+		Metadata:  map[string]string{"store": "berlin-1", "serial": "SN-1"},
+	})
+	requires.NoError(err)
+	requires.Equal(map[string]string{"store": "berlin-1", "serial": "SN-1"}, device.Metadata)
+
+	value := func(v string) *string { return &v }
+	tooMany := make(map[string]*string)
+	for i := 0; i < utils.MaxMetadataEntries; i++ {
+		tooMany[fmt.Sprintf("key-%d", i)] = value("value")
+	}
+
+	testCases := []struct {
+		name     string
+		request  *domain.UpdateSignatureDeviceRequest
+		err      error
+		status   string
+		label    string
+		metadata map[string]string
+	}{
+		{
+			name:     "Update_Label",
+			request:  &domain.UpdateSignatureDeviceRequest{Label: value("till 1")},
+			label:    "till 1",
+			metadata: map[string]string{"store": "berlin-1", "serial": "SN-1"},
+		},
+		{
+			name:     "Merge_Metadata",
+			request:  &domain.UpdateSignatureDeviceRequest{Metadata: map[string]*string{"store": value("berlin-2"), "serial": nil, "lane": value("3")}},
+			label:    "till 1",
+			metadata: map[string]string{"store": "berlin-2", "lane": "3"},
+		},
+		{
+			// Nothing is changed when part of the update is invalid.
+			name:     "Metadata_Limit",
+			request:  &domain.UpdateSignatureDeviceRequest{Metadata: tooMany, Status: value(utils.DeviceStatusSuspended)},
+			err:      utils.ErrMetadataLimit,
+			status:   utils.DeviceStatusActive,
+			label:    "till 1",
+			metadata: map[string]string{"store": "berlin-2", "lane": "3"},
+		},
+		{
+			name:     "Update_Label_And_Decommission",
+			request:  &domain.UpdateSignatureDeviceRequest{Label: value("till 2"), Status: value(utils.DeviceStatusDecommissioned)},
+			status:   utils.DeviceStatusDecommissioned,
+			label:    "till 2",
+			metadata: map[string]string{"store": "berlin-2", "lane": "3"},
+		},
+		{
+			// An invalid status transition leaves the label untouched.
+			name:     "Update_Decommissioned",
+			request:  &domain.UpdateSignatureDeviceRequest{Label: value("till 3"), Status: value(utils.DeviceStatusActive)},
+			err:      utils.ErrInvalidStatusTransition,
+			label:    "till 2",
+			metadata: map[string]string{"store": "berlin-2", "lane": "3"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := service.UpdateSignatureDevice(context.Background(), nil, utils.DefaultTenant, deviceId, tc.request)
+			if tc.err != nil {
+				requires.ErrorIs(err, tc.err)
+				requires.Nil(d)
+			} else {
+				requires.NoError(err)
+			}
+			d, err = service.GetSignatureDevice(context.Background(), nil, utils.DefaultTenant, deviceId)
+			requires.NoError(err)
+			requires.Equal(tc.label, d.Label)
+			requires.Equal(tc.metadata, d.Metadata)
+			if tc.status != "" {
+				requires.Equal(tc.status, d.Status)
+			}
+		})
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	requires := require.New(t)
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	})
+	deviceId := utils.RandomString(16)
+	_, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: "ECC",
+	})
+	requires.NoError(err)
+
+	// Requests abandoned by the caller create no device.
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, algorithm := range utils.Algorithms {
+		id := utils.RandomString(16)
+		sd, err := service.CreateSignatureDevice(canceled, nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+			ID:        id,
+			Algorithm: algorithm,
+		})
+		requires.ErrorIs(err, context.Canceled)
+		requires.Nil(sd)
+		_, err = service.GetSignatureDevice(context.Background(), nil, utils.DefaultTenant, id)
+		requires.ErrorIs(err, utils.ErrDeviceNotFound)
+	}
+
+	// Requests past their deadline sign nothing.
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	data := "0_data_" + base64.StdEncoding.EncodeToString([]byte(deviceId))
+	sr, err := service.SignTransaction(expired, nil, utils.DefaultTenant, deviceId, data)
+	requires.ErrorIs(err, context.DeadlineExceeded)
+	requires.Nil(sr)
+	sr, err = service.SignTransaction(context.Background(), nil, utils.DefaultTenant, deviceId, data)
+	requires.NoError(err)
+	requires.Equal(data, sr.SignedData)
+}
+
+// failingUpdateRepository fails to store signatures.
+type failingUpdateRepository struct {
+	persistence.SignatureDeviceRepository
+}
+
+func (r failingUpdateRepository) UpdateDevice(context.Context, string, string, int, string) error {
+	return errors.New("write failed")
+}
+
+func TestSignTransactionNotStored(t *testing.T) {
+	requires := require.New(t)
+	repo := persistence.NewInMemorySignatureDeviceRepository(nil)
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           failingUpdateRepository{repo},
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	})
+	deviceId := utils.RandomString(16)
+	_, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: "ECC",
+	})
+	requires.NoError(err)
+
+	// Signatures that could not be stored are not handed out.
+	sr, err := service.SignTransaction(context.Background(), nil, utils.DefaultTenant, deviceId, "0_data_"+base64.StdEncoding.EncodeToString([]byte(deviceId)))
+	requires.Error(err)
+	requires.Nil(sr)
+	device, err := repo.GetDevice(context.Background(), utils.DefaultTenant, deviceId)
+	requires.NoError(err)
+	requires.Equal(0, device.SignatureCounter)
+}
+
+func TestSignTransactionConcurrently(t *testing.T) {
+	requires := require.New(t)
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+	})
+	deviceId := utils.RandomString(16)
+	maxSignatures := 1
+	_, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:            deviceId,
+		Algorithm:     "ECC",
+		MaxSignatures: &maxSignatures,
+	})
+	requires.NoError(err)
+
+	// Signers racing for the same counter and the last signature of the
+	// quota get exactly one signature.
+	data := "0_data_" + base64.StdEncoding.EncodeToString([]byte(deviceId))
+	var signed atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.SignTransaction(context.Background(), nil, utils.DefaultTenant, deviceId, data)
+			if err == nil {
+				signed.Add(1)
+				return
+			}
+			require.True(t, errors.Is(err, utils.ErrSignatureConflict) || errors.Is(err, utils.ErrSignatureQuotaExhausted), err)
+		}()
+	}
+	wg.Wait()
+	requires.Equal(int32(1), signed.Load())
+	device, err := service.GetSignatureDevice(context.Background(), nil, utils.DefaultTenant, deviceId)
+	requires.NoError(err)
+	requires.Equal(1, device.SignatureCounter)
+}
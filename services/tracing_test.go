@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/uwemakan/signing-service/crypto"
+	"github.com/uwemakan/signing-service/domain"
+	"github.com/uwemakan/signing-service/persistence"
+	"github.com/uwemakan/signing-service/utils"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanNamed returns the only ended span with the given name.
+func spanNamed(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	var found []sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == name {
+			found = append(found, span)
+		}
+	}
+	require.Len(t, found, 1, name)
+	return found[0]
+}
+
+// childNames returns the names of the children of parent in the order they
+// ended.
+func childNames(spans []sdktrace.ReadOnlySpan, parent sdktrace.ReadOnlySpan) []string {
+	var names []string
+	for _, span := range spans {
+		if span.Parent().SpanID() == parent.SpanContext().SpanID() {
+			names = append(names, span.Name())
+		}
+	}
+	return names
+}
+
+func TestTracing(t *testing.T) {
+	requires := require.New(t)
+	exporter := tracetest.NewInMemoryExporter()
+	service := NewSignatureService(SignatureServiceParams{
+		Repo:           persistence.NewInMemorySignatureDeviceRepository(nil),
+		KeyPairFactory: crypto.NewKeyPairFactory(),
+		SignerFactory:  crypto.NewSignerFactory(),
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)),
+	})
+	deviceId := uuid.NewString()
+
+	_, err := service.CreateSignatureDevice(context.Background(), nil, utils.DefaultTenant, &domain.SignatureDeviceRequest{
+		ID:        deviceId,
+		Algorithm: "ECC",
+	})
+	requires.NoError(err)
+	spans := exporter.GetSpans().Snapshots()
+	create := spanNamed(t, spans, "SignatureService.CreateSignatureDevice")
+	requires.False(create.Parent().IsValid())
+	requires.Equal([]string{"crypto.GenerateKeyPair", "crypto.EncryptAES", "repository.CreateDevice"}, childNames(spans, create))
+	requires.Equal(codes.Unset, create.Status().Code)
+
+	exporter.Reset()
+	_, err = service.SignTransaction(context.Background(), nil, utils.DefaultTenant, deviceId, "0_data_"+base64.StdEncoding.EncodeToString([]byte(deviceId)))
+	requires.NoError(err)
+	spans = exporter.GetSpans().Snapshots()
+	sign := spanNamed(t, spans, "SignatureService.SignTransaction")
+	requires.Equal([]string{
+		"repository.GetDevice",
+		"crypto.DecryptAES",
+		"crypto.ParsePrivateKey",
+		"crypto.Sign",
+		"repository.UpdateDevice",
+	}, childNames(spans, sign))
+	for _, span := range spans {
+		requires.Equal(sign.SpanContext().TraceID(), span.SpanContext().TraceID())
+	}
+
+	// Failures are recorded on the span of the operation.
+	exporter.Reset()
+	_, err = service.SignTransaction(context.Background(), nil, utils.DefaultTenant, uuid.NewString(), "0_data_x")
+	requires.ErrorIs(err, utils.ErrDeviceNotFound)
+	spans = exporter.GetSpans().Snapshots()
+	sign = spanNamed(t, spans, "SignatureService.SignTransaction")
+	requires.Equal(codes.Error, sign.Status().Code)
+	requires.Equal(codes.Error, spanNamed(t, spans, "repository.GetDevice").Status().Code)
+	requires.Equal([]string{"repository.GetDevice"}, childNames(spans, sign))
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/uwemakan/signing-service/utils"
+)
+
+// WorkerPool runs submitted tasks on a fixed number of goroutines.
+type WorkerPool struct {
+	tasks   chan func()
+	mu      sync.RWMutex
+	closed  bool
+	workers sync.WaitGroup
+}
+
+// NewWorkerPool starts a pool of workers that consume tasks from a bounded queue.
+// Non-positive sizes fall back to the defaults in utils.
+func NewWorkerPool(workers, queueSize int) *WorkerPool {
+	if workers <= 0 {
+		workers = utils.DefaultWorkerPoolSize
+	}
+	if queueSize <= 0 {
+		queueSize = utils.DefaultJobQueueSize
+	}
+	pool := &WorkerPool{tasks: make(chan func(), queueSize)}
+	pool.workers.Add(workers)
+	for range workers {
+		go func() {
+			defer pool.workers.Done()
+			for task := range pool.tasks {
+				task()
+			}
+		}()
+	}
+	return pool
+}
+
+// Submit queues a task without blocking. It returns utils.ErrJobQueueFull
+// when the queue has no free capacity and utils.ErrShuttingDown once the pool
+// is shut down.
+func (p *WorkerPool) Submit(task func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return utils.ErrShuttingDown
+	}
+	select {
+	case p.tasks <- task:
+		return nil
+	default:
+		return utils.ErrJobQueueFull
+	}
+}
+
+// Depth returns the number of tasks queued and not yet started.
+func (p *WorkerPool) Depth() int {
+	return len(p.tasks)
+}
+
+// Capacity returns the number of tasks the queue holds.
+func (p *WorkerPool) Capacity() int {
+	return cap(p.tasks)
+}
+
+// Shutdown stops the pool from accepting tasks and waits until the tasks
+// already queued have run or ctx is done, whichever happens first.
+func (p *WorkerPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/uwemakan/signing-service/utils"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName names the tracer of every component of the service.
+const InstrumentationName = "github.com/uwemakan/signing-service"
+
+// Propagator propagates traces between services in the W3C trace context and
+// baggage headers.
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// NewTracerProvider returns a tracer provider batching spans to the OTLP/HTTP
+// endpoint of the config. Parent based sampling keeps the decision of callers,
+// root spans are sampled at the configured ratio.
+func NewTracerProvider(ctx context.Context, config utils.TracingConfig) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(config.Endpoint))
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(config.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	), nil
+}
+
+// Call runs fn in a child span of the span in ctx, recording the error fn
+// returns on the span.
+func Call[T any](ctx context.Context, tracer trace.Tracer, name string, fn func(ctx context.Context) (T, error)) (T, error) {
+	ctx, span := tracer.Start(ctx, name)
+	defer span.End()
+	result, err := fn(ctx)
+	RecordError(span, err)
+	return result, err
+}
+
+// End records the error err points to, if any, and ends the span. It is
+// meant to be deferred by functions with a named error result.
+func End(span trace.Span, err *error) {
+	RecordError(span, *err)
+	span.End()
+}
+
+// RecordError marks the span as failed with err, if any.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time. It is injected wherever timestamps are
+// recorded so that tests can control time.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock backed by the system time.
+type SystemClock struct{}
+
+// Now returns the current time in UTC.
+func (SystemClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// FakeClock is a Clock that only moves when it is set or advanced.
+type FakeClock struct {
+	now time.Time
+	mu  sync.Mutex
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -2,14 +2,144 @@ package utils
 
 import (
 	"log"
+	"log/slog"
+	"math"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	AESKey        []byte
-	ServerAddress string
+	AESKey             []byte
+	ServerAddress      string
+	GRPCAddress        string
+	WorkerPoolSize     int
+	JobQueueSize       int
+	APIKeys            []APIKeyConfig
+	JWT                JWTConfig
+	TLS                TLSConfig
+	TenantDeviceLimit  int
+	TenantDeviceLimits map[string]int
+	RBACPolicyFile     string
+	RateLimits         RateLimitConfig
+	LogLevel           slog.Level
+	LogFormat          string
+	Tracing            TracingConfig
+	RequestTimeouts    RequestTimeoutConfig
+	Shutdown           ShutdownConfig
+	// LegacyErrorResponses has errors written as a list of messages, like
+	// the v0 API did, instead of as RFC 7807 problem details.
+	LegacyErrorResponses bool
+	// InsecureNoAuth lets the server run without any authentication
+	// configured, serving every request unauthenticated. It is only set by
+	// the --insecure-no-auth flag.
+	InsecureNoAuth bool
+}
+
+// ShutdownConfig configures how the server stops. For DrainPeriod new sign
+// requests are rejected while everything else is still served, so that load
+// balancers can route callers elsewhere. The server then stops accepting
+// connections and waits up to Timeout for requests and jobs in flight. A
+// zero Timeout waits for as long as they take.
+type ShutdownConfig struct {
+	DrainPeriod time.Duration
+	Timeout     time.Duration
+}
+
+// RequestTimeoutConfig sets the deadline of requests, after which the work
+// done for them is cancelled. Routes overrides the Default deadline by route
+// pattern, e.g. /api/v0/signature-devices/sign. A zero deadline disables it.
+type RequestTimeoutConfig struct {
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+// For returns the deadline of requests to the route.
+func (c RequestTimeoutConfig) For(route string) time.Duration {
+	if timeout, exists := c.Routes[route]; exists {
+		return timeout
+	}
+	return c.Default
+}
+
+// TracingConfig configures the export of traces over OTLP/HTTP. Tracing is
+// enabled when an endpoint is configured. SampleRatio is the share of traces
+// started by the service that are sampled.
+type TracingConfig struct {
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64
+}
+
+// Enabled reports whether traces should be exported.
+func (c TracingConfig) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+// RateLimit is a token bucket refilled with Rate tokens per second up to
+// Burst tokens. A zero Rate disables the limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the limit applies.
+func (l RateLimit) Enabled() bool {
+	return l.Rate > 0
+}
+
+// RateLimitConfig limits the requests of every caller and the signatures of
+// every device. DeviceOverrides replaces the device limit of individual
+// devices by device ID.
+type RateLimitConfig struct {
+	Client          RateLimit
+	Device          RateLimit
+	DeviceOverrides map[string]RateLimit
+}
+
+// TLSConfig configures HTTPS serving. TLS is enabled when a certificate and key
+// are configured. ClientAuth is one of "none", "request" or "require"; client
+// certificates are verified against the ClientCAFile bundle. Terminals
+// authenticated by a client certificate alone are bound to ClientTenant, the
+// default tenant when it is empty.
+type TLSConfig struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	MinVersion   string
+	ClientAuth   string
+	ClientTenant string
+}
+
+// Enabled reports whether the server should be served over TLS.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// JWTConfig configures bearer token authentication. It is enabled when
+// either a JWKS file or at least one static public key is configured.
+type JWTConfig struct {
+	JWKSFile   string
+	PublicKeys map[string]string
+	Issuer     string
+	Audience   string
+}
+
+// Enabled reports whether any verification key has been configured.
+func (c JWTConfig) Enabled() bool {
+	return c.JWKSFile != "" || len(c.PublicKeys) > 0
+}
+
+// APIKeyConfig is an API key bootstrapped from the environment.
+// Keys with a Tenant can only be used within that tenant.
+type APIKeyConfig struct {
+	ID     string
+	Owner  string
+	Tenant string
+	Secret string
 }
 
 func NewConfig() *Config {
@@ -31,5 +161,171 @@ func NewConfig() *Config {
 		serverAddress = ":8080"
 	}
 	cfg.ServerAddress = serverAddress
+	// The gRPC API is only served when an address is set.
+	cfg.GRPCAddress = os.Getenv("GRPC_ADDRESS")
+	cfg.WorkerPoolSize = getEnvInt("WORKER_POOL_SIZE", DefaultWorkerPoolSize)
+	cfg.JobQueueSize = getEnvInt("JOB_QUEUE_SIZE", DefaultJobQueueSize)
+	cfg.APIKeys = parseAPIKeys(os.Getenv("API_KEYS"))
+	apiKeyTenants := parseKeyValues("API_KEY_TENANTS", os.Getenv("API_KEY_TENANTS"))
+	for i := range cfg.APIKeys {
+		cfg.APIKeys[i].Tenant = apiKeyTenants[cfg.APIKeys[i].ID]
+	}
+	cfg.JWT = JWTConfig{
+		JWKSFile:   os.Getenv("JWT_JWKS_FILE"),
+		PublicKeys: parseKeyValues("JWT_PUBLIC_KEYS", os.Getenv("JWT_PUBLIC_KEYS")),
+		Issuer:     os.Getenv("JWT_ISSUER"),
+		Audience:   os.Getenv("JWT_AUDIENCE"),
+	}
+	cfg.TLS = TLSConfig{
+		CertFile:     os.Getenv("TLS_CERT_FILE"),
+		KeyFile:      os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+		MinVersion:   os.Getenv("TLS_MIN_VERSION"),
+		ClientAuth:   os.Getenv("TLS_CLIENT_AUTH"),
+		ClientTenant: os.Getenv("TLS_CLIENT_TENANT"),
+	}
+	cfg.TenantDeviceLimit = getEnvInt("TENANT_DEVICE_LIMIT", 0)
+	cfg.TenantDeviceLimits = make(map[string]int)
+	for tenant, limit := range parseKeyValues("TENANT_DEVICE_LIMITS", os.Getenv("TENANT_DEVICE_LIMITS")) {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			log.Fatalf("Invalid TENANT_DEVICE_LIMITS entry for %s: %q", tenant, limit)
+		}
+		cfg.TenantDeviceLimits[tenant] = n
+	}
+	cfg.RBACPolicyFile = os.Getenv("RBAC_POLICY_FILE")
+	cfg.RateLimits = RateLimitConfig{
+		Client:          parseRateLimit("RATE_LIMIT_CLIENT", os.Getenv("RATE_LIMIT_CLIENT")),
+		Device:          parseRateLimit("RATE_LIMIT_DEVICE", os.Getenv("RATE_LIMIT_DEVICE")),
+		DeviceOverrides: make(map[string]RateLimit),
+	}
+	for device, limit := range parseKeyValues("RATE_LIMIT_DEVICE_OVERRIDES", os.Getenv("RATE_LIMIT_DEVICE_OVERRIDES")) {
+		cfg.RateLimits.DeviceOverrides[device] = parseRateLimit("RATE_LIMIT_DEVICE_OVERRIDES", limit)
+	}
+	cfg.LogLevel, err = ParseLogLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		log.Fatalf("Invalid LOG_LEVEL: %q", os.Getenv("LOG_LEVEL"))
+	}
+	cfg.LogFormat = os.Getenv("LOG_FORMAT")
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = LogFormatJSON
+	}
+	if cfg.LogFormat != LogFormatJSON && cfg.LogFormat != LogFormatText {
+		log.Fatalf("Invalid LOG_FORMAT: %q", cfg.LogFormat)
+	}
+	cfg.Tracing = TracingConfig{
+		Endpoint:    os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+		SampleRatio: 1,
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = DefaultServiceName
+	}
+	if ratio := os.Getenv("TRACING_SAMPLE_RATIO"); ratio != "" {
+		cfg.Tracing.SampleRatio, err = strconv.ParseFloat(ratio, 64)
+		if err != nil || cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+			log.Fatalf("Invalid TRACING_SAMPLE_RATIO: %q", ratio)
+		}
+	}
+	cfg.RequestTimeouts = RequestTimeoutConfig{
+		Default: getEnvDuration("REQUEST_TIMEOUT", DefaultRequestTimeout),
+		Routes:  make(map[string]time.Duration),
+	}
+	for route, timeout := range parseKeyValues("REQUEST_TIMEOUTS", os.Getenv("REQUEST_TIMEOUTS")) {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d < 0 {
+			log.Fatalf("Invalid REQUEST_TIMEOUTS entry for %s: %q", route, timeout)
+		}
+		cfg.RequestTimeouts.Routes[route] = d
+	}
+	cfg.LegacyErrorResponses = os.Getenv("LEGACY_ERROR_RESPONSES") == "true"
+	cfg.Shutdown = ShutdownConfig{
+		DrainPeriod: getEnvDuration("SHUTDOWN_DRAIN_PERIOD", DefaultShutdownDrainPeriod),
+		Timeout:     getEnvDuration("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout),
+	}
 	return cfg
 }
+
+// parseRateLimit reads a rate limit given as rate:burst, e.g. 10:20 for ten
+// requests per second with bursts of up to twenty. An empty value disables
+// the limit.
+func parseRateLimit(name, value string) RateLimit {
+	if value == "" {
+		return RateLimit{}
+	}
+	r, b, found := strings.Cut(value, ":")
+	rate, err := strconv.ParseFloat(r, 64)
+	if err != nil || rate < 0 {
+		log.Fatalf("Invalid %s: %q", name, value)
+	}
+	burst := max(int(math.Ceil(rate)), 1)
+	if found {
+		burst, err = strconv.Atoi(b)
+		if err != nil || burst < 1 {
+			log.Fatalf("Invalid %s: %q", name, value)
+		}
+	}
+	return RateLimit{Rate: rate, Burst: burst}
+}
+
+// parseKeyValues reads a comma separated list of key=value entries.
+func parseKeyValues(name, value string) map[string]string {
+	values := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		k, v, found := strings.Cut(entry, "=")
+		if !found || k == "" || v == "" {
+			log.Fatalf("Invalid %s entry: expected key=value", name)
+		}
+		values[k] = v
+	}
+	return values
+}
+
+// parseAPIKeys reads a comma separated list of id:owner:secret entries.
+func parseAPIKeys(value string) []APIKeyConfig {
+	var keys []APIKeyConfig
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			log.Fatalf("Invalid API_KEYS entry: expected id:owner:secret")
+		}
+		keys = append(keys, APIKeyConfig{ID: parts[0], Owner: parts[1], Secret: parts[2]})
+	}
+	return keys
+}
+
+// getEnvInt reads a non-negative integer from the environment, falling back to
+// the given default when the variable is unset.
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if len(value) == 0 {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid %s: %q", key, value)
+	}
+	return n
+}
+
+// getEnvDuration reads a non-negative duration, such as 1.5s, from the
+// environment, falling back to the given default when the variable is unset.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if len(value) == 0 {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Fatalf("Invalid %s: %q", key, value)
+	}
+	return d
+}
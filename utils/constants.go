@@ -1,6 +1,161 @@
 package utils
 
+import "time"
+
 var (
 	Algorithms = []string{"RSA", "ECC"}
-	Alphabets = "abcdefghijklmnopqrstuvwxyz"
-)
\ No newline at end of file
+	Alphabets  = "abcdefghijklmnopqrstuvwxyz"
+)
+
+// Version is the build version of the service, set at link time with
+// -ldflags "-X github.com/uwemakan/signing-service/utils.Version=v1.2.3".
+var Version = "dev"
+
+// DefaultTenant is the tenant of devices managed through the v0 API.
+const DefaultTenant = "default"
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// Scopes that can be granted to callers. API keys are granted every scope and
+// client certificates on their own CertificateScopes.
+const (
+	ScopeDevicesRead      = "devices:read"
+	ScopeDevicesWrite     = "devices:write"
+	ScopeDevicesBackup    = "devices:backup"
+	ScopeTransactionsSign = "transactions:sign"
+)
+
+var Scopes = []string{ScopeDevicesRead, ScopeDevicesWrite, ScopeDevicesBackup, ScopeTransactionsSign}
+
+// CertificateScopes are the scopes of terminals authenticated by a client
+// certificate alone: they manage and sign with their devices but can't export
+// or restore backups.
+var CertificateScopes = []string{ScopeDevicesRead, ScopeDevicesWrite, ScopeTransactionsSign}
+
+// Lifecycle statuses of a signature device. Only active devices can sign;
+// decommissioned devices have their private key destroyed and can't be
+// reactivated.
+const (
+	DeviceStatusActive         = "active"
+	DeviceStatusSuspended      = "suspended"
+	DeviceStatusDecommissioned = "decommissioned"
+)
+
+// DeviceStatuses lists the device statuses from the least to the most
+// restrictive.
+var DeviceStatuses = []string{
+	DeviceStatusActive,
+	DeviceStatusSuspended,
+	DeviceStatusDecommissioned,
+}
+
+// Permissions that roles can grant when role-based access control is enabled.
+const (
+	PermissionDevicesBackup     = "devices:backup"
+	PermissionDevicesCreate     = "devices:create"
+	PermissionDevicesDeactivate = "devices:deactivate"
+	PermissionDevicesList       = "devices:list"
+	PermissionDevicesRead       = "devices:read"
+	PermissionDevicesRestore    = "devices:restore"
+	PermissionDevicesRotate     = "devices:rotate"
+	PermissionDevicesUpdate     = "devices:update"
+	PermissionJobsRead          = "jobs:read"
+	PermissionTransactionsSign  = "transactions:sign"
+)
+
+var Permissions = []string{
+	PermissionDevicesBackup,
+	PermissionDevicesCreate,
+	PermissionDevicesDeactivate,
+	PermissionDevicesList,
+	PermissionDevicesRead,
+	PermissionDevicesRestore,
+	PermissionDevicesRotate,
+	PermissionDevicesUpdate,
+	PermissionJobsRead,
+	PermissionTransactionsSign,
+}
+
+// Credentials are the types of credentials a principal authenticates with,
+// used to qualify device owners and principal IDs in role bindings.
+const (
+	CredentialAPIKey      = "key"
+	CredentialCertificate = "cert"
+	CredentialJWT         = "jwt"
+)
+
+var Credentials = []string{
+	CredentialAPIKey,
+	CredentialCertificate,
+	CredentialJWT,
+}
+
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleSigner   = "signer"
+)
+
+const (
+	DefaultWorkerPoolSize = 4
+	DefaultJobQueueSize   = 100
+)
+
+// Statuses of health checks. Warnings leave the service ready.
+const (
+	HealthStatusPass = "pass"
+	HealthStatusWarn = "warn"
+	HealthStatusFail = "fail"
+)
+
+// HealthQueueWarnRatio is the share of the job queue in use from which its
+// health check warns.
+const HealthQueueWarnRatio = 0.8
+
+// DefaultRequestTimeout is the deadline of requests unless configured.
+const DefaultRequestTimeout = 30 * time.Second
+
+const (
+	DefaultShutdownDrainPeriod = 5 * time.Second
+	DefaultShutdownTimeout     = 30 * time.Second
+)
+
+// DefaultServiceName identifies the service in traces unless configured.
+const DefaultServiceName = "signing-service"
+
+// Limits of device labels and metadata.
+const (
+	MaxLabelLength         = 128
+	MaxMetadataEntries     = 16
+	MaxMetadataKeyLength   = 64
+	MaxMetadataValueLength = 256
+)
+
+// Keys devices can be sorted by when listed. Pages hold DefaultPageSize
+// devices unless a limit of up to MaxPageSize is requested.
+const (
+	DeviceSortCreated          = "created"
+	DeviceSortUpdated          = "updated"
+	DeviceSortLastSigned       = "lastSigned"
+	DeviceSortSignatureCounter = "signatureCounter"
+	DefaultPageSize            = 100
+	MaxPageSize                = 1000
+)
+
+var DeviceSortKeys = []string{DeviceSortCreated, DeviceSortUpdated, DeviceSortLastSigned, DeviceSortSignatureCounter}
+
+// Backup archives are encrypted with a key derived from a passphrase of at
+// least MinBackupPassphraseLength characters or from a 256-bit key. Archives
+// asking for more than MaxBackupKDFIterations are refused, deriving their key
+// would tie up the server.
+const (
+	BackupArchiveVersion      = 1
+	BackupKDFIterations       = 600000
+	MaxBackupKDFIterations    = 4 * BackupKDFIterations
+	BackupSaltSize            = 16
+	MinBackupPassphraseLength = 12
+)
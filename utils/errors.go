@@ -1,13 +1,161 @@
 package utils
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ErrorKind classifies errors by how callers should react to them, which
+// decides the status they are answered with, whatever the transport.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindInvalid
+	KindUnprocessable
+	KindUnauthenticated
+	KindForbidden
+	KindNotFound
+	KindMethodNotAllowed
+	KindConflict
+	KindGone
+	KindRateLimited
+	KindUnavailable
+	KindTimeout
+	KindCanceled
+)
+
+// Error is an error of the service with a stable, machine readable code that
+// clients can match on instead of its message. The errors below are its only
+// instances; they are wrapped to add detail.
+type Error struct {
+	Code    string
+	Kind    ErrorKind
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// knownErrors are the errors below, in the order they are declared.
+var knownErrors []*Error
+
+func newError(code string, kind ErrorKind, message string) error {
+	err := &Error{Code: code, Kind: kind, Message: message}
+	knownErrors = append(knownErrors, err)
+	return err
+}
 
 var (
-    ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
-	ErrInvalidSignatureCounter = errors.New("invalid signature counter")
-	ErrInvalidLastSignature    = errors.New("invalid last signature")
-	ErrInvalidData             = errors.New("invalid data")
-	ErrDeviceNotFound      = errors.New("device not found")
-	ErrDeviceAlreadyExists = errors.New("device already exists")
-	ErrInvalidDeviceId = errors.New("device ID must be a valid UUID")
+	ErrUnsupportedAlgorithm    = newError("unsupported_algorithm", KindInvalid, "unsupported algorithm")
+	ErrInvalidSignatureCounter = newError("invalid_signature_counter", KindInvalid, "invalid signature counter")
+	ErrInvalidLastSignature    = newError("invalid_last_signature", KindInvalid, "invalid last signature")
+	ErrInvalidData             = newError("invalid_data", KindInvalid, "invalid data")
+	ErrInvalidSignature        = newError("invalid_signature", KindInvalid, "signature must be base64 encoded")
+	ErrDeviceNotFound          = newError("device_not_found", KindNotFound, "device not found")
+	ErrDeviceAlreadyExists     = newError("device_already_exists", KindInvalid, "device already exists")
+	ErrInvalidDeviceId         = newError("invalid_device_id", KindInvalid, "device ID must be a valid UUID")
+	ErrJobNotFound             = newError("job_not_found", KindNotFound, "job not found")
+	ErrInvalidJobId            = newError("invalid_job_id", KindInvalid, "job ID must be a valid UUID")
+	ErrJobQueueFull            = newError("job_queue_full", KindUnavailable, "job queue is full, try again later")
+	ErrUnauthenticated         = newError("unauthenticated", KindUnauthenticated, "missing or invalid credentials")
+	ErrInvalidToken            = newError("invalid_token", KindUnauthenticated, "invalid bearer token")
+	ErrInsufficientScope       = newError("insufficient_scope", KindForbidden, "insufficient scope")
+	ErrDeviceBoundToTerminal   = newError("device_bound_to_terminal", KindForbidden, "device is bound to another terminal")
+	ErrInvalidTenantId         = newError("invalid_tenant_id", KindInvalid, "tenant ID must be 1-63 lowercase letters, digits or dashes")
+	ErrTenantAccessDenied      = newError("tenant_access_denied", KindForbidden, "access to tenant denied")
+	ErrTenantDeviceLimit       = newError("tenant_device_limit", KindForbidden, "tenant device limit reached")
+	ErrInvalidPrivateKey       = newError("invalid_private_key", KindInvalid, "invalid private key")
+	ErrKeyAlgorithmMismatch    = newError("key_algorithm_mismatch", KindInvalid, "private key does not match algorithm")
+	ErrInvalidCiphertext       = newError("invalid_ciphertext", KindInternal, "invalid ciphertext")
+	ErrInvalidBackupSecret     = newError("invalid_backup_secret", KindInvalid, "either a passphrase of at least 12 characters or a base64 encoded 256-bit key is required")
+	ErrInvalidBackupArchive    = newError("invalid_backup_archive", KindInvalid, "invalid backup archive or wrong passphrase or key")
+	ErrBackupRollback          = newError("backup_rollback", KindConflict, "backup is older than the device it would replace")
+	ErrMetadataLimit           = newError("metadata_limit", KindInvalid, fmt.Sprintf("device metadata is limited to %d entries", MaxMetadataEntries))
+	ErrInvalidCursor           = newError("invalid_cursor", KindInvalid, "invalid cursor")
+	ErrInvalidDeviceStatus     = newError("invalid_device_status", KindInvalid, "invalid device status")
+	ErrDeviceNotActive         = newError("device_not_active", KindConflict, "signature device is not active")
+	ErrSignatureQuotaExhausted = newError("signature_quota_exhausted", KindConflict, "signature quota of the device is exhausted")
+	ErrSignatureConflict       = newError("signature_conflict", KindConflict, "the device signed concurrently, retry with its current signature counter")
+	ErrDeviceExpired           = newError("device_expired", KindGone, "signature device has expired")
+	ErrRateLimited             = newError("rate_limited", KindRateLimited, "rate limit exceeded")
+	ErrInvalidNotAfter         = newError("invalid_not_after", KindInvalid, "notAfter must be in the future")
+	ErrInvalidStatusTransition = newError("invalid_status_transition", KindConflict, "invalid device status transition")
+	ErrPermissionDenied        = newError("permission_denied", KindForbidden, "permission denied")
+	ErrAPIKeyNotFound          = newError("api_key_not_found", KindInternal, "API key not found")
+	ErrAPIKeyAlreadyExists     = newError("api_key_already_exists", KindInternal, "API key already exists")
+	ErrShuttingDown            = newError("shutting_down", KindUnavailable, "server is shutting down, try again later")
+	ErrInvalidRequest          = newError("invalid_request", KindInvalid, "invalid request")
+	ErrMalformedRequest        = newError("malformed_request", KindUnprocessable, "request body is not valid JSON")
+	ErrMethodNotAllowed        = newError("method_not_allowed", KindMethodNotAllowed, "method not allowed")
 )
+
+// RateLimitedError is ErrRateLimited with how long until a token is
+// available, which callers are told to wait before they retry.
+type RateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return ErrRateLimited.Error()
+}
+
+func (e *RateLimitedError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// ErrorInternal is the code of errors that are not one of the errors above.
+const ErrorInternal = "internal"
+
+// Codes of the errors of requests past their deadline or abandoned by the
+// caller.
+const (
+	ErrorDeadlineExceeded = "deadline_exceeded"
+	ErrorCanceled         = "canceled"
+)
+
+// ErrorCode returns the code of err, or ErrorInternal for unknown errors.
+// Codes are stable and used as metric labels and in error responses.
+func ErrorCode(err error) string {
+	var known *Error
+	switch {
+	case errors.As(err, &known):
+		return known.Code
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return ErrorCanceled
+	default:
+		return ErrorInternal
+	}
+}
+
+// ErrorKindOf returns the kind of err, or KindInternal for unknown errors.
+func ErrorKindOf(err error) ErrorKind {
+	var known *Error
+	switch {
+	case errors.As(err, &known):
+		return known.Kind
+	case errors.Is(err, context.DeadlineExceeded):
+		return KindTimeout
+	case errors.Is(err, context.Canceled):
+		return KindCanceled
+	default:
+		return KindInternal
+	}
+}
+
+// ErrorCodes returns the codes of all errors, including ErrorInternal, in
+// alphabetical order.
+func ErrorCodes() []string {
+	codes := []string{ErrorInternal, ErrorDeadlineExceeded, ErrorCanceled}
+	for _, err := range knownErrors {
+		codes = append(codes, err.Code)
+	}
+	slices.Sort(codes)
+	return slices.Compact(codes)
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Log formats and the value redacted attributes are replaced with.
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+	Redacted      = "[REDACTED]"
+)
+
+// redactedLogKeys are attribute keys, compared case-insensitively, whose
+// values are never logged because they hold key material, secrets or the
+// payloads being signed.
+var redactedLogKeys = map[string]bool{
+	"privatekey":        true,
+	"wrappedprivatekey": true,
+	"passphrase":        true,
+	"key":               true,
+	"secret":            true,
+	"apikey":            true,
+	"authorization":     true,
+	"ciphertext":        true,
+	"data":              true,
+	"signeddata":        true,
+	"signed_data":       true,
+}
+
+// redact replaces the values of sensitive attributes, at any level of
+// nesting, with Redacted.
+func redact(_ []string, attr slog.Attr) slog.Attr {
+	if redactedLogKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, Redacted)
+	}
+	return attr
+}
+
+// ParseLogLevel reads a level of debug, info, warn or error, defaulting to
+// info when the level is empty.
+func ParseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+	err := l.UnmarshalText([]byte(level))
+	return l, err
+}
+
+// NewLogger creates a logger writing JSON or text records of at least the
+// given level to w. Sensitive attributes are redacted by the handler, so a
+// secret logged by mistake never reaches the output.
+func NewLogger(w io.Writer, level slog.Level, format string) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+	if format == LogFormatText {
+		return slog.New(slog.NewTextHandler(w, options))
+	}
+	return slog.New(slog.NewJSONHandler(w, options))
+}